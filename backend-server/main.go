@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 )
 
 type Response struct {
@@ -16,17 +17,50 @@ type Response struct {
 	ServiceName string              `json:"service_name"`
 }
 
+// ErrorResponse はエラーレスポンスのボディ
+// test-function のエラー（lambda/test-function/apierror の Body）と同じ形式にする
+// apierror の Body のフィールドやエラーコードを変更した場合は、ErrorResponse と writeError も合わせて変更すること
+type ErrorResponse struct {
+	Status  string `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError はエラーレスポンスを返す
+// code は test-function と同じコード（VALIDATION_ERROR, NOT_FOUND, METHOD_NOT_ALLOWED 等）を使う
+func writeError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{Status: "error", Code: code, Message: message})
+}
+
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
+// isServicePath は backend-server が応答するパスかを返す
+// API Gateway の VPC Link 統合は "/"、ALB はサービス名のパス（"/users"・"/users/*" 等）に転送する
+func isServicePath(path, serviceName string) bool {
+	prefix := "/" + serviceName
+	return path == "/" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
 func mainHandler(w http.ResponseWriter, r *http.Request) {
 	serviceName := os.Getenv("SERVICE_NAME")
 	if serviceName == "" {
 		serviceName = "unknown"
 	}
 
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", fmt.Sprintf("method %s is not allowed", r.Method))
+		return
+	}
+	if !isServicePath(r.URL.Path, serviceName) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("path %s is not found", r.URL.Path))
+		return
+	}
+
 	resp := Response{
 		Message:     fmt.Sprintf("Hello from %s service!", serviceName),
 		Headers:     r.Header,
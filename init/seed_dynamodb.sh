@@ -5,7 +5,7 @@
 # Terraform でテーブル作成後に実行してください。
 #
 # 投入データ:
-#   - token: "allow" (Lambda Authorizer で使用される許可トークン)
+#   - token: "allow" (Lambda Authorizer で使用される許可トークン、usage plan の API キー付き)
 #
 # 注意: 既存のデータがある場合は上書きされます。
 set -eu
@@ -38,7 +38,7 @@ fi
 echo "[seed] inserting allow token into $TABLE"
 aws dynamodb put-item \
   --table-name "$TABLE" \
-  --item '{"token":{"S":"allow"}}' \
+  --item '{"token":{"S":"allow"},"apiKey":{"S":"local-seed-tenant-api-key"}}' \
   --endpoint-url="$ENDPOINT"
 
 echo "[seed] verifying data"
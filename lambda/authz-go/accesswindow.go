@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	// Lambda の provided ランタイムにはタイムゾーンデータベースがないため埋め込む
+	_ "time/tzdata"
+)
+
+// AccessWindow はトークンを使用できる時間帯
+// 時刻は Timezone のローカル時刻で評価し、End が Start 以前の場合は翌日の End まで（日付をまたぐ）とみなす
+type AccessWindow struct {
+	// Days は曜日（mon, tue, wed, thu, fri, sat, sun、未設定の場合は毎日）
+	// 日付をまたぐ時間帯では開始時刻の曜日で判定する
+	Days []string `dynamodbav:"days"`
+	// Start / End は "HH:MM" 形式の開始時刻（含む）と終了時刻（含まない）、End には "24:00" も指定できる
+	Start string `dynamodbav:"start"`
+	End   string `dynamodbav:"end"`
+	// Timezone は IANA タイムゾーン名（未設定の場合は UTC）
+	Timezone string `dynamodbav:"timezone"`
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Contains は t が時間帯に含まれるかを返す
+// 曜日・時刻・タイムゾーンが不正な場合はエラーを返す
+func (w AccessWindow) Contains(t time.Time) (bool, error) {
+	loc := time.UTC
+	if w.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return false, fmt.Errorf("invalid timezone %q: %w", w.Timezone, err)
+		}
+	}
+
+	days := make([]time.Weekday, 0, len(w.Days))
+	for _, d := range w.Days {
+		wd, ok := weekdayNames[strings.ToLower(d)]
+		if !ok {
+			return false, fmt.Errorf("invalid day %q", d)
+		}
+		days = append(days, wd)
+	}
+	onDay := func(wd time.Weekday) bool {
+		return len(days) == 0 || slices.Contains(days, wd)
+	}
+
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false, fmt.Errorf("invalid start: %w", err)
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false, fmt.Errorf("invalid end: %w", err)
+	}
+	if start == end {
+		return false, errors.New("start and end must differ")
+	}
+
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	if start < end {
+		return onDay(local.Weekday()) && start <= minute && minute < end, nil
+	}
+	// 日付をまたぐ時間帯: 当日の開始時刻以降か、前日に始まった時間帯の終了時刻前
+	yesterday := (local.Weekday() + 6) % 7
+	return (onDay(local.Weekday()) && minute >= start) || (onDay(yesterday) && minute < end), nil
+}
+
+// parseClock は "HH:MM" を0時からの経過分に変換する（"24:00" は1440）
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || len(s) != 5 {
+		return 0, fmt.Errorf("%q must be HH:MM", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("%q is out of range", s)
+	}
+	return h*60 + m, nil
+}
+
+// inAccessWindows は t がいずれかの時間帯に含まれるかを返す
+func inAccessWindows(windows []AccessWindow, t time.Time) (bool, error) {
+	for i, w := range windows {
+		ok, err := w.Contains(t)
+		if err != nil {
+			return false, fmt.Errorf("accessWindows[%d]: %w", i, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_時間帯の判定がタイムゾーンと曜日を考慮すること(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	assert.NoError(t, err)
+
+	businessHours := AccessWindow{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "18:00", Timezone: "Asia/Tokyo"}
+	// 土曜 22:00 から日曜 02:00 までのメンテナンス枠
+	maintenance := AccessWindow{Days: []string{"sat"}, Start: "22:00", End: "02:00", Timezone: "Asia/Tokyo"}
+
+	tests := []struct {
+		name   string
+		window AccessWindow
+		now    time.Time
+		want   bool
+	}{
+		{"営業時間内", businessHours, time.Date(2026, 10, 19, 9, 0, 0, 0, tokyo), true},
+		{"終了時刻ちょうどは含まない", businessHours, time.Date(2026, 10, 19, 18, 0, 0, 0, tokyo), false},
+		{"UTCでは営業時間外でも現地時刻で判定すること", businessHours, time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC), true},
+		{"土曜日は対象外", businessHours, time.Date(2026, 10, 24, 10, 0, 0, 0, tokyo), false},
+		{"日付をまたぐ枠の開始日", maintenance, time.Date(2026, 10, 24, 23, 0, 0, 0, tokyo), true},
+		{"日付をまたぐ枠の翌日", maintenance, time.Date(2026, 10, 25, 1, 59, 0, 0, tokyo), true},
+		{"日付をまたぐ枠の終了後", maintenance, time.Date(2026, 10, 25, 2, 0, 0, 0, tokyo), false},
+		{"開始日でない曜日の深夜", maintenance, time.Date(2026, 10, 24, 1, 0, 0, 0, tokyo), false},
+		{"曜日とタイムゾーンが未設定の場合は毎日UTC", AccessWindow{Start: "00:00", End: "24:00"}, time.Date(2026, 10, 25, 23, 59, 0, 0, time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.window.Contains(tt.now)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_不正な時間帯はエラーになること(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  AccessWindow
+		wantErr string
+	}{
+		{"不正なタイムゾーン", AccessWindow{Start: "09:00", End: "18:00", Timezone: "Mars/Olympus"}, `invalid timezone "Mars/Olympus"`},
+		{"不正な曜日", AccessWindow{Days: []string{"monday"}, Start: "09:00", End: "18:00"}, `invalid day "monday"`},
+		{"不正な形式の時刻", AccessWindow{Start: "9:00", End: "18:00"}, `invalid start: "9:00" must be HH:MM`},
+		{"範囲外の時刻", AccessWindow{Start: "09:00", End: "24:30"}, `invalid end: "24:30" is out of range`},
+		{"開始と終了が同じ", AccessWindow{Start: "09:00", End: "09:00"}, "start and end must differ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.window.Contains(time.Now())
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_利用時間帯外のリクエストはDenyを返すこと(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("window")
+	err := putTestRecord(testToken, map[string]types.AttributeValue{
+		"accessWindows": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+				"days":     &types.AttributeValueMemberSS{Value: []string{"mon", "tue", "wed", "thu", "fri"}},
+				"start":    &types.AttributeValueMemberS{Value: "09:00"},
+				"end":      &types.AttributeValueMemberS{Value: "18:00"},
+				"timezone": &types.AttributeValueMemberS{Value: "America/New_York"},
+			}},
+		}},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(testToken)
+
+	brokenToken := testutil.GenerateUniqueID("window")
+	err = putTestRecord(brokenToken, map[string]types.AttributeValue{
+		"accessWindows": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+				"start": &types.AttributeValueMemberS{Value: "9am"},
+				"end":   &types.AttributeValueMemberS{Value: "18:00"},
+			}},
+		}},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(brokenToken)
+
+	// 2026-10-19 は月曜日（ニューヨークは夏時間で UTC-4）
+	tests := []struct {
+		name    string
+		token   string
+		now     time.Time
+		effect  string
+		context map[string]interface{}
+	}{
+		{"時間帯内はAllowを返すこと", testToken, time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC), "Allow", nil},
+		{"時間帯外はDenyを返すこと", testToken, time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC), "Deny", map[string]interface{}{"reason": "outside_access_window"}},
+		{"不正な時間帯のトークンはDenyを返すこと", brokenToken, time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC), "Deny", map[string]interface{}{"error": "invalid_token_record"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &Authorizer{
+				TableName: TestTableName,
+				DDBClient: testDDBClient,
+				Now:       func() time.Time { return tt.now },
+			}
+
+			resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+				AuthorizationToken: "Bearer " + tt.token,
+				MethodArn:          testMethodArn,
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.PolicyDocument.Statement[0].Effect)
+			for k, v := range tt.context {
+				assert.Equal(t, v, resp.Context[k])
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"slices"
+)
+
+const (
+	// ActAsCompanyHeader はなりすまし先のテナントIDを渡すヘッダー（小文字、REQUESTタイプのみ）
+	ActAsCompanyHeader = "x-act-as-company"
+	// ImpersonateScope はなりすましに必要なスコープ
+	ImpersonateScope = "impersonate"
+
+	ReasonImpersonationNotAllowed = "impersonation_not_allowed"
+	ReasonInvalidActAsCompany     = "invalid_act_as_company"
+
+	AuditEventActAs = "act_as"
+)
+
+// actAsCompanyPattern はなりすまし先として受け付けるテナントIDの形式
+var actAsCompanyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// applyActAs は X-Act-As-Company ヘッダーがある場合に Identity のテナントをなりすまし先に切り替える
+// TOKEN タイプのイベントにはヘッダーがないため、なりすましは REQUEST タイプの Authorizer でのみ使える
+// impersonate スコープのないトークンはDenyし、なりすましは必ず監査ログに記録する（記録できない場合はDeny）
+// 元の呼び出し元は Actor / ActorCompanyID に残り、principalId も元の呼び出し元のまま
+func (a *Authorizer) applyActAs(ctx context.Context, req authRequest, identity *Identity) map[string]interface{} {
+	companyID, ok := req.Headers[ActAsCompanyHeader]
+	if !ok {
+		return nil
+	}
+	if !slices.Contains(identity.Scopes, ImpersonateScope) {
+		log.Printf("[Authorizer] %s sent %s without the %s scope, returning Deny", identity.PrincipalID(), ActAsCompanyHeader, ImpersonateScope)
+		return map[string]interface{}{
+			"reason": ReasonImpersonationNotAllowed,
+		}
+	}
+	if !actAsCompanyPattern.MatchString(companyID) {
+		log.Printf("[Authorizer] Invalid %s header, returning Deny", ActAsCompanyHeader)
+		return map[string]interface{}{
+			"reason": ReasonInvalidActAsCompany,
+		}
+	}
+
+	actor := identity.PrincipalID()
+	if a.Audit == nil {
+		log.Printf("[Authorizer] Audit log is not configured, refusing to act as %s", companyID)
+		return map[string]interface{}{
+			"error": "audit_failed",
+		}
+	}
+	err := a.Audit.Record(ctx, AuditEntry{
+		Subject: "actor#" + actor,
+		Event:   AuditEventActAs,
+		Details: map[string]string{
+			"companyId":      companyID,
+			"actorCompanyId": identity.CompanyID,
+			"methodArn":      req.MethodArn,
+			"sourceIp":       req.SourceIP,
+		},
+	}, a.now())
+	if err != nil {
+		log.Printf("[Authorizer] %v, returning Deny", err)
+		return map[string]interface{}{
+			"error": "audit_failed",
+		}
+	}
+
+	log.Printf("[Authorizer] %s is acting as company %s", actor, companyID)
+	identity.Actor = actor
+	identity.ActorCompanyID = identity.CompanyID
+	identity.CompanyID = companyID
+	return nil
+}
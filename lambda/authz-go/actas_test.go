@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_impersonateスコープのトークンは別テナントとして呼び出せること(t *testing.T) {
+	supportToken := testutil.GenerateUniqueID("support")
+	userID := testutil.GenerateUniqueID("support-engineer")
+	assert.NoError(t, putTestRecord(supportToken, map[string]types.AttributeValue{
+		"companyId": &types.AttributeValueMemberS{Value: "internal"},
+		"userId":    &types.AttributeValueMemberS{Value: userID},
+		"roles":     &types.AttributeValueMemberSS{Value: []string{"support"}},
+	}))
+	defer deleteTestToken(supportToken)
+	userToken := testutil.GenerateUniqueID("user")
+	assert.NoError(t, putTestToken(userToken, true))
+	defer deleteTestToken(userToken)
+
+	roles, err := ParseRoleMapping(defaultRoles)
+	assert.NoError(t, err)
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		Roles:     roles,
+		Audit:     &AuditLog{TableName: TestAuditTableName, DDBClient: testDDBClient},
+	}
+	request := func(token string, headers map[string]string) events.APIGatewayCustomAuthorizerResponse {
+		t.Helper()
+		event := events.APIGatewayCustomAuthorizerRequestTypeRequest{
+			MethodArn: testMethodArn,
+			Headers:   map[string]string{"Authorization": "Bearer " + token},
+		}
+		for k, v := range headers {
+			event.Headers[k] = v
+		}
+		event.RequestContext.Identity.SourceIP = "192.0.2.10"
+		resp, err := auth.RequestHandler(context.Background(), event)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	t.Run("なりすまし先のテナントと元の呼び出し元がcontextに含まれること", func(t *testing.T) {
+		resp := request(supportToken, map[string]string{"X-Act-As-Company": "67890"})
+
+		assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+		assert.Equal(t, userID, resp.PrincipalID)
+		assert.Equal(t, "67890", resp.Context["companyId"])
+		assert.Equal(t, userID, resp.Context["actor"])
+		assert.Equal(t, "internal", resp.Context["actorCompanyId"])
+
+		entries := auditEntries(t, "actor#"+userID)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, AuditEventActAs, entries[0].Event)
+			assert.Equal(t, map[string]string{
+				"companyId":      "67890",
+				"actorCompanyId": "internal",
+				"methodArn":      testMethodArn,
+				"sourceIp":       "192.0.2.10",
+			}, entries[0].Details)
+		}
+	})
+
+	t.Run("ヘッダーがない場合は自分のテナントで呼び出すこと", func(t *testing.T) {
+		resp := request(supportToken, nil)
+
+		assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+		assert.Equal(t, "internal", resp.Context["companyId"])
+		assert.NotContains(t, resp.Context, "actor")
+	})
+
+	t.Run("impersonateスコープのないトークンはDenyになること", func(t *testing.T) {
+		resp := request(userToken, map[string]string{"X-Act-As-Company": "67890"})
+
+		assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+		assert.Equal(t, ReasonImpersonationNotAllowed, resp.Context["reason"])
+	})
+
+	t.Run("不正なテナントIDはDenyになること", func(t *testing.T) {
+		resp := request(supportToken, map[string]string{"X-Act-As-Company": "67890 OR 1=1"})
+
+		assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+		assert.Equal(t, ReasonInvalidActAsCompany, resp.Context["reason"])
+	})
+
+	t.Run("監査ログに記録できない場合はDenyになること", func(t *testing.T) {
+		auth.Audit = &AuditLog{TableName: TestAuditTableName, DDBClient: unreachableDDBClient()}
+		defer func() { auth.Audit = &AuditLog{TableName: TestAuditTableName, DDBClient: testDDBClient} }()
+
+		resp := request(supportToken, map[string]string{"X-Act-As-Company": "67890"})
+
+		assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+		assert.Equal(t, "audit_failed", resp.Context["error"])
+	})
+}
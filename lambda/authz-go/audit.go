@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// DefaultAuditTableName は監査ログのテーブル名
+const DefaultAuditTableName = "AuthzAuditLog"
+
+// 監査ログのイベント
+const (
+	AuditEventLockout = "lockout"
+)
+
+// AuditEntry は監査ログの1件
+// subject（パーティションキー）ごとに id（発生時刻 + 乱数、ソートキー）の順に並ぶ
+type AuditEntry struct {
+	Subject    string            `dynamodbav:"subject" json:"subject"`
+	ID         string            `dynamodbav:"id" json:"id"`
+	Event      string            `dynamodbav:"event" json:"event"`
+	OccurredAt string            `dynamodbav:"occurredAt" json:"occurredAt"`
+	Details    map[string]string `dynamodbav:"details,omitempty" json:"details,omitempty"`
+}
+
+// AuditLog は監査ログを DynamoDB に書き込む
+type AuditLog struct {
+	TableName string
+	DDBClient *dynamodb.Client
+}
+
+// Record は監査ログを書き込む
+// 書き込みの成否に関わらず、同じ内容を CloudWatch Logs にも出力する
+func (l *AuditLog) Record(ctx context.Context, entry AuditEntry, now time.Time) error {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to generate audit entry id: %w", err)
+	}
+	entry.OccurredAt = now.UTC().Format(time.RFC3339Nano)
+	entry.ID = entry.OccurredAt + "#" + hex.EncodeToString(suffix)
+
+	line, _ := json.Marshal(entry)
+	log.Printf("[Authorizer][Audit] %s", line)
+
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	if _, err := l.DDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(l.TableName),
+		Item:      item,
+	}); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
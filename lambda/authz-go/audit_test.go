@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// auditTableSchema は監査ログテーブルのスキーマ（subject + id）を返す
+func auditTableSchema(tableName string) testutil.TableSchema {
+	return testutil.TableSchema{
+		TableName: tableName,
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("subject"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("id"), KeyType: types.KeyTypeRange},
+		},
+		Attributes: []types.AttributeDefinition{
+			{AttributeName: aws.String("subject"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+		},
+	}
+}
+
+// ヘルパー関数: 対象の監査ログを取得
+func auditEntries(t *testing.T, subject string) []AuditEntry {
+	t.Helper()
+	out, err := testDDBClient.Scan(context.Background(), &dynamodb.ScanInput{
+		TableName: aws.String(TestAuditTableName),
+	})
+	assert.NoError(t, err)
+
+	var all, entries []AuditEntry
+	assert.NoError(t, attributevalue.UnmarshalListOfMaps(out.Items, &all))
+	for _, e := range all {
+		if e.Subject == subject {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func Test_監査ログが発生時刻順のidで書き込まれること(t *testing.T) {
+	audit := &AuditLog{TableName: TestAuditTableName, DDBClient: testDDBClient}
+	subject := testutil.GenerateUniqueID("ip#audit")
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, audit.Record(context.Background(), AuditEntry{
+		Subject: subject,
+		Event:   AuditEventLockout,
+		Details: map[string]string{"failures": "10"},
+	}, now))
+
+	entries := auditEntries(t, subject)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, AuditEventLockout, entries[0].Event)
+		assert.Equal(t, "2026-10-19T12:00:00Z", entries[0].OccurredAt)
+		assert.True(t, strings.HasPrefix(entries[0].ID, "2026-10-19T12:00:00Z#"))
+		assert.Equal(t, map[string]string{"failures": "10"}, entries[0].Details)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// API Gateway の authorizer context に関する制約
+//
+// context の値は string / number / boolean のみで、オブジェクトや配列は入れられない
+// （違反すると API Gateway はレスポンスを破棄し、クライアントには 500 が返る）
+// リストは要素をスペース区切りにした文字列として渡す（OAuth 2.0 の scope と同じ形式）
+const (
+	// MaxContextValueBytes は1つの文字列値の上限バイト数
+	// API Gateway の公開された制限ではなく、このリポジトリで決めた上限
+	// 値はマッピングテンプレートでバックエンドへのヘッダー（X-Scope 等）になるため、1つのヘッダーとして無理のない大きさに抑える
+	MaxContextValueBytes = 4096
+	// MaxContextBytes は context 全体（JSON エンコード後）の上限バイト数
+	// こちらも独自の上限で、authorizer のレスポンス全体とヘッダーの合計が API Gateway の上限に近づかないよう余裕を持たせている
+	MaxContextBytes = 8192
+	// ContextListSeparator はリスト値の区切り文字
+	ContextListSeparator = " "
+)
+
+// context のキーはマッピングテンプレートから $context.authorizer.<key> で参照できる識別子に限る
+var contextKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ContextBuilder は API Gateway の制約を満たす authorizer context を組み立てる
+// 制約に違反する値を追加した場合は Build がエラーを返す
+type ContextBuilder struct {
+	values map[string]interface{}
+	errs   []error
+}
+
+// NewContextBuilder は空の ContextBuilder を作成する
+func NewContextBuilder() *ContextBuilder {
+	return &ContextBuilder{values: make(map[string]interface{})}
+}
+
+// String は文字列値を追加する
+func (b *ContextBuilder) String(key, value string) *ContextBuilder {
+	return b.set(key, value)
+}
+
+// StringIfSet は空でない場合のみ文字列値を追加する
+func (b *ContextBuilder) StringIfSet(key, value string) *ContextBuilder {
+	if value == "" {
+		return b
+	}
+	return b.set(key, value)
+}
+
+// Bool は真偽値を追加する
+func (b *ContextBuilder) Bool(key string, value bool) *ContextBuilder {
+	return b.set(key, value)
+}
+
+// Int は整数値を追加する
+func (b *ContextBuilder) Int(key string, value int64) *ContextBuilder {
+	return b.set(key, value)
+}
+
+// List はリストをスペース区切りの文字列として追加する
+// 要素は空でなく、空白を含んではならない
+func (b *ContextBuilder) List(key string, values []string) *ContextBuilder {
+	for _, v := range values {
+		if v == "" || strings.ContainsAny(v, " \t\r\n") {
+			b.errs = append(b.errs, fmt.Errorf("context %q: list element %q must be non-empty and must not contain whitespace", key, v))
+			return b
+		}
+	}
+	return b.set(key, strings.Join(values, ContextListSeparator))
+}
+
+func (b *ContextBuilder) set(key string, value interface{}) *ContextBuilder {
+	if _, ok := b.values[key]; ok {
+		b.errs = append(b.errs, fmt.Errorf("context %q: duplicate key", key))
+		return b
+	}
+	if err := validateContextValue(key, value); err != nil {
+		b.errs = append(b.errs, err)
+		return b
+	}
+	b.values[key] = value
+	return b
+}
+
+// Build は組み立てた context を返す
+func (b *ContextBuilder) Build() (map[string]interface{}, error) {
+	if err := errors.Join(b.errs...); err != nil {
+		return nil, err
+	}
+	if err := validateContextSize(b.values); err != nil {
+		return nil, err
+	}
+	return b.values, nil
+}
+
+// ValidateContext は context が API Gateway の制約を満たしているかを検証する
+func ValidateContext(ctx map[string]interface{}) error {
+	var errs []error
+	for k, v := range ctx {
+		if err := validateContextValue(k, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	return validateContextSize(ctx)
+}
+
+func validateContextValue(key string, value interface{}) error {
+	if !contextKeyPattern.MatchString(key) {
+		return fmt.Errorf("context %q: key must match %s", key, contextKeyPattern)
+	}
+
+	switch v := value.(type) {
+	case string:
+		if len(v) > MaxContextValueBytes {
+			return fmt.Errorf("context %q: value is %d bytes (max %d)", key, len(v), MaxContextValueBytes)
+		}
+	case bool, int, int32, int64:
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("context %q: number must be finite", key)
+		}
+	default:
+		return fmt.Errorf("context %q: unsupported type %T (only string, number and boolean are allowed)", key, value)
+	}
+	return nil
+}
+
+func validateContextSize(ctx map[string]interface{}) error {
+	b, err := json.Marshal(ctx)
+	if err != nil {
+		return fmt.Errorf("context cannot be encoded: %w", err)
+	}
+	if len(b) > MaxContextBytes {
+		return fmt.Errorf("context is %d bytes (max %d)", len(b), MaxContextBytes)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_contextが型ごとに組み立てられること(t *testing.T) {
+	ctx, err := NewContextBuilder().
+		String("companyId", "12345").
+		StringIfSet("clientId", "").
+		List("scope", []string{"read:stores", "write:stores"}).
+		List("roles", nil).
+		Bool("degraded", true).
+		Int("expiresAt", 1_700_000_000).
+		Build()
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"companyId": "12345",
+		"scope":     "read:stores write:stores",
+		"roles":     "",
+		"degraded":  true,
+		"expiresAt": int64(1_700_000_000),
+	}, ctx)
+}
+
+func Test_API_Gatewayの制約に違反するcontextはエラーになること(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(b *ContextBuilder)
+		wantErr string
+	}{
+		{
+			name:    "空白を含むリスト要素",
+			build:   func(b *ContextBuilder) { b.List("scope", []string{"read:stores", "write stores"}) },
+			wantErr: `context "scope": list element "write stores" must be non-empty and must not contain whitespace`,
+		},
+		{
+			name:    "空のリスト要素",
+			build:   func(b *ContextBuilder) { b.List("roles", []string{""}) },
+			wantErr: `context "roles": list element "" must be non-empty`,
+		},
+		{
+			name:    "参照できないキー",
+			build:   func(b *ContextBuilder) { b.String("company-id", "12345") },
+			wantErr: `context "company-id": key must match`,
+		},
+		{
+			name:    "キーの重複",
+			build:   func(b *ContextBuilder) { b.String("scope", "a").String("scope", "b") },
+			wantErr: `context "scope": duplicate key`,
+		},
+		{
+			name:    "長すぎる値",
+			build:   func(b *ContextBuilder) { b.String("token", strings.Repeat("x", MaxContextValueBytes+1)) },
+			wantErr: `context "token": value is 4097 bytes`,
+		},
+		{
+			name: "context全体が大きすぎる",
+			build: func(b *ContextBuilder) {
+				b.String("a", strings.Repeat("x", MaxContextValueBytes)).
+					String("b", strings.Repeat("x", MaxContextValueBytes)).
+					String("c", "x")
+			},
+			wantErr: "context is 8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewContextBuilder()
+			tt.build(b)
+
+			_, err := b.Build()
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_エンコードできない値を含むcontextではポリシーを生成しないこと(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     map[string]interface{}
+		wantErr string
+	}{
+		{"ネストしたオブジェクト", map[string]interface{}{"tenant": map[string]string{"id": "12345"}}, `context "tenant": unsupported type map[string]string`},
+		{"配列", map[string]interface{}{"scopes": []string{"read:stores"}}, `context "scopes": unsupported type []string`},
+		{"nil", map[string]interface{}{"reason": nil}, `context "reason": unsupported type <nil>`},
+		{"有限でない数値", map[string]interface{}{"score": math.NaN()}, `context "score": number must be finite`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := generatePolicy("user", "Allow", testMethodArn, tt.ctx)
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_Allow時のcontextが制約を満たすこと(t *testing.T) {
+	id := &Identity{
+		Token:           "t",
+		CompanyID:       "12345",
+		Scopes:          []string{"read:stores"},
+		Roles:           []string{"store-reader"},
+		RotationPending: true,
+	}
+
+	auth := &Authorizer{InternalToken: testInternalTokenSigner}
+
+	ctx, err := auth.authContext(id)
+
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateContext(ctx))
+	assert.Equal(t, "store-reader", ctx["roles"])
+	assert.Equal(t, true, ctx["token_rotation_pending"])
+	assert.NotEmpty(t, ctx["internalToken"])
+
+	id.Scopes = []string{"read stores"}
+	_, err = auth.authContext(id)
+	assert.Error(t, err)
+}
+
+func Test_内部トークンの発行が設定されていない場合はcontextにinternalTokenを含めないこと(t *testing.T) {
+	id := &Identity{Token: "t", CompanyID: "12345", Scopes: []string{"read:stores"}}
+
+	ctx, err := (&Authorizer{}).authContext(id)
+
+	assert.NoError(t, err)
+	assert.NotContains(t, ctx, "internalToken")
+	assert.Equal(t, "12345", ctx["companyId"])
+}
+
+func Test_なりすまし時の内部トークンになりすまし先のテナントと元の呼び出し元が含まれること(t *testing.T) {
+	id := &Identity{
+		Token:          "t",
+		CompanyID:      "67890",
+		Scopes:         []string{"read:stores", "impersonate"},
+		Actor:          "token:abc",
+		ActorCompanyID: "12345",
+	}
+	now := time.Now()
+	auth := &Authorizer{InternalToken: testInternalTokenSigner, Now: func() time.Time { return now }}
+
+	ctx, err := auth.authContext(id)
+	assert.NoError(t, err)
+
+	claims, err := testInternalTokenVerifier.Verify(ctx["internalToken"].(string), now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "67890", claims.CompanyID)
+		assert.Equal(t, "read:stores impersonate", claims.Scope)
+		assert.Equal(t, "token:abc", claims.Actor)
+		assert.Equal(t, id.PrincipalID(), claims.Subject)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"local-gateway/lambda/tokensync"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// 認証方式の名前（AUTHENTICATOR_CHAIN で指定する）
+const (
+	AuthenticatorOpaque = "opaque"
+	AuthenticatorJWT    = "jwt"
+	AuthenticatorPASETO = "paseto"
+	AuthenticatorHMAC   = "hmac"
+	AuthenticatorMTLS   = "mtls"
+	AuthenticatorAPIKey = "apikey"
+)
+
+// APIKeyHeader は API キー認証でキーを渡すヘッダー（小文字）
+const APIKeyHeader = "x-api-key"
+
+// Credential は認証に使うリクエストの資格情報
+type Credential struct {
+	// Token は Authorization ヘッダー（TOKENタイプでは authorizationToken）から Bearer プレフィックスを除いた値
+	Token string
+	// Authorization は Authorization ヘッダーの値（前後の空白のみ除去）
+	Authorization string
+	// Headers はヘッダー名を小文字に正規化したリクエストヘッダー（TOKENタイプでは空）
+	Headers map[string]string
+	// ClientCert は mTLS のクライアント証明書（mTLS でない場合は nil）
+	ClientCert *events.APIGatewayCustomAuthorizerRequestTypeRequestIdentityClientCert
+	MethodArn  string
+}
+
+// Authenticator は1種類の資格情報を検証する認証方式
+type Authenticator interface {
+	// Name は AUTHENTICATOR_CHAIN で指定する認証方式の名前を返す
+	Name() string
+	// Recognizes は資格情報がこの認証方式で扱う形式かを返す
+	Recognizes(cred *Credential) bool
+	// Authenticate は資格情報を検証し、認証済みの Identity を返す
+	// 検証に失敗した場合は Identity が nil となり、Denyレスポンスに含める context を返す
+	Authenticate(ctx context.Context, cred *Credential) (*Identity, map[string]interface{})
+}
+
+// AuthenticatorChain は順に評価する認証方式の並び
+type AuthenticatorChain []Authenticator
+
+// Authenticate は資格情報を最初に認識した認証方式で検証する
+// 後続の認証方式にはフォールバックしない（どれも認識しない場合は recognized が false）
+func (c AuthenticatorChain) Authenticate(ctx context.Context, cred *Credential) (identity *Identity, denyContext map[string]interface{}, recognized bool) {
+	for _, authn := range c {
+		if !authn.Recognizes(cred) {
+			continue
+		}
+		log.Printf("[Authorizer] Authenticating with %s", authn.Name())
+		identity, denyContext = authn.Authenticate(ctx, cred)
+		return identity, denyContext, true
+	}
+	return nil, nil, false
+}
+
+// authenticators は設定された認証方式を返す（未設定の場合は不透明トークンのみ）
+func (a *Authorizer) authenticators() AuthenticatorChain {
+	if a.Authenticators != nil {
+		return a.Authenticators
+	}
+	return AuthenticatorChain{&OpaqueAuthenticator{Authorizer: a}}
+}
+
+// NewAuthenticatorChainFromEnv は環境変数 AUTHENTICATOR_CHAIN（カンマ区切り）から認証方式を作成する
+// 未設定の場合は opaque のみ。不明な名前や設定の不足はエラーになる
+func NewAuthenticatorChainFromEnv(a *Authorizer) (AuthenticatorChain, error) {
+	names := splitList(os.Getenv("AUTHENTICATOR_CHAIN"))
+	if len(names) == 0 {
+		names = []string{AuthenticatorOpaque}
+	}
+
+	chain := make(AuthenticatorChain, 0, len(names))
+	for _, name := range names {
+		if slices.ContainsFunc(chain, func(authn Authenticator) bool { return authn.Name() == name }) {
+			return nil, fmt.Errorf("duplicate authenticator %q", name)
+		}
+
+		var authn Authenticator
+		switch name {
+		case AuthenticatorOpaque:
+			authn = &OpaqueAuthenticator{Authorizer: a}
+		case AuthenticatorJWT:
+			jwtAuthn, err := NewJWTAuthenticatorFromEnv()
+			if err != nil {
+				return nil, err
+			}
+			authn = jwtAuthn
+		case AuthenticatorPASETO:
+			pasetoAuthn, err := NewPASETOAuthenticatorFromEnv()
+			if err != nil {
+				return nil, err
+			}
+			authn = pasetoAuthn
+		case AuthenticatorHMAC:
+			hmacAuthn, err := NewHMACAuthenticatorFromEnv(a)
+			if err != nil {
+				return nil, err
+			}
+			authn = hmacAuthn
+		case AuthenticatorMTLS:
+			authn = &MTLSAuthenticator{Authorizer: a}
+		case AuthenticatorAPIKey:
+			authn = &APIKeyAuthenticator{Authorizer: a}
+		default:
+			return nil, fmt.Errorf("unknown authenticator %q", name)
+		}
+		chain = append(chain, authn)
+	}
+	return chain, nil
+}
+
+// OpaqueAuthenticator は AllowedTokens テーブルに登録された不透明トークンを検証する
+// 未登録のトークンはイントロスペクションが有効な場合のみ外部認可サーバーに問い合わせる
+type OpaqueAuthenticator struct {
+	Authorizer *Authorizer
+}
+
+func (o *OpaqueAuthenticator) Name() string { return AuthenticatorOpaque }
+
+// Recognizes は空白を含まないトークンを不透明トークンとみなす
+// "HMAC-SHA256 keyId=..." のような Bearer 以外のスキームは扱わない
+func (o *OpaqueAuthenticator) Recognizes(cred *Credential) bool {
+	return cred.Token != "" && !strings.ContainsAny(cred.Token, " \t")
+}
+
+func (o *OpaqueAuthenticator) Authenticate(ctx context.Context, cred *Credential) (*Identity, map[string]interface{}) {
+	a := o.Authorizer
+	if tokensync.IsReserved(cred.Token) {
+		log.Printf("[Authorizer] Reserved token cannot be used, returning Deny")
+		return nil, map[string]interface{}{
+			"reason": "token_not_found",
+		}
+	}
+
+	rec, degraded, denyContext := a.lookupRecord(ctx, cred.Token)
+	if denyContext != nil {
+		return nil, denyContext
+	}
+
+	if rec == nil && a.Introspector != nil {
+		log.Printf("[Authorizer] Token not found in DynamoDB, trying introspection")
+		return a.introspect(ctx, cred.Token)
+	}
+
+	// HMAC の鍵ID・証明書・API キーの項目は、それぞれの資格情報でのみ使える
+	if rec == nil || isCredentialBoundTokenType(rec.TokenType) {
+		log.Printf("[Authorizer] Token not found in DynamoDB, returning Deny")
+		return nil, map[string]interface{}{
+			"reason": "token_not_found",
+		}
+	}
+
+	return a.identityFromActiveRecord(rec, degraded)
+}
+
+// MTLSAuthenticator は mTLS のクライアント証明書のサブジェクトDNで AllowedTokens の項目を検索する
+// 証明書チェーンと有効期限は API Gateway がトラストストアで検証済み
+type MTLSAuthenticator struct {
+	Authorizer *Authorizer
+}
+
+func (m *MTLSAuthenticator) Name() string { return AuthenticatorMTLS }
+
+func (m *MTLSAuthenticator) Recognizes(cred *Credential) bool {
+	return cred.ClientCert != nil && cred.ClientCert.SubjectDN != ""
+}
+
+func (m *MTLSAuthenticator) Authenticate(ctx context.Context, cred *Credential) (*Identity, map[string]interface{}) {
+	return m.Authorizer.authenticateBoundRecord(ctx, cred.ClientCert.SubjectDN, TokenTypeMTLS)
+}
+
+// APIKeyAuthenticator は x-api-key ヘッダーの値で AllowedTokens の項目を検索する
+type APIKeyAuthenticator struct {
+	Authorizer *Authorizer
+}
+
+func (k *APIKeyAuthenticator) Name() string { return AuthenticatorAPIKey }
+
+func (k *APIKeyAuthenticator) Recognizes(cred *Credential) bool {
+	return cred.Headers[APIKeyHeader] != ""
+}
+
+func (k *APIKeyAuthenticator) Authenticate(ctx context.Context, cred *Credential) (*Identity, map[string]interface{}) {
+	return k.Authorizer.authenticateBoundRecord(ctx, cred.Headers[APIKeyHeader], TokenTypeAPIKey)
+}
+
+// authenticateBoundRecord は資格情報に紐づく項目から Identity を作成する
+func (a *Authorizer) authenticateBoundRecord(ctx context.Context, key, tokenType string) (*Identity, map[string]interface{}) {
+	rec, degraded, denyContext := a.lookupBoundRecord(ctx, key, tokenType)
+	if rec == nil {
+		return nil, denyContext
+	}
+	return a.identityFromActiveRecord(rec, degraded)
+}
+
+// lookupBoundRecord は資格情報に紐づく項目を検索する
+// 項目がない場合や tokenType が一致しない場合は TokenRecord が nil となり、Denyレスポンスに含める context を返す
+func (a *Authorizer) lookupBoundRecord(ctx context.Context, key, tokenType string) (*TokenRecord, bool, map[string]interface{}) {
+	if tokensync.IsReserved(key) {
+		log.Printf("[Authorizer] Reserved key cannot be used, returning Deny")
+		return nil, false, map[string]interface{}{
+			"reason": "token_not_found",
+		}
+	}
+
+	rec, degraded, denyContext := a.lookupRecord(ctx, key)
+	if denyContext != nil {
+		return nil, false, denyContext
+	}
+	if rec == nil || rec.TokenType != tokenType {
+		log.Printf("[Authorizer] No %s record found in DynamoDB, returning Deny", tokenType)
+		return nil, false, map[string]interface{}{
+			"reason": "token_not_found",
+		}
+	}
+	return rec, degraded, nil
+}
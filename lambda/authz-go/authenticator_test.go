@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_最初に資格情報を認識した認証方式で検証されること(t *testing.T) {
+	opaqueToken := testutil.GenerateUniqueID("chain-opaque")
+	apiKey := testutil.GenerateUniqueID("chain-apikey")
+	subjectDN := "CN=" + testutil.GenerateUniqueID("chain-client") + ",O=Partner"
+	records := map[string]map[string]types.AttributeValue{
+		opaqueToken: {"clientId": &types.AttributeValueMemberS{Value: "opaque-client"}},
+		apiKey: {
+			"tokenType": &types.AttributeValueMemberS{Value: TokenTypeAPIKey},
+			"clientId":  &types.AttributeValueMemberS{Value: "apikey-client"},
+		},
+		subjectDN: {
+			"tokenType": &types.AttributeValueMemberS{Value: TokenTypeMTLS},
+			"clientId":  &types.AttributeValueMemberS{Value: "mtls-client"},
+		},
+	}
+	for key, attrs := range records {
+		assert.NoError(t, putTestRecord(key, attrs))
+		defer deleteTestToken(key)
+	}
+
+	auth := &Authorizer{TableName: TestTableName, DDBClient: testDDBClient}
+	auth.Authenticators = AuthenticatorChain{
+		&MTLSAuthenticator{Authorizer: auth},
+		&APIKeyAuthenticator{Authorizer: auth},
+		&OpaqueAuthenticator{Authorizer: auth},
+	}
+
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		subjectDN string
+		effect    string
+		principal string
+		reason    interface{}
+	}{
+		{"Bearerトークンは不透明トークンとして検証されること", map[string]string{"Authorization": "Bearer " + opaqueToken}, "", "Allow", "opaque-client", nil},
+		{"x-api-keyヘッダーはAPIキーとして検証されること", map[string]string{"X-Api-Key": apiKey}, "", "Allow", "apikey-client", nil},
+		{"クライアント証明書はmTLSとして検証されること", nil, subjectDN, "Allow", "mtls-client", nil},
+		{"先に認識した認証方式の結果が使われること", map[string]string{"Authorization": "Bearer " + opaqueToken, "X-Api-Key": "unknown"}, "", "Deny", "anonymous", "token_not_found"},
+		{"APIキーの項目は不透明トークンとして使えないこと", map[string]string{"Authorization": "Bearer " + apiKey}, "", "Deny", "anonymous", "token_not_found"},
+		{"どの認証方式も認識しない資格情報はDenyになること", map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}, "", "Deny", "anonymous", "unsupported_credential"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := events.APIGatewayCustomAuthorizerRequestTypeRequest{
+				Type:      "REQUEST",
+				MethodArn: testMethodArn,
+				Headers:   tt.headers,
+			}
+			event.RequestContext.Identity.ClientCert.SubjectDN = tt.subjectDN
+
+			resp, err := auth.RequestHandler(context.Background(), event)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.PolicyDocument.Statement[0].Effect)
+			assert.Equal(t, tt.principal, resp.PrincipalID)
+			assert.Equal(t, tt.reason, resp.Context["reason"])
+		})
+	}
+}
+
+func Test_AUTHENTICATOR_CHAINから認証方式が作成されること(t *testing.T) {
+	tests := []struct {
+		name    string
+		chain   string
+		want    []string
+		wantErr string
+	}{
+		{"未設定の場合はopaqueのみ", "", []string{"opaque"}, ""},
+		{"指定した順に作成されること", "hmac, mtls,apikey,opaque", []string{"hmac", "mtls", "apikey", "opaque"}, ""},
+		{"不明な認証方式", "opaque,saml", nil, `unknown authenticator "saml"`},
+		{"重複した認証方式", "opaque,opaque", nil, `duplicate authenticator "opaque"`},
+		{"設定のないjwt", "jwt,opaque", nil, "JWT_ISSUERS_FILE or JWT_ISSUER is required"},
+		{"公開鍵のないpaseto", "paseto,opaque", nil, "PASETO_PUBLIC_KEYS is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AUTHENTICATOR_CHAIN", tt.chain)
+			t.Setenv("JWT_ISSUER", "")
+			t.Setenv("JWT_ISSUERS_FILE", "")
+			t.Setenv("PASETO_PUBLIC_KEYS", "")
+
+			chain, err := NewAuthenticatorChainFromEnv(&Authorizer{})
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			var names []string
+			for _, authn := range chain {
+				names = append(names, authn.Name())
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/ext"
+)
+
+// CELToken は CEL 条件式から `token` として参照するトークン情報
+type CELToken struct {
+	CompanyID string   `cel:"companyId"`
+	Scopes    []string `cel:"scopes"`
+	TokenType string   `cel:"tokenType"`
+	ClientID  string   `cel:"clientId"`
+}
+
+// CELTenant は CEL 条件式から `tenant` として参照するテナント情報
+type CELTenant struct {
+	ID   string `cel:"id"`
+	Plan string `cel:"plan"`
+}
+
+// CELMethodARN は CEL 条件式から `arn` として参照する methodArn の各要素
+type CELMethodARN struct {
+	Region    string `cel:"region"`
+	AccountID string `cel:"accountId"`
+	APIID     string `cel:"apiId"`
+	Stage     string `cel:"stage"`
+	Method    string `cel:"method"`
+	Path      string `cel:"path"`
+}
+
+// RequestInfo はルール評価に使うリクエスト情報
+type RequestInfo struct {
+	ARN MethodARN
+	// Headers はヘッダー名を小文字に正規化したリクエストヘッダー（TOKENタイプでは空）
+	Headers map[string]string
+	// SourceIP は呼び出し元IP（TOKENタイプでは空）
+	SourceIP string
+	Now      time.Time
+}
+
+// newConditionEnv は条件式の型チェックに使う CEL 環境を作成する
+//
+// 利用できる変数:
+//   - token:    CELToken（companyId, scopes, tokenType, clientId）
+//   - tenant:   CELTenant（id, plan）
+//   - headers:  map(string, string)（ヘッダー名は小文字）
+//   - sourceIp: string
+//   - arn:      CELMethodARN（region, accountId, apiId, stage, method, path）
+//   - now:      timestamp
+func newConditionEnv() (*cel.Env, error) {
+	base, err := cel.NewEnv(
+		ext.NativeTypes(ext.ParseStructTags(true),
+			reflect.TypeOf(CELToken{}), reflect.TypeOf(CELTenant{}), reflect.TypeOf(CELMethodARN{})),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tokenType, err := nativeObjectType(base, CELToken{})
+	if err != nil {
+		return nil, err
+	}
+	tenantType, err := nativeObjectType(base, CELTenant{})
+	if err != nil {
+		return nil, err
+	}
+	arnType, err := nativeObjectType(base, CELMethodARN{})
+	if err != nil {
+		return nil, err
+	}
+
+	return base.Extend(
+		cel.Variable("token", tokenType),
+		cel.Variable("tenant", tenantType),
+		cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("sourceIp", cel.StringType),
+		cel.Variable("arn", arnType),
+		cel.Variable("now", cel.TimestampType),
+	)
+}
+
+// nativeObjectType は ext.NativeTypes で登録した構造体の CEL の型を返す
+// 型名は登録時に ext.NativeTypes が決めるため、環境の型アダプターが変換した値から取得する
+// （パッケージパスから組み立てると、パッケージの移動等で登録名と一致しなくなる）
+func nativeObjectType(env *cel.Env, v interface{}) (*cel.Type, error) {
+	val := env.CELTypeAdapter().NativeToValue(v)
+	if types.IsError(val) {
+		return nil, fmt.Errorf("native type %T is not registered: %v", v, val)
+	}
+	return cel.ObjectType(val.Type().TypeName()), nil
+}
+
+// compileCondition は条件式をコンパイル・型チェックする（結果は bool でなければならない）
+func compileCondition(env *cel.Env, expr string) (cel.Program, error) {
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("invalid condition: %w", iss.Err())
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("condition must evaluate to bool, got %s", ast.OutputType())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build condition program: %w", err)
+	}
+	return prg, nil
+}
+
+// evalCondition は条件式を評価する
+func evalCondition(prg cel.Program, req RequestInfo, id *Identity) (bool, error) {
+	headers := req.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	out, _, err := prg.Eval(map[string]any{
+		"token": &CELToken{
+			CompanyID: id.CompanyID,
+			Scopes:    id.Scopes,
+			TokenType: id.TokenType,
+			ClientID:  id.ClientID,
+		},
+		"tenant": &CELTenant{
+			ID:   id.CompanyID,
+			Plan: id.Plan,
+		},
+		"headers":  headers,
+		"sourceIp": req.SourceIP,
+		"arn": &CELMethodARN{
+			Region:    req.ARN.Region,
+			AccountID: req.ARN.AccountID,
+			APIID:     req.ARN.APIID,
+			Stage:     req.ARN.Stage,
+			Method:    req.ARN.Method,
+			Path:      req.ARN.Path,
+		},
+		"now": req.Now,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition returned %T, expected bool", out.Value())
+	}
+	return result, nil
+}
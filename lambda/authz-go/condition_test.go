@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConditionRulesJSON = `{
+  "version": 1,
+  "defaultEffect": "deny",
+  "rules": [
+    {
+      "id": "stores-write-pro",
+      "methods": ["POST"],
+      "path": "/stores",
+      "requiredScopes": ["write:stores"],
+      "condition": "tenant.plan == 'pro' && now.getDayOfWeek('Asia/Tokyo') >= 1 && now.getDayOfWeek('Asia/Tokyo') <= 5 && now.getHours('Asia/Tokyo') >= 9 && now.getHours('Asia/Tokyo') < 18"
+    },
+    {
+      "id": "internal-only",
+      "methods": ["GET"],
+      "path": "/internal",
+      "condition": "sourceIp.startsWith('10.') && headers['x-client'] == 'batch' && arn.stage == 'test'"
+    },
+    {
+      "id": "broken-at-runtime",
+      "methods": ["GET"],
+      "path": "/broken",
+      "condition": "token.scopes[5] == 'read:stores'"
+    }
+  ]
+}`
+
+func Test_CEL条件式の型エラーは起動時に該当ルールを示すエラーになること(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		wantErr   string
+	}{
+		{"未定義の変数", "user.name == 'x'", "undeclared reference to 'user'"},
+		{"未定義のフィールド", "token.owner == 'x'", "undefined field 'owner'"},
+		{"boolを返さない式", "tenant.plan", "condition must evaluate to bool"},
+		{"構文エラー", "tenant.plan ==", "Syntax error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := `{"version": 1, "defaultEffect": "deny", "rules": [{"id": "cond", "methods": ["GET"], "path": "/a", "condition": "` + tt.condition + `"}]}`
+
+			_, err := ParseRuleSet([]byte(rules))
+
+			assert.ErrorContains(t, err, `rules[0] (id="cond")`)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_CEL条件式で認可判定されること(t *testing.T) {
+	rs := mustParseRuleSet(t, testConditionRulesJSON)
+	jst := time.FixedZone("JST", 9*60*60)
+	// 2024-01-10 は水曜日
+	businessHours := time.Date(2024, 1, 10, 10, 0, 0, 0, jst)
+	night := time.Date(2024, 1, 10, 22, 0, 0, 0, jst)
+	weekend := time.Date(2024, 1, 13, 10, 0, 0, 0, jst)
+
+	pro := &Identity{CompanyID: "12345", Scopes: []string{"write:stores"}, TokenType: TokenTypeOpaque, Plan: "pro"}
+	free := &Identity{CompanyID: "67890", Scopes: []string{"write:stores"}, TokenType: TokenTypeOpaque, Plan: "free"}
+
+	post := MethodARN{Stage: "test", Method: "POST", Path: "/stores"}
+	internal := MethodARN{Stage: "test", Method: "GET", Path: "/internal"}
+
+	tests := []struct {
+		name     string
+		req      RequestInfo
+		identity *Identity
+		want     RuleDecision
+	}{
+		{"proプランの営業時間内はAllowになること", RequestInfo{ARN: post, Now: businessHours}, pro, RuleDecision{Allowed: true, RuleID: "stores-write-pro"}},
+		{"proプランでも営業時間外はDenyになること", RequestInfo{ARN: post, Now: night}, pro, RuleDecision{RuleID: "stores-write-pro", Reason: "condition_not_met"}},
+		{"proプランでも週末はDenyになること", RequestInfo{ARN: post, Now: weekend}, pro, RuleDecision{RuleID: "stores-write-pro", Reason: "condition_not_met"}},
+		{"proプラン以外はDenyになること", RequestInfo{ARN: post, Now: businessHours}, free, RuleDecision{RuleID: "stores-write-pro", Reason: "condition_not_met"}},
+		{
+			"送信元IPとヘッダーが条件を満たせばAllowになること",
+			RequestInfo{ARN: internal, Headers: map[string]string{"x-client": "batch"}, SourceIP: "10.0.0.1", Now: businessHours},
+			pro,
+			RuleDecision{Allowed: true, RuleID: "internal-only"},
+		},
+		{
+			"ヘッダーがない場合はDenyになること",
+			RequestInfo{ARN: internal, SourceIP: "10.0.0.1", Now: businessHours},
+			pro,
+			RuleDecision{RuleID: "internal-only", Reason: "condition_error: no such key: x-client"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rs.Evaluate(tt.req, tt.identity))
+		})
+	}
+}
+
+func Test_CEL条件式の評価エラーはDenyになること(t *testing.T) {
+	rs := mustParseRuleSet(t, testConditionRulesJSON)
+	id := &Identity{CompanyID: "12345", Scopes: []string{"read:stores"}, TokenType: TokenTypeOpaque}
+
+	decision := rs.Evaluate(RequestInfo{ARN: MethodARN{Method: "GET", Path: "/broken"}, Now: time.Now()}, id)
+
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "broken-at-runtime", decision.RuleID)
+	assert.Contains(t, decision.Reason, "condition_error:")
+}
+
+func Test_REQUESTタイプのイベントでヘッダーと送信元IPが条件式に渡されること(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("request")
+	err := putTestRecord(testToken, map[string]types.AttributeValue{
+		"scopes": &types.AttributeValueMemberSS{Value: []string{"read:stores"}},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(testToken)
+
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		Rules:     mustParseRuleSet(t, testConditionRulesJSON),
+	}
+	methodArn, err := testutil.TestMethodArnWithPath("GET", "/internal")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		sourceIP string
+		effect   string
+	}{
+		{"条件を満たす送信元IPはAllowになること", "10.1.2.3", "Allow"},
+		{"条件を満たさない送信元IPはDenyになること", "203.0.113.1", "Deny"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := events.APIGatewayCustomAuthorizerRequestTypeRequest{
+				Type:      "REQUEST",
+				MethodArn: methodArn,
+				Headers: map[string]string{
+					"Authorization": "Bearer " + testToken,
+					"X-Client":      "batch",
+				},
+				RequestContext: events.APIGatewayCustomAuthorizerRequestTypeRequestContext{
+					Identity: events.APIGatewayCustomAuthorizerRequestTypeRequestIdentity{SourceIP: tt.sourceIP},
+				},
+			}
+
+			resp, err := auth.RequestHandler(context.Background(), event)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.PolicyDocument.Statement[0].Effect)
+		})
+	}
+}
+
+func Test_条件式の変数が登録した構造体の型で型チェックされること(t *testing.T) {
+	env, err := newConditionEnv()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		expr  string
+		value interface{}
+	}{
+		{name: "token", expr: "token", value: CELToken{}},
+		{name: "tenant", expr: "tenant", value: CELTenant{}},
+		{name: "arn", expr: "arn", value: CELMethodARN{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, iss := env.Compile(tt.expr)
+			if !assert.NoError(t, iss.Err()) {
+				return
+			}
+
+			// ext.NativeTypes が値を変換するときの型と一致すること
+			want := env.CELTypeAdapter().NativeToValue(tt.value).Type().TypeName()
+			assert.Equal(t, want, ast.OutputType().TypeName())
+		})
+	}
+}
+
+func Test_構造体のフィールドを参照する条件式をコンパイルして評価できること(t *testing.T) {
+	env, err := newConditionEnv()
+	assert.NoError(t, err)
+
+	prg, err := compileCondition(env, "token.companyId == tenant.id && 'read:stores' in token.scopes && arn.method == 'GET'")
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, _, err := prg.Eval(map[string]interface{}{
+		"token":    CELToken{CompanyID: "12345", Scopes: []string{"read:stores"}},
+		"tenant":   CELTenant{ID: "12345"},
+		"headers":  map[string]string{},
+		"sourceIp": "",
+		"arn":      CELMethodARN{Method: "GET"},
+		"now":      time.Now(),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, true, out.Value())
+
+	_, err = compileCondition(env, "token.unknownField == 'x'")
+	assert.Error(t, err)
+}
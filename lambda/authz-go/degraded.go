@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// DefaultRecordCacheMaxStale は DynamoDB 障害時にキャッシュ済みの認証結果を使い続ける上限時間
+	DefaultRecordCacheMaxStale = 5 * time.Minute
+	// DefaultRecordCacheMaxEntries はキャッシュするトークン数の上限
+	DefaultRecordCacheMaxEntries = 10000
+	// DefaultBreakerFailureThreshold はサーキットブレーカーを開く連続失敗回数
+	DefaultBreakerFailureThreshold = 5
+	// DefaultBreakerOpenDuration はサーキットブレーカーを開いたままにする時間
+	DefaultBreakerOpenDuration = 10 * time.Second
+)
+
+// 縮退運転に関するメトリクス名
+const (
+	MetricDegradedDecision   = "DegradedDecision"
+	MetricCircuitBreakerOpen = "CircuitBreakerOpen"
+)
+
+// errCircuitOpen はサーキットブレーカーが開いているため DynamoDB を呼び出さなかったことを示す
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+type recordCacheEntry struct {
+	item       map[string]types.AttributeValue
+	verifiedAt time.Time
+}
+
+// RecordCache は DynamoDB から取得した有効なトークンの項目を保持する
+// TTL 内は DynamoDB を呼ばずに使い、DynamoDB を呼び出せない場合は MaxStale まで使い続ける（縮退運転）
+// 無効（active=false）・未登録のトークンはキャッシュせず、既存のエントリも削除する（障害時もDenyのまま）
+// 有効期限・制限等の検査はキャッシュした項目でも毎回行う
+type RecordCache struct {
+	// TTL は DynamoDB を呼ばずにキャッシュを使う時間（0 の場合は常に DynamoDB を呼ぶ）
+	TTL time.Duration
+	// MaxStale は DynamoDB 障害時にキャッシュを使い続ける上限時間
+	MaxStale time.Duration
+	// MaxEntries はキャッシュするトークン数の上限
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]recordCacheEntry
+}
+
+// NewRecordCacheFromEnv は環境変数から RecordCache を作成する
+// AUTHZ_CACHE_MAX_STALE_SECONDS が 0 の場合は nil を返す（縮退運転無効）
+func NewRecordCacheFromEnv() (*RecordCache, error) {
+	ttl, err := durationFromEnv("AUTHZ_CACHE_TTL_SECONDS", 0)
+	if err != nil {
+		return nil, err
+	}
+	maxStale, err := durationFromEnv("AUTHZ_CACHE_MAX_STALE_SECONDS", DefaultRecordCacheMaxStale)
+	if err != nil {
+		return nil, err
+	}
+	if maxStale == 0 {
+		return nil, nil
+	}
+	if ttl > maxStale {
+		return nil, fmt.Errorf("AUTHZ_CACHE_TTL_SECONDS must not exceed AUTHZ_CACHE_MAX_STALE_SECONDS")
+	}
+
+	return &RecordCache{
+		TTL:        ttl,
+		MaxStale:   maxStale,
+		MaxEntries: DefaultRecordCacheMaxEntries,
+	}, nil
+}
+
+// Put は有効なトークンの項目を記録する
+func (c *RecordCache) Put(token string, item map[string]types.AttributeValue, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]recordCacheEntry)
+	}
+	if _, ok := c.entries[cacheKey(token)]; !ok && len(c.entries) >= c.MaxEntries {
+		c.evict(now)
+	}
+	c.entries[cacheKey(token)] = recordCacheEntry{item: item, verifiedAt: now}
+}
+
+// Delete はトークンのキャッシュを破棄する（拒否されたトークンを縮退運転で許可しないため）
+func (c *RecordCache) Delete(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, cacheKey(token))
+}
+
+// Fresh は TTL 内のキャッシュを返す
+func (c *RecordCache) Fresh(token string, now time.Time) (map[string]types.AttributeValue, bool) {
+	return c.get(token, now, c.TTL)
+}
+
+// Stale は MaxStale 内のキャッシュを返す（DynamoDB を呼び出せない場合に使う）
+func (c *RecordCache) Stale(token string, now time.Time) (map[string]types.AttributeValue, bool) {
+	return c.get(token, now, c.MaxStale)
+}
+
+func (c *RecordCache) get(token string, now time.Time, maxAge time.Duration) (map[string]types.AttributeValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[cacheKey(token)]
+	if !ok || now.Sub(e.verifiedAt) >= maxAge {
+		return nil, false
+	}
+	return e.item, true
+}
+
+// evict は期限切れのエントリを破棄し、それでも上限に達していれば最も古いエントリを破棄する
+func (c *RecordCache) evict(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for k, e := range c.entries {
+		if now.Sub(e.verifiedAt) >= c.MaxStale {
+			delete(c.entries, k)
+			continue
+		}
+		if oldestKey == "" || e.verifiedAt.Before(oldest) {
+			oldestKey, oldest = k, e.verifiedAt
+		}
+	}
+	if len(c.entries) >= c.MaxEntries && oldestKey != "" {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// CircuitBreaker は DynamoDB の連続失敗を検知し、回復するまで呼び出しを止める
+// 開いてから OpenDuration が経過すると試行を1回許可し（half-open）、成功すれば閉じる
+type CircuitBreaker struct {
+	// FailureThreshold はブレーカーを開く連続失敗回数
+	FailureThreshold int
+	// OpenDuration はブレーカーを開いたままにする時間
+	OpenDuration time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// NewCircuitBreakerFromEnv は環境変数から CircuitBreaker を作成する
+// AUTHZ_BREAKER_FAILURE_THRESHOLD が 0 の場合は nil を返す（ブレーカー無効）
+func NewCircuitBreakerFromEnv() (*CircuitBreaker, error) {
+	threshold := DefaultBreakerFailureThreshold
+	if v := os.Getenv("AUTHZ_BREAKER_FAILURE_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid AUTHZ_BREAKER_FAILURE_THRESHOLD: %q", v)
+		}
+		threshold = n
+	}
+	if threshold == 0 {
+		return nil, nil
+	}
+	open, err := durationFromEnv("AUTHZ_BREAKER_OPEN_SECONDS", DefaultBreakerOpenDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CircuitBreaker{
+		FailureThreshold: threshold,
+		OpenDuration:     open,
+	}, nil
+}
+
+// Allow は DynamoDB を呼び出してよいかを返す
+func (b *CircuitBreaker) Allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Before(b.openUntil) {
+		return false
+	}
+	if b.failures >= b.FailureThreshold {
+		// half-open: 次の結果が出るまで他の呼び出しは止める
+		b.openUntil = now.Add(b.OpenDuration)
+	}
+	return true
+}
+
+// Success は呼び出しの成功を記録し、ブレーカーを閉じる
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// Failure は呼び出しの失敗を記録し、ブレーカーを開いた場合は true を返す
+func (b *CircuitBreaker) Failure(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.failures < b.FailureThreshold {
+		return false
+	}
+	b.openUntil = now.Add(b.OpenDuration)
+	return true
+}
+
+// durationFromEnv は秒数の環境変数を読み込む（未設定の場合は def）
+func durationFromEnv(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	sec, err := strconv.Atoi(v)
+	if err != nil || sec < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return time.Duration(sec) * time.Second, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+// unreachableDDBClient は接続できないエンドポイントを向いた DynamoDB クライアントを返す
+func unreachableDDBClient() *dynamodb.Client {
+	return dynamodb.New(testDDBClient.Options(), func(o *dynamodb.Options) {
+		o.BaseEndpoint = aws.String("http://127.0.0.1:1")
+		o.RetryMaxAttempts = 1
+	})
+}
+
+func Test_DynamoDB障害時は直近に許可したトークンを縮退運転で許可すること(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("degraded")
+	assert.NoError(t, putTestToken(testToken, true))
+	defer deleteTestToken(testToken)
+	inactiveToken := testutil.GenerateUniqueID("degraded-inactive")
+	assert.NoError(t, putTestToken(inactiveToken, false))
+	defer deleteTestToken(inactiveToken)
+
+	now := time.Unix(1_700_000_000, 0)
+	metrics := &recordingMetrics{}
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		Cache:     &RecordCache{MaxStale: time.Minute, MaxEntries: DefaultRecordCacheMaxEntries},
+		Metrics:   metrics,
+		Now:       func() time.Time { return now },
+	}
+	methodArn, err := testutil.TestMethodArn()
+	assert.NoError(t, err)
+	request := func(token string) events.APIGatewayCustomAuthorizerResponse {
+		t.Helper()
+		resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+			AuthorizationToken: "Bearer " + token,
+			MethodArn:          methodArn,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+
+	// 正常時に検証したトークンはキャッシュされる
+	resp := request(testToken)
+	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+	assert.NotContains(t, resp.Context, "degraded")
+	request(inactiveToken)
+
+	auth.DDBClient = unreachableDDBClient()
+
+	// 障害時もキャッシュ済みのトークンは縮退運転で許可される
+	now = now.Add(30 * time.Second)
+	resp = request(testToken)
+	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+	assert.Equal(t, true, resp.Context["degraded"])
+	assert.Equal(t, []recordedMetric{{Name: MetricDegradedDecision}}, metrics.records)
+
+	// Denyだったトークンや未知のトークンはDenyのまま
+	resp = request(inactiveToken)
+	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+	resp = request(testutil.GenerateUniqueID("unknown"))
+	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+	assert.Equal(t, "ddb_get_failed", resp.Context["error"])
+
+	// 上限時間を過ぎるとDenyになる
+	now = now.Add(30 * time.Second)
+	resp = request(testToken)
+	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+	assert.Equal(t, "ddb_get_failed", resp.Context["error"])
+}
+
+func Test_無効なトークンの項目はキャッシュせず無効化されたトークンはキャッシュから削除すること(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("degraded")
+	assert.NoError(t, putTestToken(testToken, true))
+	defer deleteTestToken(testToken)
+	inactiveToken := testutil.GenerateUniqueID("degraded-inactive")
+	assert.NoError(t, putTestToken(inactiveToken, false))
+	defer deleteTestToken(inactiveToken)
+
+	now := time.Unix(1_700_000_000, 0)
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		Cache:     &RecordCache{MaxStale: time.Minute, MaxEntries: DefaultRecordCacheMaxEntries},
+		Now:       func() time.Time { return now },
+	}
+
+	_, _, err := auth.getTokenItem(context.Background(), inactiveToken)
+	assert.NoError(t, err)
+	_, cached := auth.Cache.Stale(inactiveToken, now)
+	assert.False(t, cached)
+
+	_, _, err = auth.getTokenItem(context.Background(), testToken)
+	assert.NoError(t, err)
+	_, cached = auth.Cache.Stale(testToken, now)
+	assert.True(t, cached)
+
+	// 有効だったトークンを無効化すると、次の取得でキャッシュから削除される
+	assert.NoError(t, putTestToken(testToken, false))
+	_, _, err = auth.getTokenItem(context.Background(), testToken)
+	assert.NoError(t, err)
+	_, cached = auth.Cache.Stale(testToken, now)
+	assert.False(t, cached)
+}
+
+func Test_サーキットブレーカーが連続失敗で開き時間経過後に再試行すること(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	b := &CircuitBreaker{FailureThreshold: 2, OpenDuration: 10 * time.Second}
+
+	assert.True(t, b.Allow(now))
+	assert.False(t, b.Failure(now))
+	assert.True(t, b.Allow(now))
+	assert.True(t, b.Failure(now), "閾値に達すると開く")
+
+	assert.False(t, b.Allow(now.Add(5*time.Second)), "開いている間は呼び出さない")
+
+	// half-open: 1回だけ試行を許可する
+	halfOpen := now.Add(10 * time.Second)
+	assert.True(t, b.Allow(halfOpen))
+	assert.False(t, b.Allow(halfOpen), "試行の結果が出るまで他の呼び出しは止める")
+	assert.True(t, b.Failure(halfOpen), "試行に失敗すると再び開く")
+
+	b.Success()
+	assert.True(t, b.Allow(halfOpen), "成功すると閉じる")
+}
+
+func Test_サーキットブレーカーが開いている間はDynamoDBを呼び出さないこと(t *testing.T) {
+	metrics := &recordingMetrics{}
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: unreachableDDBClient(),
+		Breaker:   &CircuitBreaker{FailureThreshold: 1, OpenDuration: time.Minute},
+		Metrics:   metrics,
+	}
+
+	_, err := auth.fetchTokenItem(context.Background(), "any")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, errCircuitOpen)
+
+	_, err = auth.fetchTokenItem(context.Background(), "any")
+	assert.ErrorIs(t, err, errCircuitOpen)
+	assert.Equal(t, []recordedMetric{{Name: MetricCircuitBreakerOpen}}, metrics.records)
+}
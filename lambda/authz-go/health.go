@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"local-gateway/lambda/health"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// HealthServiceName はヘルスチェックのレポートに含めるサービス名
+const HealthServiceName = "authz-go"
+
+// healthChecker は依存先（鍵の取得元等）を確認できる認証方式
+type healthChecker interface {
+	healthChecks() []health.Check
+}
+
+// HandleEvent は Lambda のエントリポイント
+// ヘルスチェック・ウォームアップイベントは認可処理を通さずにレポートを返し、それ以外は Invoke で処理する
+func (a *Authorizer) HandleEvent(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	if health.IsEvent(payload) {
+		report := a.HealthCheck(ctx)
+		log.Printf("[Authorizer] Health check: %s", report.Status)
+		return report, nil
+	}
+	return a.Invoke(ctx, payload)
+}
+
+// HealthCheck は使用するテーブル、内部トークンの署名鍵と認証方式の鍵を確認する
+// JWKS は取得してキャッシュするため、ウォームアップ後の最初のリクエストで取得を待たずに済む
+func (a *Authorizer) HealthCheck(ctx context.Context) health.Report {
+	checks := []health.Check{a.tableCheck(a.TableName), a.internalTokenCheck()}
+	if a.Lockout != nil {
+		checks = append(checks, a.tableCheck(a.Lockout.TableName))
+	}
+	if a.Audit != nil {
+		checks = append(checks, a.tableCheck(a.Audit.TableName))
+	}
+	for _, authn := range a.authenticators() {
+		if hc, ok := authn.(healthChecker); ok {
+			checks = append(checks, hc.healthChecks()...)
+		}
+	}
+	return health.Run(ctx, HealthServiceName, checks, a.now())
+}
+
+// tableCheck はテーブルを DescribeTable で確認する（トークン等の項目は読まない）
+func (a *Authorizer) tableCheck(tableName string) health.Check {
+	return health.Check{
+		Name: "dynamodb:" + tableName,
+		Run: func(ctx context.Context) error {
+			_, err := a.DDBClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+				TableName: aws.String(tableName),
+			})
+			return err
+		},
+	}
+}
+
+// internalTokenCheck は内部トークンの署名鍵が設定されていることを確認する
+// 署名鍵がないと Allow しても内部トークンを渡せず、バックエンドがすべてのリクエストを拒否する
+func (a *Authorizer) internalTokenCheck() health.Check {
+	return health.Check{
+		Name: "internal_token:signing_key",
+		Run: func(ctx context.Context) error {
+			if a.InternalToken == nil {
+				return errors.New("INTERNAL_TOKEN_SIGNING_KEY is not set")
+			}
+			return nil
+		},
+	}
+}
+
+func (j *JWTAuthenticator) healthChecks() []health.Check {
+	checks := make([]health.Check, 0, len(j.Issuers))
+	for _, issuer := range j.Issuers {
+		checks = append(checks, health.Check{
+			Name: "jwks:" + issuer.Issuer,
+			Run:  issuer.JWKS.Warm,
+		})
+	}
+	return checks
+}
+
+func (p *PASETOAuthenticator) healthChecks() []health.Check {
+	return []health.Check{{
+		Name: "paseto:public_keys",
+		Run: func(ctx context.Context) error {
+			if len(p.Keys) == 0 {
+				return errors.New("no public keys configured")
+			}
+			return nil
+		},
+	}}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"testing"
+	"time"
+
+	"local-gateway/lambda/health"
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ヘルスチェックイベントで依存先のレポートが返ること(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	srv := newJWKSServer(t, map[string]*rsa.PublicKey{"key-1": &key.PublicKey})
+	issuer, err := NewJWTIssuer(JWTIssuerConfig{Issuer: testJWTIssuer, JWKSURI: srv.URL}, nil, time.Hour, time.Minute)
+	assert.NoError(t, err)
+
+	auth := &Authorizer{
+		TableName:     TestTableName,
+		DDBClient:     testDDBClient,
+		Lockout:       newTestLockoutGuard(10),
+		Audit:         &AuditLog{TableName: TestAuditTableName, DDBClient: testDDBClient},
+		InternalToken: testInternalTokenSigner,
+		Authenticators: AuthenticatorChain{
+			&JWTAuthenticator{Issuers: []*JWTIssuer{issuer}},
+			NewPASETOAuthenticator(nil, "", ""),
+			&OpaqueAuthenticator{},
+		},
+		Now: func() time.Time { return time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC) },
+	}
+
+	resp, err := auth.HandleEvent(context.Background(), []byte(`{"type":"HEALTH_CHECK"}`))
+
+	assert.NoError(t, err)
+	report, ok := resp.(health.Report)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, HealthServiceName, report.Service)
+	assert.Equal(t, health.StatusFail, report.Status)
+	assert.Equal(t, "2026-10-19T12:00:00Z", report.CheckedAt)
+
+	statuses := map[string]string{}
+	for _, c := range report.Checks {
+		statuses[c.Name] = c.Status
+	}
+	assert.Equal(t, map[string]string{
+		"dynamodb:" + TestTableName:        health.StatusOK,
+		"dynamodb:" + TestLockoutTableName: health.StatusOK,
+		"dynamodb:" + TestAuditTableName:   health.StatusOK,
+		"internal_token:signing_key":       health.StatusOK,
+		"jwks:" + testJWTIssuer:            health.StatusOK,
+		"paseto:public_keys":               health.StatusFail,
+	}, statuses)
+
+	// ウォームアップで取得した鍵はキャッシュされる
+	_, err = issuer.JWKS.Key(context.Background(), "key-1")
+	assert.NoError(t, err)
+}
+
+func Test_DynamoDBに接続できない場合はfailになること(t *testing.T) {
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: unreachableDDBClient(),
+	}
+
+	resp, err := auth.HandleEvent(context.Background(), []byte(`{"source":"aws.events","detail-type":"Scheduled Event"}`))
+
+	assert.NoError(t, err)
+	report := resp.(health.Report)
+	assert.Equal(t, health.StatusFail, report.Status)
+	if assert.Len(t, report.Checks, 2) {
+		assert.Equal(t, "dynamodb:"+TestTableName, report.Checks[0].Name)
+		assert.NotEmpty(t, report.Checks[0].Error)
+	}
+}
+
+func Test_内部トークンの署名鍵が設定されていない場合はfailになること(t *testing.T) {
+	tests := []struct {
+		name          string
+		internalToken bool
+		wantStatus    string
+	}{
+		{"署名鍵あり", true, health.StatusOK},
+		{"署名鍵なし", false, health.StatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &Authorizer{TableName: TestTableName, DDBClient: testDDBClient}
+			if tt.internalToken {
+				auth.InternalToken = testInternalTokenSigner
+			}
+
+			report := auth.HealthCheck(context.Background())
+
+			assert.Equal(t, tt.wantStatus, report.Status)
+			if assert.Len(t, report.Checks, 2) {
+				assert.Equal(t, "internal_token:signing_key", report.Checks[1].Name)
+				assert.Equal(t, tt.wantStatus, report.Checks[1].Status)
+			}
+		})
+	}
+}
+
+func Test_ヘルスチェック以外のイベントは認可処理されること(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("handle-event")
+	assert.NoError(t, putTestToken(testToken, true))
+	defer deleteTestToken(testToken)
+
+	resp, err := testAuthorizer.HandleEvent(context.Background(), []byte(fmt.Sprintf(`{"type":"TOKEN","authorizationToken":"Bearer %s","methodArn":%q}`, testToken, testMethodArn)))
+
+	assert.NoError(t, err)
+	policy, ok := resp.(events.APIGatewayCustomAuthorizerResponse)
+	if assert.True(t, ok) {
+		assert.Equal(t, "Allow", policy.PolicyDocument.Statement[0].Effect)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HMACScheme は HMAC 署名を渡す Authorization ヘッダーのスキーム
+	// 例: Authorization: HMAC-SHA256 keyId=partner-1,timestamp=1700000000,signature=<hex>
+	HMACScheme = "HMAC-SHA256"
+	// DefaultHMACMaxSkew は署名の timestamp と現在時刻のずれの許容範囲
+	DefaultHMACMaxSkew = 5 * time.Minute
+)
+
+// HMACAuthenticator は共有鍵による HMAC-SHA256 署名を検証する
+// 鍵は AllowedTokens テーブルの tokenType=hmac の項目（token が鍵ID、secret が共有鍵）
+// 署名対象は "<timestamp>\n<HTTPメソッド>\n<リソースパス>"（methodArn から取得）
+type HMACAuthenticator struct {
+	Authorizer *Authorizer
+	// MaxSkew は timestamp と現在時刻のずれの許容範囲（リプレイ対策）
+	MaxSkew time.Duration
+}
+
+// NewHMACAuthenticatorFromEnv は環境変数 HMAC_MAX_SKEW_SECONDS（デフォルト300秒）から HMACAuthenticator を作成する
+func NewHMACAuthenticatorFromEnv(a *Authorizer) (*HMACAuthenticator, error) {
+	skew, err := durationFromEnv("HMAC_MAX_SKEW_SECONDS", DefaultHMACMaxSkew)
+	if err != nil {
+		return nil, err
+	}
+	return &HMACAuthenticator{Authorizer: a, MaxSkew: skew}, nil
+}
+
+func (h *HMACAuthenticator) Name() string { return AuthenticatorHMAC }
+
+func (h *HMACAuthenticator) Recognizes(cred *Credential) bool {
+	return strings.HasPrefix(cred.Authorization, HMACScheme+" ")
+}
+
+func (h *HMACAuthenticator) Authenticate(ctx context.Context, cred *Credential) (*Identity, map[string]interface{}) {
+	a := h.Authorizer
+	sig, err := parseHMACAuthorization(cred.Authorization)
+	if err != nil {
+		log.Printf("[Authorizer] Invalid HMAC authorization: %v, returning Deny", err)
+		return nil, map[string]interface{}{
+			"reason": "invalid_signature",
+		}
+	}
+
+	skew := a.now().Sub(time.Unix(sig.Timestamp, 0))
+	if skew < -h.MaxSkew || skew > h.MaxSkew {
+		log.Printf("[Authorizer] HMAC timestamp is off by %s, returning Deny", skew)
+		return nil, map[string]interface{}{
+			"reason": "signature_expired",
+		}
+	}
+
+	arn, err := ParseMethodARN(cred.MethodArn)
+	if err != nil {
+		log.Printf("[Authorizer] %v, returning Deny", err)
+		return nil, map[string]interface{}{
+			"reason": "invalid_method_arn",
+		}
+	}
+
+	rec, degraded, denyContext := a.lookupBoundRecord(ctx, sig.KeyID, TokenTypeHMAC)
+	if rec == nil {
+		return nil, denyContext
+	}
+
+	expected := signHMAC(rec.Secret, sig.Timestamp, arn.Method, arn.Path)
+	if rec.Secret == "" || !hmac.Equal([]byte(expected), []byte(sig.Signature)) {
+		log.Printf("[Authorizer] HMAC signature mismatch, returning Deny")
+		return nil, map[string]interface{}{
+			"reason": "invalid_signature",
+		}
+	}
+	return a.identityFromActiveRecord(rec, degraded)
+}
+
+// hmacAuthorization は HMAC-SHA256 スキームの Authorization ヘッダーのパラメータ
+type hmacAuthorization struct {
+	KeyID     string
+	Timestamp int64
+	Signature string
+}
+
+// parseHMACAuthorization は "HMAC-SHA256 keyId=...,timestamp=...,signature=..." を分解する
+func parseHMACAuthorization(header string) (hmacAuthorization, error) {
+	params, ok := strings.CutPrefix(header, HMACScheme+" ")
+	if !ok {
+		return hmacAuthorization{}, fmt.Errorf("scheme must be %s", HMACScheme)
+	}
+
+	var sig hmacAuthorization
+	var timestamp string
+	for _, p := range strings.Split(params, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok {
+			return hmacAuthorization{}, fmt.Errorf("malformed parameter %q", p)
+		}
+		switch k {
+		case "keyId":
+			sig.KeyID = v
+		case "timestamp":
+			timestamp = v
+		case "signature":
+			sig.Signature = strings.ToLower(v)
+		}
+	}
+	if sig.KeyID == "" || timestamp == "" || sig.Signature == "" {
+		return hmacAuthorization{}, fmt.Errorf("keyId, timestamp and signature are required")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return hmacAuthorization{}, fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	sig.Timestamp = ts
+	return sig, nil
+}
+
+// signHMAC は署名対象の文字列の HMAC-SHA256 を16進数で返す
+func signHMAC(secret string, timestamp int64, method, path string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s\n%s", timestamp, method, path)
+	return hex.EncodeToString(mac.Sum(nil))
+}
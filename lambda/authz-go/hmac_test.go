@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HMAC署名が検証されること(t *testing.T) {
+	keyID := testutil.GenerateUniqueID("hmac")
+	err := putTestRecord(keyID, map[string]types.AttributeValue{
+		"tokenType": &types.AttributeValueMemberS{Value: TokenTypeHMAC},
+		"secret":    &types.AttributeValueMemberS{Value: "s3cret"},
+		"clientId":  &types.AttributeValueMemberS{Value: "partner-1"},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(keyID)
+
+	now := time.Unix(1_700_000_000, 0)
+	arn, err := ParseMethodARN(testMethodArn)
+	assert.NoError(t, err)
+	authorization := func(keyID string, ts time.Time, secret string) string {
+		return fmt.Sprintf("HMAC-SHA256 keyId=%s,timestamp=%d,signature=%s", keyID, ts.Unix(), signHMAC(secret, ts.Unix(), arn.Method, arn.Path))
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		effect        string
+		reason        interface{}
+	}{
+		{"正しい署名はAllowになること", authorization(keyID, now, "s3cret"), "Allow", nil},
+		{"許容範囲内のずれはAllowになること", authorization(keyID, now.Add(-4*time.Minute), "s3cret"), "Allow", nil},
+		{"異なる鍵の署名はDenyになること", authorization(keyID, now, "wrong"), "Deny", "invalid_signature"},
+		{"古い署名はDenyになること", authorization(keyID, now.Add(-10*time.Minute), "s3cret"), "Deny", "signature_expired"},
+		{"未登録の鍵IDはDenyになること", authorization("unknown-key", now, "s3cret"), "Deny", "token_not_found"},
+		{"パラメータが不足している場合はDenyになること", "HMAC-SHA256 keyId=" + keyID, "Deny", "invalid_signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &Authorizer{
+				TableName: TestTableName,
+				DDBClient: testDDBClient,
+				Now:       func() time.Time { return now },
+			}
+			auth.Authenticators = AuthenticatorChain{
+				&HMACAuthenticator{Authorizer: auth, MaxSkew: DefaultHMACMaxSkew},
+				&OpaqueAuthenticator{Authorizer: auth},
+			}
+
+			resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+				AuthorizationToken: tt.authorization,
+				MethodArn:          testMethodArn,
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.PolicyDocument.Statement[0].Effect)
+			assert.Equal(t, tt.reason, resp.Context["reason"])
+			if tt.effect == "Allow" {
+				assert.Equal(t, "partner-1", resp.PrincipalID)
+			}
+		})
+	}
+}
+
+func Test_HMACのAuthorizationヘッダーが分解されること(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    hmacAuthorization
+		wantErr string
+	}{
+		{"HMAC-SHA256 keyId=k1, timestamp=1700000000, signature=ABCD", hmacAuthorization{KeyID: "k1", Timestamp: 1_700_000_000, Signature: "abcd"}, ""},
+		{"HMAC-SHA256 keyId=k1,signature=abcd", hmacAuthorization{}, "keyId, timestamp and signature are required"},
+		{"HMAC-SHA256 keyId=k1,timestamp=soon,signature=abcd", hmacAuthorization{}, `invalid timestamp "soon"`},
+		{"HMAC-SHA256 keyId", hmacAuthorization{}, `malformed parameter "keyId"`},
+		{"Bearer abc", hmacAuthorization{}, "scheme must be HMAC-SHA256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, err := parseHMACAuthorization(tt.header)
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// トークン種別
+const (
+	TokenTypeOpaque        = "opaque"
+	TokenTypeIntrospection = "introspection"
+	TokenTypeJWT           = "jwt"
+	TokenTypePASETO        = "paseto"
+	// 以下はトークンではなく資格情報に紐づく項目（不透明トークンとしては使えない）
+	TokenTypeHMAC   = "hmac"
+	TokenTypeMTLS   = "mtls"
+	TokenTypeAPIKey = "apikey"
+)
+
+// tokenTypes は認可ルールの tokenTypes に指定できるトークン種別
+var tokenTypes = []string{TokenTypeOpaque, TokenTypeIntrospection, TokenTypeJWT, TokenTypePASETO, TokenTypeHMAC, TokenTypeMTLS, TokenTypeAPIKey}
+
+// isCredentialBoundTokenType は項目が HMAC の鍵・クライアント証明書・API キーのものかを返す
+func isCredentialBoundTokenType(t string) bool {
+	return t == TokenTypeHMAC || t == TokenTypeMTLS || t == TokenTypeAPIKey
+}
+
+// 属性が未設定の既存トークン（シードデータの allow 等）に適用するデフォルト値
+const (
+	defaultCompanyID = "12345"
+	defaultScope     = "read:stores"
+)
+
+// TokenRecord は AllowedTokens テーブルのアイテム
+type TokenRecord struct {
+	Token string `dynamodbav:"token"`
+	// Active は未設定（nil）の場合は有効として扱う
+	Active    *bool    `dynamodbav:"active"`
+	CompanyID string   `dynamodbav:"companyId"`
+	Scopes    []string `dynamodbav:"scopes"`
+	TokenType string   `dynamodbav:"tokenType"`
+	// Plan はテナントの契約プラン（テナント情報をトークンに非正規化して保持）
+	Plan string `dynamodbav:"plan"`
+	// ClientID / UserID はトークンの発行先（principalId に使う）
+	ClientID string `dynamodbav:"clientId"`
+	UserID   string `dynamodbav:"userId"`
+	// Roles はロール名（roles.json の定義に従ってスコープに展開される）
+	Roles []string `dynamodbav:"roles"`
+	// APIKey はテナントの usage plan に紐づく API Gateway の API キー
+	// API Gateway は usageIdentifierKey をキーの値で照合するため、キーID ではなく値を保持する
+	APIKey string `dynamodbav:"apiKey"`
+	// Stages / APIIDs はトークンを使用できるステージと API ID（未設定の場合は制限しない）
+	Stages []string `dynamodbav:"stages"`
+	APIIDs []string `dynamodbav:"apiIds"`
+	// AccessWindows はトークンを使用できる時間帯（いずれかに含まれれば可、未設定の場合は制限しない）
+	AccessWindows []AccessWindow `dynamodbav:"accessWindows"`
+	// ReplacedBy はローテーション後の新しいトークン（ローテーション済みの場合のみ）
+	ReplacedBy string `dynamodbav:"replacedBy"`
+	// GraceExpiresAt はローテーション後も旧トークンを受け付ける期限（Unix秒）
+	GraceExpiresAt int64 `dynamodbav:"graceExpiresAt"`
+	// RotatedFrom はこのトークンの発行元となった旧トークン
+	RotatedFrom string `dynamodbav:"rotatedFrom"`
+	// Secret は HMAC 署名の共有鍵（tokenType が hmac の項目のみ）
+	Secret string `dynamodbav:"secret"`
+}
+
+// parseTokenRecord は DynamoDB のアイテムを TokenRecord に変換する
+func parseTokenRecord(item map[string]types.AttributeValue) (*TokenRecord, error) {
+	var rec TokenRecord
+	if err := attributevalue.UnmarshalMap(item, &rec); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token record: %w", err)
+	}
+	return &rec, nil
+}
+
+// IsActive はトークンが有効かどうかを返す
+func (r *TokenRecord) IsActive() bool {
+	return r.Active == nil || *r.Active
+}
+
+// Identity は認証済みの呼び出し元を表す
+// トークンの種類（DynamoDB / イントロスペクション）によらず、認可判定とcontext生成はこれを使う
+type Identity struct {
+	Token     string
+	CompanyID string
+	Scopes    []string
+	TokenType string
+	ClientID  string
+	UserID    string
+	Plan      string
+	// Roles はトークンに付与されたロール（Scopes には展開済みのスコープが含まれる）
+	Roles []string
+	// APIKey は usage plan による計測・スロットリングに使う API キー（usageIdentifierKey）
+	APIKey string
+	// Stages / APIIDs はトークンを使用できるステージと API ID（空の場合は制限しない）
+	Stages []string
+	APIIDs []string
+	// AccessWindows はトークンを使用できる時間帯（空の場合は制限しない）
+	AccessWindows []AccessWindow
+	// Claims は JWT のクレームから対応付けた追加の context（キーは context のキー）
+	Claims map[string]string
+	// Actor / ActorCompanyID は X-Act-As-Company でなりすました場合の元の呼び出し元とテナント
+	Actor          string
+	ActorCompanyID string
+	// RotationPending はローテーション済みの旧トークンを猶予期間中に使用していることを示す
+	RotationPending bool
+	// Degraded は DynamoDB 障害時にキャッシュ済みのトークン項目で認証したことを示す
+	Degraded bool
+}
+
+// identityFromRecord は DynamoDB のトークンレコードから Identity を作成する
+func identityFromRecord(rec *TokenRecord) *Identity {
+	id := &Identity{
+		Token:     rec.Token,
+		CompanyID: rec.CompanyID,
+		Scopes:    rec.Scopes,
+		TokenType: rec.TokenType,
+		ClientID:  rec.ClientID,
+		UserID:    rec.UserID,
+		Plan:      rec.Plan,
+		Roles:     rec.Roles,
+		APIKey:    rec.APIKey,
+		Stages:    rec.Stages,
+		APIIDs:    rec.APIIDs,
+
+		AccessWindows: rec.AccessWindows,
+	}
+	if id.CompanyID == "" {
+		id.CompanyID = defaultCompanyID
+	}
+	if len(id.Scopes) == 0 && len(id.Roles) == 0 {
+		id.Scopes = []string{defaultScope}
+	}
+	if id.TokenType == "" {
+		id.TokenType = TokenTypeOpaque
+	}
+	return id
+}
+
+// identityFromIntrospection はイントロスペクション結果から Identity を作成する
+func identityFromIntrospection(token string, result *IntrospectionResult) *Identity {
+	return &Identity{
+		Token:     token,
+		Scopes:    strings.Fields(result.Scope),
+		TokenType: TokenTypeIntrospection,
+		ClientID:  result.ClientID,
+		UserID:    cmp.Or(result.Username, result.Sub),
+	}
+}
+
+// PrincipalID は API Gateway の principalId に使う呼び出し元の識別子を返す
+// userId、clientId の順に使い、どちらもない場合はトークンのハッシュから作る（トークン自体は出さない）
+func (id *Identity) PrincipalID() string {
+	if id.UserID != "" {
+		return id.UserID
+	}
+	if id.ClientID != "" {
+		return id.ClientID
+	}
+	return "token:" + cacheKey(id.Token)[:16]
+}
+
+// addScopes はスコープを重複なく追加する
+func (id *Identity) addScopes(scopes []string) {
+	for _, s := range scopes {
+		if !slices.Contains(id.Scopes, s) {
+			id.Scopes = append(id.Scopes, s)
+		}
+	}
+}
+
+// Scope は API Gateway の context に渡すスペース区切りのスコープ文字列を返す
+func (id *Identity) Scope() string {
+	return strings.Join(id.Scopes, " ")
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultIntrospectionCacheTTL はイントロスペクション結果をキャッシュする上限時間
+const DefaultIntrospectionCacheTTL = 5 * time.Minute
+
+// IntrospectionResult は RFC 7662 のイントロスペクションレスポンス
+type IntrospectionResult struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Nbf       int64  `json:"nbf,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+}
+
+type introspectionCacheEntry struct {
+	result    IntrospectionResult
+	expiresAt time.Time
+}
+
+// IntrospectionValidator は外部認可サーバーが発行した不透明トークンを
+// イントロスペクションエンドポイント（RFC 7662）に問い合わせて検証する
+type IntrospectionValidator struct {
+	Endpoint     string
+	ClientID     string
+	ClientSecret string
+	HTTPClient   *http.Client
+	// RequiredScopes はAllowに必要なスコープ（空の場合は検査しない）
+	RequiredScopes []string
+	// AllowedClientIDs は許可する client_id（空の場合は検査しない）
+	AllowedClientIDs []string
+	// MaxCacheTTL はキャッシュの上限時間（トークンの残り有効期間の方が短ければそちらを使う）
+	MaxCacheTTL time.Duration
+	// Now は現在時刻を返す（テスト用に差し替え可能）
+	Now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]introspectionCacheEntry
+}
+
+// NewIntrospectionValidatorFromEnv は環境変数からIntrospectionValidatorを作成する
+// INTROSPECTION_ENDPOINT が未設定の場合は nil を返す（イントロスペクション無効）
+func NewIntrospectionValidatorFromEnv() (*IntrospectionValidator, error) {
+	endpoint := os.Getenv("INTROSPECTION_ENDPOINT")
+	if endpoint == "" {
+		return nil, nil
+	}
+
+	ttl := DefaultIntrospectionCacheTTL
+	if v := os.Getenv("INTROSPECTION_CACHE_TTL_SECONDS"); v != "" {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec < 0 {
+			return nil, fmt.Errorf("invalid INTROSPECTION_CACHE_TTL_SECONDS: %q", v)
+		}
+		ttl = time.Duration(sec) * time.Second
+	}
+
+	return &IntrospectionValidator{
+		Endpoint:         endpoint,
+		ClientID:         os.Getenv("INTROSPECTION_CLIENT_ID"),
+		ClientSecret:     os.Getenv("INTROSPECTION_CLIENT_SECRET"),
+		HTTPClient:       &http.Client{Timeout: 3 * time.Second},
+		RequiredScopes:   splitList(os.Getenv("INTROSPECTION_REQUIRED_SCOPES")),
+		AllowedClientIDs: splitList(os.Getenv("INTROSPECTION_ALLOWED_CLIENT_IDS")),
+		MaxCacheTTL:      ttl,
+	}, nil
+}
+
+// Validate はトークンをイントロスペクションし、結果とDeny理由を返す
+// reason が空文字の場合はトークンが有効であることを示す
+func (v *IntrospectionValidator) Validate(ctx context.Context, token string) (*IntrospectionResult, string, error) {
+	now := v.now()
+	key := cacheKey(token)
+
+	if result, ok := v.cached(key, now); ok {
+		return result, v.check(result, now), nil
+	}
+
+	result, err := v.introspect(ctx, token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	reason := v.check(result, now)
+	if reason == "" {
+		v.store(key, result, now)
+	}
+	return result, reason, nil
+}
+
+func (v *IntrospectionValidator) introspect(ctx context.Context, token string) (*IntrospectionResult, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.ClientID), url.QueryEscape(v.ClientSecret))
+	}
+
+	client := v.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspection request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned status %d", resp.StatusCode)
+	}
+
+	var result IntrospectionResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+	return &result, nil
+}
+
+// check はイントロスペクション結果を検証し、Deny理由を返す（有効な場合は空文字）
+func (v *IntrospectionValidator) check(result *IntrospectionResult, now time.Time) string {
+	if !result.Active {
+		return "token_inactive"
+	}
+	if result.Exp != 0 && !now.Before(time.Unix(result.Exp, 0)) {
+		return "token_expired"
+	}
+	if result.Nbf != 0 && now.Before(time.Unix(result.Nbf, 0)) {
+		return "token_not_yet_valid"
+	}
+	if len(v.AllowedClientIDs) > 0 && !slices.Contains(v.AllowedClientIDs, result.ClientID) {
+		return "client_not_allowed"
+	}
+	granted := strings.Fields(result.Scope)
+	for _, s := range v.RequiredScopes {
+		if !slices.Contains(granted, s) {
+			return "insufficient_scope"
+		}
+	}
+	return ""
+}
+
+func (v *IntrospectionValidator) cached(key string, now time.Time) (*IntrospectionResult, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	entry, ok := v.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expiresAt) {
+		delete(v.cache, key)
+		return nil, false
+	}
+	result := entry.result
+	return &result, true
+}
+
+// store は有効な結果をキャッシュする
+// キャッシュ期間は MaxCacheTTL とトークンの残り有効期間のうち短い方
+func (v *IntrospectionValidator) store(key string, result *IntrospectionResult, now time.Time) {
+	ttl := v.MaxCacheTTL
+	if result.Exp != 0 {
+		if remaining := time.Unix(result.Exp, 0).Sub(now); remaining < ttl {
+			ttl = remaining
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.cache == nil {
+		v.cache = make(map[string]introspectionCacheEntry)
+	}
+	v.cache[key] = introspectionCacheEntry{result: *result, expiresAt: now.Add(ttl)}
+}
+
+func (v *IntrospectionValidator) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
+
+// cacheKey はトークンそのものをメモリに保持しないようハッシュ化したキーを返す
+func cacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitList はカンマ区切りの文字列をスライスに変換する（空要素は除外）
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeIntrospectionServer は RFC 7662 のイントロスペクションエンドポイントを模したテスト用サーバー
+type fakeIntrospectionServer struct {
+	*httptest.Server
+	tokens map[string]IntrospectionResult
+	calls  atomic.Int32
+}
+
+func newFakeIntrospectionServer(t *testing.T, clientID, clientSecret string, tokens map[string]IntrospectionResult) *fakeIntrospectionServer {
+	f := &fakeIntrospectionServer{tokens: tokens}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.calls.Add(1)
+
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != clientID || secret != clientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// 未知のトークンは active=false のみを返す（RFC 7662 2.2）
+		result, ok := f.tokens[r.PostForm.Get("token")]
+		if !ok {
+			result = IntrospectionResult{Active: false}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func newTestIntrospector(endpoint string, now time.Time) *IntrospectionValidator {
+	return &IntrospectionValidator{
+		Endpoint:     endpoint,
+		ClientID:     "authz-go",
+		ClientSecret: "s3cret",
+		MaxCacheTTL:  DefaultIntrospectionCacheTTL,
+		Now:          func() time.Time { return now },
+	}
+}
+
+func Test_イントロスペクション結果に応じて検証されること(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	server := newFakeIntrospectionServer(t, "authz-go", "s3cret", map[string]IntrospectionResult{
+		"active":      {Active: true, Scope: "read:stores write:stores", ClientID: "partner-a", Exp: now.Add(time.Hour).Unix()},
+		"expired":     {Active: true, Scope: "read:stores", ClientID: "partner-a", Exp: now.Add(-time.Second).Unix()},
+		"other":       {Active: true, Scope: "read:stores", ClientID: "partner-b", Exp: now.Add(time.Hour).Unix()},
+		"narrowscope": {Active: true, Scope: "write:stores", ClientID: "partner-a", Exp: now.Add(time.Hour).Unix()},
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		reason string
+	}{
+		{"アクティブなトークンは有効と判定されること", "active", ""},
+		{"active=falseのトークンは拒否されること", "unknown", "token_inactive"},
+		{"有効期限切れのトークンは拒否されること", "expired", "token_expired"},
+		{"許可されていないclient_idは拒否されること", "other", "client_not_allowed"},
+		{"必要なスコープがない場合は拒否されること", "narrowscope", "insufficient_scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestIntrospector(server.URL, now)
+			v.RequiredScopes = []string{"read:stores"}
+			v.AllowedClientIDs = []string{"partner-a"}
+
+			_, reason, err := v.Validate(context.Background(), tt.token)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+func Test_クライアント認証に失敗した場合はエラーを返すこと(t *testing.T) {
+	server := newFakeIntrospectionServer(t, "authz-go", "s3cret", nil)
+	v := newTestIntrospector(server.URL, time.Now())
+	v.ClientSecret = "wrong"
+
+	_, _, err := v.Validate(context.Background(), "active")
+
+	assert.Error(t, err)
+}
+
+func Test_イントロスペクション結果はトークンの残り有効期間までキャッシュされること(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	server := newFakeIntrospectionServer(t, "authz-go", "s3cret", map[string]IntrospectionResult{
+		"short": {Active: true, Exp: now.Add(30 * time.Second).Unix()},
+	})
+	v := newTestIntrospector(server.URL, now)
+
+	_, reason, err := v.Validate(context.Background(), "short")
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// 有効期間内はキャッシュから返される
+	v.Now = func() time.Time { return now.Add(29 * time.Second) }
+	_, reason, err = v.Validate(context.Background(), "short")
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+	assert.Equal(t, int32(1), server.calls.Load())
+
+	// MaxCacheTTL（5分）より前でも、トークンの exp を過ぎたら再問い合わせされる
+	v.Now = func() time.Time { return now.Add(31 * time.Second) }
+	_, reason, err = v.Validate(context.Background(), "short")
+	assert.NoError(t, err)
+	assert.Equal(t, "token_expired", reason)
+	assert.Equal(t, int32(2), server.calls.Load())
+}
+
+func Test_DynamoDBにないトークンはイントロスペクションで認可されること(t *testing.T) {
+	now := time.Now()
+	server := newFakeIntrospectionServer(t, "authz-go", "s3cret", map[string]IntrospectionResult{
+		"external-token": {Active: true, Scope: "read:stores", ClientID: "partner-a", Exp: now.Add(time.Hour).Unix()},
+	})
+	auth := &Authorizer{
+		TableName:    TestTableName,
+		DDBClient:    testDDBClient,
+		Introspector: newTestIntrospector(server.URL, now),
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		effect string
+	}{
+		{"アクティブな外部トークンはAllowを返すこと", "Bearer external-token", "Allow"},
+		{"非アクティブな外部トークンはDenyを返すこと", "Bearer " + testutil.GenerateUniqueID("external"), "Deny"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := events.APIGatewayCustomAuthorizerRequest{
+				AuthorizationToken: tt.token,
+				MethodArn:          testMethodArn,
+			}
+
+			resp, err := auth.Handler(context.Background(), event)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.PolicyDocument.Statement[0].Effect)
+			if tt.effect == "Allow" {
+				assert.Equal(t, "read:stores", resp.Context["scope"])
+				assert.Equal(t, "partner-a", resp.Context["clientId"])
+			} else {
+				assert.Equal(t, "token_inactive", resp.Context["reason"])
+			}
+		})
+	}
+}
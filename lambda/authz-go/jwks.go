@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJWKSCacheTTL は JWKS（とディスカバリー文書）を定期的に取得し直す間隔
+	DefaultJWKSCacheTTL = time.Hour
+	// DefaultJWKSMinRefreshInterval は未知の kid による再取得の最短間隔
+	// 不正な kid を大量に送られても IdP に負荷をかけないようにする
+	DefaultJWKSMinRefreshInterval = time.Minute
+	// OIDCDiscoveryPath は issuer からディスカバリー文書を取得するパス
+	OIDCDiscoveryPath = "/.well-known/openid-configuration"
+)
+
+// errUnknownKeyID は JWKS に kid の鍵がないことを示す（署名の不正として扱う）
+var errUnknownKeyID = errors.New("unknown key id")
+
+// JWKS は JSON Web Key Set から取得した公開鍵のキャッシュ
+// URL が空の場合は Issuer の OIDC ディスカバリー文書の jwks_uri から取得する
+type JWKS struct {
+	// URL は JWKS のURL（空の場合はディスカバリーを使う）
+	URL string
+	// Issuer はディスカバリー文書を取得する issuer のURL
+	Issuer     string
+	HTTPClient *http.Client
+	// CacheTTL は取得した鍵を再取得せずに使う時間
+	CacheTTL time.Duration
+	// MinRefreshInterval は取得し直すまでの最短間隔（未知の kid と、取得に失敗した後の再試行に使う）
+	MinRefreshInterval time.Duration
+	// Now は現在時刻を返す（テスト用に差し替え可能）
+	Now func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+	// fetchedAt は最後に取得に成功した時刻、attemptedAt は最後に取得を試みた時刻
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	// lastErr は最後の取得のエラー（成功した場合は nil）
+	lastErr error
+	// refreshing は取得中の場合に取得の完了で閉じられる（取得していない場合は nil）
+	refreshing chan struct{}
+}
+
+// Key は kid に対応する公開鍵を返す
+// キャッシュが CacheTTL を過ぎている場合と、未知の kid の場合（IdP の鍵ローテーション）は JWKS を取得し直す
+// 取得し直せない場合は取得済みの鍵を使い続け、MinRefreshInterval が過ぎるまで再試行しない
+// kid が空の場合は JWKS の鍵が1つだけのときに限りその鍵を使う
+func (k *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	now := k.now()
+	k.mu.Lock()
+	key, ok := k.lookup(kid)
+	refresh := k.needsRefresh(ok, now)
+	hasKeys := k.keys != nil
+	k.mu.Unlock()
+
+	if refresh {
+		if !ok && hasKeys {
+			log.Printf("[Authorizer] Unknown key id %q, refreshing JWKS", kid)
+		}
+		err := k.refresh(ctx, now)
+		k.mu.Lock()
+		key, ok = k.lookup(kid)
+		k.mu.Unlock()
+		if err != nil && ok {
+			log.Printf("[Authorizer] %v, using cached JWKS", err)
+		}
+	}
+	if ok {
+		return key, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys == nil && k.lastErr != nil {
+		return nil, k.lastErr
+	}
+	return nil, fmt.Errorf("%w: %q", errUnknownKeyID, kid)
+}
+
+// Warm はキャッシュが空か CacheTTL を過ぎている場合に JWKS を取得する
+// 最後の取得が失敗している場合（取得済みの鍵を使い続けている場合も含む）と、署名に使える鍵が1つもない場合はエラーを返す
+func (k *JWKS) Warm(ctx context.Context) error {
+	now := k.now()
+	k.mu.Lock()
+	refresh := k.needsRefresh(true, now)
+	k.mu.Unlock()
+
+	if refresh {
+		if err := k.refresh(ctx, now); err != nil {
+			return err
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.lastErr != nil {
+		return k.lastErr
+	}
+	if len(k.keys) == 0 {
+		return errors.New("JWKS has no usable signing keys")
+	}
+	return nil
+}
+
+// needsRefresh は JWKS を取得し直すかを返す（k.mu を保持して呼び出す）
+// known は必要な鍵をキャッシュから取得できたか
+// 取得中の場合は、鍵を持っていない呼び出し元だけが取得の完了を待つ
+func (k *JWKS) needsRefresh(known bool, now time.Time) bool {
+	if k.refreshing != nil {
+		return !known || k.keys == nil
+	}
+	if !k.attemptedAt.IsZero() && now.Sub(k.attemptedAt) < k.MinRefreshInterval {
+		return false
+	}
+	if k.keys == nil || now.Sub(k.fetchedAt) >= k.CacheTTL {
+		return true
+	}
+	return !known
+}
+
+func (k *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// refresh は JWKS を取得し直す
+// 取得は k.mu を保持せずに行い、同時に呼び出された場合は1回だけ取得して結果を共有する
+// 取得に失敗しても取得済みの鍵は残す
+func (k *JWKS) refresh(ctx context.Context, now time.Time) error {
+	k.mu.Lock()
+	if done := k.refreshing; done != nil {
+		k.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		return k.lastErr
+	}
+	done := make(chan struct{})
+	k.refreshing, k.attemptedAt = done, now
+	k.mu.Unlock()
+
+	keys, err := k.fetch(ctx)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err == nil {
+		k.keys, k.fetchedAt = keys, now
+	}
+	k.lastErr = err
+	k.refreshing = nil
+	close(done)
+	return err
+}
+
+// fetch は JWKS を取得する（ディスカバリーを使う場合は jwks_uri も取得し直す）
+func (k *JWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	url := k.URL
+	if url == "" {
+		doc, err := discoverOIDC(ctx, k.client(), k.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		url = doc.JWKSURI
+	}
+	return fetchJWKS(ctx, k.client(), url)
+}
+
+func (k *JWKS) client() *http.Client {
+	if k.HTTPClient != nil {
+		return k.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (k *JWKS) now() time.Time {
+	if k.Now != nil {
+		return k.Now()
+	}
+	return time.Now()
+}
+
+// oidcDiscoveryDocument は OpenID Connect Discovery のプロバイダーメタデータのうち使用する項目
+type oidcDiscoveryDocument struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// discoverOIDC は issuer のディスカバリー文書を取得する
+// 文書の issuer が設定と一致しない場合は、別のプロバイダーの鍵を信頼しないようエラーにする
+func discoverOIDC(ctx context.Context, client *http.Client, issuer string) (*oidcDiscoveryDocument, error) {
+	var doc oidcDiscoveryDocument
+	if err := getJSON(ctx, client, strings.TrimSuffix(issuer, "/")+OIDCDiscoveryPath, &doc); err != nil {
+		return nil, fmt.Errorf("OIDC discovery for %q failed: %w", issuer, err)
+	}
+	if doc.Issuer != issuer {
+		return nil, fmt.Errorf("OIDC discovery for %q returned issuer %q", issuer, doc.Issuer)
+	}
+	if doc.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery for %q has no jwks_uri", issuer)
+	}
+	return &doc, nil
+}
+
+// jsonWebKey は JWK（RFC 7517）のうち署名検証に使う項目
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchJWKS は JWKS を取得し、kid ごとの公開鍵に変換する
+// 署名用でない鍵（use=enc）と未対応の鍵種別は無視する
+func fetchJWKS(ctx context.Context, client *http.Client, url string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, client, url, &set); err != nil {
+		return nil, fmt.Errorf("JWKS request failed: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("[Authorizer] Skipping JWK %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// getJSON は url を GET し、200 のレスポンスを v にデコードする
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid e")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
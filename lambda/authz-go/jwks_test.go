@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeIdP は OIDC ディスカバリー文書と JWKS を返すテスト用の IdP
+type fakeIdP struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	keys         map[string]*rsa.PublicKey
+	issuer       string
+	jwksRequests int
+	// failing の間は JWKS の取得を 503 にする
+	failing bool
+	// block が nil でない場合、JWKS の取得は started に通知してから block が閉じられるまで待つ
+	block   chan struct{}
+	started chan struct{}
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	idp := &fakeIdP{keys: map[string]*rsa.PublicKey{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(OIDCDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"issuer": idp.issuer, "jwks_uri": idp.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		block, started := idp.block, idp.started
+		idp.mu.Unlock()
+		if block != nil {
+			started <- struct{}{}
+			<-block
+		}
+
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksRequests++
+		if idp.failing {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var set struct {
+			Keys []map[string]string `json:"keys"`
+		}
+		for kid, key := range idp.keys {
+			set.Keys = append(set.Keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(set)
+	})
+	idp.Server = httptest.NewServer(mux)
+	idp.issuer = idp.URL
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *fakeIdP) addKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.keys[kid] = &key.PublicKey
+}
+
+func (idp *fakeIdP) setFailing(failing bool) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.failing = failing
+}
+
+func (idp *fakeIdP) requests() int {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	return idp.jwksRequests
+}
+
+func Test_OIDCディスカバリーでJWKSが取得されること(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.addKey(t, "k1")
+	jwks := &JWKS{Issuer: idp.URL, CacheTTL: time.Hour, MinRefreshInterval: time.Minute}
+
+	key, err := jwks.Key(context.Background(), "k1")
+
+	assert.NoError(t, err)
+	assert.NotNil(t, key)
+	assert.Equal(t, 1, idp.requests())
+}
+
+func Test_ディスカバリー文書のissuerが異なる場合はエラーになること(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.addKey(t, "k1")
+	idp.issuer = "https://other.example.com"
+	jwks := &JWKS{Issuer: idp.URL, CacheTTL: time.Hour}
+
+	_, err := jwks.Key(context.Background(), "k1")
+
+	assert.ErrorContains(t, err, `returned issuer "https://other.example.com"`)
+}
+
+func Test_JWKSが定期的および未知のkidで取得し直されること(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.addKey(t, "k1")
+	now := time.Unix(1_700_000_000, 0)
+	jwks := &JWKS{
+		Issuer:             idp.URL,
+		CacheTTL:           time.Hour,
+		MinRefreshInterval: time.Minute,
+		Now:                func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	_, err := jwks.Key(ctx, "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, idp.requests())
+
+	// IdP が鍵をローテーションしても、最短間隔内は取得し直さない
+	idp.addKey(t, "k2")
+	now = now.Add(30 * time.Second)
+	_, err = jwks.Key(ctx, "k2")
+	assert.ErrorIs(t, err, errUnknownKeyID)
+	assert.Equal(t, 1, idp.requests())
+
+	// 最短間隔を過ぎると未知の kid で取得し直す
+	now = now.Add(time.Minute)
+	_, err = jwks.Key(ctx, "k2")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, idp.requests())
+
+	// 既知の kid でも CacheTTL を過ぎると取得し直す
+	now = now.Add(time.Hour)
+	_, err = jwks.Key(ctx, "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, idp.requests())
+}
+
+func Test_JWKSを取得し直せない場合は取得済みの鍵を使い続けること(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.addKey(t, "k1")
+	now := time.Unix(1_700_000_000, 0)
+	jwks := &JWKS{
+		Issuer:             idp.URL,
+		CacheTTL:           time.Hour,
+		MinRefreshInterval: time.Minute,
+		Now:                func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	cached, err := jwks.Key(ctx, "k1")
+	assert.NoError(t, err)
+
+	// CacheTTL を過ぎて取得に失敗しても取得済みの鍵を返す
+	idp.setFailing(true)
+	now = now.Add(time.Hour)
+	key, err := jwks.Key(ctx, "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, cached, key)
+	assert.Equal(t, 2, idp.requests())
+
+	// 最短間隔内はリクエストごとに IdP を呼び出さない
+	now = now.Add(30 * time.Second)
+	_, err = jwks.Key(ctx, "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, idp.requests())
+	assert.Error(t, jwks.Warm(ctx), "ヘルスチェックは取得の失敗を報告する")
+
+	// 最短間隔を過ぎると再試行する
+	idp.setFailing(false)
+	now = now.Add(time.Minute)
+	assert.NoError(t, jwks.Warm(ctx))
+	assert.Equal(t, 3, idp.requests())
+}
+
+func Test_JWKSを一度も取得できない場合は最短間隔ごとに再試行すること(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.addKey(t, "k1")
+	idp.setFailing(true)
+	now := time.Unix(1_700_000_000, 0)
+	jwks := &JWKS{
+		Issuer:             idp.URL,
+		CacheTTL:           time.Hour,
+		MinRefreshInterval: time.Minute,
+		Now:                func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	for range 3 {
+		_, err := jwks.Key(ctx, "k1")
+		assert.ErrorContains(t, err, "JWKS request failed")
+		assert.NotErrorIs(t, err, errUnknownKeyID)
+	}
+	assert.Equal(t, 1, idp.requests())
+
+	idp.setFailing(false)
+	now = now.Add(time.Minute)
+	_, err := jwks.Key(ctx, "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, idp.requests())
+}
+
+func Test_JWKSの取得中も取得済みの鍵を待たずに返すこと(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.addKey(t, "k1")
+	now := time.Unix(1_700_000_000, 0)
+	jwks := &JWKS{
+		Issuer:             idp.URL,
+		CacheTTL:           time.Hour,
+		MinRefreshInterval: time.Minute,
+		Now:                func() time.Time { return now },
+	}
+	ctx := context.Background()
+	_, err := jwks.Key(ctx, "k1")
+	assert.NoError(t, err)
+
+	block, started := make(chan struct{}), make(chan struct{}, 1)
+	idp.mu.Lock()
+	idp.block, idp.started = block, started
+	idp.mu.Unlock()
+	now = now.Add(time.Hour)
+
+	refreshed := make(chan error, 1)
+	go func() {
+		_, err := jwks.Key(ctx, "k1")
+		refreshed <- err
+	}()
+	<-started
+
+	// 取得中（IdP の応答待ち）でも既知の kid はすぐに返る
+	key, err := jwks.Key(ctx, "k1")
+	assert.NoError(t, err)
+	assert.NotNil(t, key)
+
+	close(block)
+	assert.NoError(t, <-refreshed)
+	assert.Equal(t, 2, idp.requests())
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultJWTCompanyClaim はテナントIDを表すクレーム名
+const DefaultJWTCompanyClaim = "company_id"
+
+// クレームの対応先のうち Identity の項目になるもの（それ以外の対応先は context のキーになる）
+const (
+	claimTargetUserID    = "userId"
+	claimTargetClientID  = "clientId"
+	claimTargetCompanyID = "companyId"
+	claimTargetScope     = "scope"
+)
+
+// defaultClaimMappings はクレームと Identity の項目の既定の対応（上にあるものを優先、JWT・PASETO 共通）
+// 発行者の claims で同じ対応先を指定した場合は、その対応先の既定値は使わない
+var defaultClaimMappings = []claimMapping{
+	{Claim: "sub", Target: claimTargetUserID},
+	{Claim: "client_id", Target: claimTargetClientID},
+	{Claim: "azp", Target: claimTargetClientID},
+	{Claim: DefaultJWTCompanyClaim, Target: claimTargetCompanyID},
+	{Claim: "scope", Target: claimTargetScope},
+	{Claim: "scp", Target: claimTargetScope},
+}
+
+// reservedContextKeys は Authorizer が設定するためクレームの対応先に指定できない context のキー
+var reservedContextKeys = []string{"token", "internalToken", "roles", "degraded", "token_rotation_pending", "actor", "actorCompanyId"}
+
+type claimMapping struct {
+	Claim  string
+	Target string
+}
+
+// JWTIssuersConfig は信頼する JWT 発行者の設定ファイル（JWT_ISSUERS_FILE）
+type JWTIssuersConfig struct {
+	Issuers []JWTIssuerConfig `json:"issuers"`
+}
+
+// JWTIssuerConfig は1つの発行者の設定
+type JWTIssuerConfig struct {
+	// Issuer は iss クレームに期待する値（OIDC ディスカバリーの URL にも使う）
+	Issuer string `json:"issuer"`
+	// JWKSURI は JWKS の URL（省略時は OIDC ディスカバリーの jwks_uri を使う）
+	JWKSURI string `json:"jwksUri,omitempty"`
+	// Audience は aud クレームに含まれるべき値（省略時は検査しない）
+	Audience string `json:"audience,omitempty"`
+	// Algorithms は許可する署名アルゴリズム（省略時は RS256）
+	Algorithms []string `json:"algorithms,omitempty"`
+	// Claims はクレーム名と対応先（userId・clientId・companyId・scope、またはそれ以外の context のキー）
+	Claims map[string]string `json:"claims,omitempty"`
+}
+
+// JWTIssuer は検証に使う発行者ごとの設定と公開鍵
+type JWTIssuer struct {
+	Issuer     string
+	Audience   string
+	Algorithms []string
+	JWKS       *JWKS
+
+	claims []claimMapping
+}
+
+// NewJWTIssuer は設定を検証し、JWTIssuer を作成する
+func NewJWTIssuer(cfg JWTIssuerConfig, httpClient *http.Client, cacheTTL, minRefresh time.Duration) (*JWTIssuer, error) {
+	if cfg.Issuer == "" {
+		return nil, errors.New("issuer is required")
+	}
+	algorithms := cfg.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"RS256"}
+	}
+	for _, alg := range algorithms {
+		// 公開鍵で検証する JWKS では HMAC や none は使えない（アルゴリズム混同攻撃の対策）
+		if alg == "none" || strings.HasPrefix(alg, "HS") {
+			return nil, fmt.Errorf("algorithm %q is not allowed", alg)
+		}
+	}
+	claims, err := buildClaimMappings(cfg.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWTIssuer{
+		Issuer:     cfg.Issuer,
+		Audience:   cfg.Audience,
+		Algorithms: algorithms,
+		JWKS: &JWKS{
+			URL:                cfg.JWKSURI,
+			Issuer:             cfg.Issuer,
+			HTTPClient:         httpClient,
+			CacheTTL:           cacheTTL,
+			MinRefreshInterval: minRefresh,
+		},
+		claims: claims,
+	}, nil
+}
+
+// buildClaimMappings は発行者の claims を既定の対応と組み合わせる
+func buildClaimMappings(claims map[string]string) ([]claimMapping, error) {
+	var mappings []claimMapping
+	targets := map[string]bool{}
+	for _, claim := range slices.Sorted(maps.Keys(claims)) {
+		target := claims[claim]
+		if !contextKeyPattern.MatchString(target) || slices.Contains(reservedContextKeys, target) {
+			return nil, fmt.Errorf("claims[%q]: %q cannot be used as a context key", claim, target)
+		}
+		if targets[target] {
+			return nil, fmt.Errorf("claims[%q]: %q is mapped from more than one claim", claim, target)
+		}
+		targets[target] = true
+		mappings = append(mappings, claimMapping{Claim: claim, Target: target})
+	}
+	for _, m := range defaultClaimMappings {
+		if !targets[m.Target] {
+			mappings = append(mappings, m)
+		}
+	}
+	return mappings, nil
+}
+
+// JWTAuthenticator は信頼する発行者が署名した JWT を、発行者ごとの JWKS の公開鍵で検証する
+type JWTAuthenticator struct {
+	Issuers []*JWTIssuer
+	// Now は現在時刻を返す（テスト用に差し替え可能）
+	Now func() time.Time
+}
+
+// NewJWTAuthenticatorFromEnv は環境変数から JWTAuthenticator を作成する
+// JWT_ISSUERS_FILE に発行者の一覧を指定するか、JWT_ISSUER で1つの発行者を指定する
+// JWT_JWKS_URL を省略した場合は OIDC ディスカバリーで JWKS の URL を取得する
+func NewJWTAuthenticatorFromEnv() (*JWTAuthenticator, error) {
+	var cfg JWTIssuersConfig
+	if path := os.Getenv("JWT_ISSUERS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT issuers file: %w", err)
+		}
+		c, err := ParseJWTIssuersConfig(data)
+		if err != nil {
+			return nil, err
+		}
+		cfg = *c
+	} else if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		issuerCfg := JWTIssuerConfig{
+			Issuer:     issuer,
+			JWKSURI:    os.Getenv("JWT_JWKS_URL"),
+			Audience:   os.Getenv("JWT_AUDIENCE"),
+			Algorithms: splitList(os.Getenv("JWT_ALGORITHMS")),
+		}
+		if claim := os.Getenv("JWT_COMPANY_CLAIM"); claim != "" {
+			issuerCfg.Claims = map[string]string{claim: claimTargetCompanyID}
+		}
+		cfg.Issuers = []JWTIssuerConfig{issuerCfg}
+	} else {
+		return nil, errors.New("JWT_ISSUERS_FILE or JWT_ISSUER is required for the jwt authenticator")
+	}
+
+	ttl, err := durationFromEnv("JWT_JWKS_CACHE_TTL_SECONDS", DefaultJWKSCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	minRefresh, err := durationFromEnv("JWT_JWKS_MIN_REFRESH_SECONDS", DefaultJWKSMinRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{Timeout: 3 * time.Second}
+	authn := &JWTAuthenticator{}
+	for i, c := range cfg.Issuers {
+		issuer, err := NewJWTIssuer(c, httpClient, ttl, minRefresh)
+		if err != nil {
+			return nil, fmt.Errorf("issuers[%d]: %w", i, err)
+		}
+		authn.Issuers = append(authn.Issuers, issuer)
+	}
+	return authn, nil
+}
+
+// ParseJWTIssuersConfig は発行者の設定ファイルをパースする
+func ParseJWTIssuersConfig(data []byte) (*JWTIssuersConfig, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var cfg JWTIssuersConfig
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse JWT issuers: %w", err)
+	}
+	if len(cfg.Issuers) == 0 {
+		return nil, errors.New("JWT issuers: at least one issuer is required")
+	}
+	seen := map[string]bool{}
+	for i, c := range cfg.Issuers {
+		if seen[c.Issuer] {
+			return nil, fmt.Errorf("issuers[%d]: duplicate issuer %q", i, c.Issuer)
+		}
+		seen[c.Issuer] = true
+	}
+	return &cfg, nil
+}
+
+func (j *JWTAuthenticator) Name() string { return AuthenticatorJWT }
+
+// Recognizes はヘッダーに alg を持つ3セグメントのトークンを JWT とみなす
+func (j *JWTAuthenticator) Recognizes(cred *Credential) bool {
+	parts := strings.Split(cred.Token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	return json.Unmarshal(b, &header) == nil && header.Alg != ""
+}
+
+func (j *JWTAuthenticator) Authenticate(ctx context.Context, cred *Credential) (*Identity, map[string]interface{}) {
+	issuer := j.issuerOf(cred.Token)
+	if issuer == nil {
+		log.Printf("[Authorizer] JWT issuer is not trusted, returning Deny")
+		return nil, map[string]interface{}{
+			"reason": "untrusted_issuer",
+		}
+	}
+
+	var fetchErr error
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := issuer.JWKS.Key(ctx, kid)
+		if err != nil {
+			fetchErr = err
+		}
+		return key, err
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(issuer.Algorithms),
+		jwt.WithIssuer(issuer.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(j.now),
+	}
+	if issuer.Audience != "" {
+		opts = append(opts, jwt.WithAudience(issuer.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(cred.Token, claims, keyFunc, opts...)
+	if fetchErr != nil && !errors.Is(fetchErr, errUnknownKeyID) {
+		log.Printf("[Authorizer] Failed to fetch JWKS: %v", fetchErr)
+		return nil, map[string]interface{}{
+			"error": "jwks_fetch_failed",
+		}
+	}
+	if err != nil {
+		reason := jwtDenyReason(err)
+		log.Printf("[Authorizer] JWT rejected (%s): %v, returning Deny", reason, err)
+		return nil, map[string]interface{}{
+			"reason": reason,
+		}
+	}
+
+	log.Printf("[Authorizer] JWT is valid")
+	return issuer.identityFromClaims(cred.Token, claims), nil
+}
+
+// issuerOf は署名を検証する前の iss クレームから発行者を選ぶ（信頼しない発行者の場合は nil）
+// 選んだ発行者の鍵で署名と iss を検証するため、ここで iss を信用しても問題ない
+func (j *JWTAuthenticator) issuerOf(token string) *JWTIssuer {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return nil
+	}
+	iss, _ := claims["iss"].(string)
+	for _, issuer := range j.Issuers {
+		if issuer.Issuer == iss {
+			return issuer
+		}
+	}
+	return nil
+}
+
+// jwtDenyReason は JWT の検証エラーを Deny 理由に変換する
+func jwtDenyReason(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "token_expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return "token_not_yet_valid"
+	default:
+		return "invalid_token"
+	}
+}
+
+// identityFromClaims は検証済みのクレームから Identity を作成する
+func (i *JWTIssuer) identityFromClaims(token string, claims jwt.MapClaims) *Identity {
+	return identityFromClaims(token, TokenTypeJWT, i.claims, claims)
+}
+
+// identityFromClaims はクレームの対応に従って Identity を作成する（JWT・PASETO 共通）
+// 同じ対応先に複数のクレームがある場合は、最初に値のあるクレームを使う
+func identityFromClaims(token, tokenType string, mappings []claimMapping, claims map[string]interface{}) *Identity {
+	id := &Identity{
+		Token:     token,
+		TokenType: tokenType,
+	}
+	for _, m := range mappings {
+		values := claimValues(claims[m.Claim])
+		if len(values) == 0 {
+			continue
+		}
+		switch m.Target {
+		case claimTargetUserID:
+			id.UserID = cmp.Or(id.UserID, values[0])
+		case claimTargetClientID:
+			id.ClientID = cmp.Or(id.ClientID, values[0])
+		case claimTargetCompanyID:
+			id.CompanyID = cmp.Or(id.CompanyID, values[0])
+		case claimTargetScope:
+			if len(id.Scopes) == 0 {
+				// scope はスペース区切りの文字列、scp は配列で渡される
+				id.addScopes(strings.Fields(strings.Join(values, " ")))
+			}
+		default:
+			if id.Claims == nil {
+				id.Claims = map[string]string{}
+			}
+			if _, ok := id.Claims[m.Target]; !ok {
+				id.Claims[m.Target] = strings.Join(values, ContextListSeparator)
+			}
+		}
+	}
+	return id
+}
+
+// claimValues はクレームの値を文字列のリストに変換する
+// 配列は要素ごと、数値・真偽値は文字列にする（空文字は除く）
+func claimValues(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	case []interface{}:
+		var out []string
+		for _, e := range v {
+			out = append(out, claimValues(e)...)
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func (j *JWTAuthenticator) now() time.Time {
+	if j.Now != nil {
+		return j.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const testJWTIssuer = "https://idp.example.com"
+
+// ヘルパー関数: RSA 公開鍵を JWKS として返すテストサーバーを起動
+func newJWKSServer(t *testing.T, keys map[string]*rsa.PublicKey) *httptest.Server {
+	t.Helper()
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// ヘルパー関数: RS256 で署名した JWT を作成
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign JWT: %v", err)
+	}
+	return signed
+}
+
+func Test_JWTがJWKSの公開鍵で検証されること(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	srv := newJWKSServer(t, map[string]*rsa.PublicKey{"key-1": &key.PublicKey})
+
+	now := time.Unix(1_700_000_000, 0)
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":        testJWTIssuer,
+			"aud":        "local-gateway",
+			"sub":        "user-1",
+			"azp":        "web-app",
+			"scope":      "read:stores write:stores",
+			"company_id": "67890",
+			"exp":        now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil)).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		token   string
+		effect  string
+		context map[string]interface{}
+	}{
+		{"有効なJWTはクレームがcontextに設定されること", signTestJWT(t, key, "key-1", claims(nil)), "Allow", map[string]interface{}{
+			"userId": "user-1", "clientId": "web-app", "companyId": "67890", "scope": "read:stores write:stores",
+		}},
+		{"scpクレームの配列がスコープになること", signTestJWT(t, key, "key-1", claims(jwt.MapClaims{"scope": nil, "scp": []string{"read:stores"}})), "Allow", map[string]interface{}{
+			"scope": "read:stores",
+		}},
+		{"4096バイトを超えるJWTでもAllowになること", signTestJWT(t, key, "key-1", claims(jwt.MapClaims{"profile": strings.Repeat("x", MaxContextValueBytes)})), "Allow", map[string]interface{}{
+			"userId": "user-1", "token": nil,
+		}},
+		{"期限切れのJWTはDenyになること", signTestJWT(t, key, "key-1", claims(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})), "Deny", map[string]interface{}{"reason": "token_expired"}},
+		{"有効期間前のJWTはDenyになること", signTestJWT(t, key, "key-1", claims(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()})), "Deny", map[string]interface{}{"reason": "token_not_yet_valid"}},
+		{"expのないJWTはDenyになること", signTestJWT(t, key, "key-1", claims(jwt.MapClaims{"exp": nil})), "Deny", map[string]interface{}{"reason": "invalid_token"}},
+		{"異なるaudienceのJWTはDenyになること", signTestJWT(t, key, "key-1", claims(jwt.MapClaims{"aud": "other"})), "Deny", map[string]interface{}{"reason": "invalid_token"}},
+		{"異なる鍵で署名したJWTはDenyになること", signTestJWT(t, otherKey, "key-1", claims(nil)), "Deny", map[string]interface{}{"reason": "invalid_token"}},
+		{"JWKSにないkidのJWTはDenyになること", signTestJWT(t, key, "key-2", claims(nil)), "Deny", map[string]interface{}{"reason": "invalid_token"}},
+		{"許可していないアルゴリズムのJWTはDenyになること", hs256, "Deny", map[string]interface{}{"reason": "invalid_token"}},
+		{"信頼していない発行者のJWTはDenyになること", signTestJWT(t, key, "key-1", claims(jwt.MapClaims{"iss": "https://evil.example.com"})), "Deny", map[string]interface{}{"reason": "untrusted_issuer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer, err := NewJWTIssuer(JWTIssuerConfig{
+				Issuer:   testJWTIssuer,
+				JWKSURI:  srv.URL,
+				Audience: "local-gateway",
+			}, nil, time.Hour, time.Minute)
+			assert.NoError(t, err)
+			auth := &Authorizer{
+				Authenticators: AuthenticatorChain{&JWTAuthenticator{
+					Issuers: []*JWTIssuer{issuer},
+					Now:     func() time.Time { return now },
+				}},
+			}
+
+			resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+				AuthorizationToken: "Bearer " + tt.token,
+				MethodArn:          testMethodArn,
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.PolicyDocument.Statement[0].Effect)
+			for k, v := range tt.context {
+				assert.Equal(t, v, resp.Context[k])
+			}
+		})
+	}
+}
+
+func Test_JWKSを取得できない場合はエラーでDenyになること(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	issuer, err := NewJWTIssuer(JWTIssuerConfig{Issuer: testJWTIssuer, JWKSURI: srv.URL}, nil, time.Hour, time.Minute)
+	assert.NoError(t, err)
+	auth := &Authorizer{
+		Authenticators: AuthenticatorChain{&JWTAuthenticator{Issuers: []*JWTIssuer{issuer}}},
+	}
+	token := signTestJWT(t, key, "key-1", jwt.MapClaims{"iss": testJWTIssuer, "exp": time.Now().Add(time.Hour).Unix()})
+
+	resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + token,
+		MethodArn:          testMethodArn,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+	assert.Equal(t, "jwks_fetch_failed", resp.Context["error"])
+}
+
+func Test_JWT形式のトークンのみ認識されること(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{header + ".e30.sig", true},
+		{"opaque-token", false},
+		{"a.b.c", false},
+		{base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT"}`)) + ".e30.sig", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			assert.Equal(t, tt.want, (&JWTAuthenticator{}).Recognizes(&Credential{Token: tt.token}))
+		})
+	}
+}
+
+func Test_発行者ごとのaudienceとクレームの対応で検証されること(t *testing.T) {
+	corpKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	partnerKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	corpJWKS := newJWKSServer(t, map[string]*rsa.PublicKey{"corp": &corpKey.PublicKey})
+	partnerJWKS := newJWKSServer(t, map[string]*rsa.PublicKey{"partner": &partnerKey.PublicKey})
+
+	corp, err := NewJWTIssuer(JWTIssuerConfig{
+		Issuer:   "https://login.example.com",
+		JWKSURI:  corpJWKS.URL,
+		Audience: "local-gateway",
+	}, nil, time.Hour, time.Minute)
+	assert.NoError(t, err)
+	partner, err := NewJWTIssuer(JWTIssuerConfig{
+		Issuer:   "https://partner.example.net",
+		JWKSURI:  partnerJWKS.URL,
+		Audience: "api://partner",
+		Claims:   map[string]string{"org": "companyId", "email": "email", "groups": "groups"},
+	}, nil, time.Hour, time.Minute)
+	assert.NoError(t, err)
+	auth := &Authorizer{
+		Authenticators: AuthenticatorChain{&JWTAuthenticator{Issuers: []*JWTIssuer{corp, partner}}},
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name    string
+		token   string
+		effect  string
+		context map[string]interface{}
+	}{
+		{"社内IdPのJWTは既定のクレームで対応付けられること", signTestJWT(t, corpKey, "corp", jwt.MapClaims{
+			"iss": "https://login.example.com", "aud": "local-gateway", "exp": exp, "sub": "u-1", "company_id": "12345", "org": "ignored",
+		}), "Allow", map[string]interface{}{"userId": "u-1", "companyId": "12345", "email": nil}},
+		{"パートナーIdPのJWTは設定したクレームで対応付けられること", signTestJWT(t, partnerKey, "partner", jwt.MapClaims{
+			"iss": "https://partner.example.net", "aud": "api://partner", "exp": exp, "sub": "p-1",
+			"org": "67890", "company_id": "ignored", "email": "p@example.net", "groups": []string{"admins", "ops"},
+		}), "Allow", map[string]interface{}{"userId": "p-1", "companyId": "67890", "email": "p@example.net", "groups": "admins ops"}},
+		{"他の発行者のaudienceはDenyになること", signTestJWT(t, partnerKey, "partner", jwt.MapClaims{
+			"iss": "https://partner.example.net", "aud": "local-gateway", "exp": exp,
+		}), "Deny", map[string]interface{}{"reason": "invalid_token"}},
+		{"他の発行者の鍵で署名したJWTはDenyになること", signTestJWT(t, corpKey, "partner", jwt.MapClaims{
+			"iss": "https://partner.example.net", "aud": "api://partner", "exp": exp,
+		}), "Deny", map[string]interface{}{"reason": "invalid_token"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+				AuthorizationToken: "Bearer " + tt.token,
+				MethodArn:          testMethodArn,
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.PolicyDocument.Statement[0].Effect)
+			for k, v := range tt.context {
+				assert.Equal(t, v, resp.Context[k], k)
+			}
+		})
+	}
+}
+
+func Test_不正な発行者の設定はエラーになること(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"発行者がない", `{"issuers": []}`, "at least one issuer is required"},
+		{"未知のフィールド", `{"issuers": [{"issuer": "https://a", "jwks": "x"}]}`, `unknown field "jwks"`},
+		{"発行者の重複", `{"issuers": [{"issuer": "https://a"}, {"issuer": "https://a"}]}`, `issuers[1]: duplicate issuer "https://a"`},
+		{"HMACアルゴリズム", `{"issuers": [{"issuer": "https://a", "algorithms": ["HS256"]}]}`, `issuers[0]: algorithm "HS256" is not allowed`},
+		{"予約されたcontextのキー", `{"issuers": [{"issuer": "https://a", "claims": {"tok": "token"}}]}`, `issuers[0]: claims["tok"]: "token" cannot be used as a context key`},
+		{"参照できないcontextのキー", `{"issuers": [{"issuer": "https://a", "claims": {"email": "e-mail"}}]}`, `"e-mail" cannot be used as a context key`},
+		{"対応先の重複", `{"issuers": [{"issuer": "https://a", "claims": {"org": "companyId", "tenant": "companyId"}}]}`, `"companyId" is mapped from more than one claim`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/issuers.json"
+			assert.NoError(t, os.WriteFile(path, []byte(tt.config), 0o600))
+			t.Setenv("JWT_ISSUERS_FILE", path)
+
+			_, err := NewJWTAuthenticatorFromEnv()
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
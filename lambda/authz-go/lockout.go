@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// DefaultLockoutTableName は認証失敗の回数とロックアウトを保持するテーブル名
+	DefaultLockoutTableName = "AuthFailures"
+	// DefaultLockoutThreshold はロックアウトするまでの認証失敗の回数
+	DefaultLockoutThreshold = 10
+	// DefaultLockoutWindow は認証失敗を数える期間
+	DefaultLockoutWindow = 5 * time.Minute
+	// DefaultLockoutDuration はロックアウトを続ける時間
+	DefaultLockoutDuration = 15 * time.Minute
+
+	ReasonLockedOut = "locked_out"
+	MetricLockout   = "Lockout"
+	// MetricLockoutCheckSkipped はロックアウトの状態を確認できずに検査を省略した回数
+	MetricLockoutCheckSkipped = "LockoutCheckSkipped"
+)
+
+// lockoutSubjectIP はロックアウトの対象（AuthFailures テーブルの subject）の接頭辞
+const lockoutSubjectIP = "ip#"
+
+// lockoutFailureReasons はトークンの推測とみなして数える Deny理由
+// 期限切れ・無効化されたトークンや DynamoDB の障害は正規の呼び出し元でも起こるため数えない
+var lockoutFailureReasons = []string{
+	"token_not_found",
+	"invalid_signature",
+	"invalid_token",
+	"untrusted_issuer",
+	"unsupported_credential",
+}
+
+// LockoutGuard は送信元IPごとの認証失敗を数え、しきい値を超えた呼び出し元をロックアウトする
+// 送信元IPは REQUEST タイプのイベントにしか含まれないため、TOKEN タイプの Authorizer では何もしない
+// 項目は expiresAt（TTL）で自動的に削除される
+type LockoutGuard struct {
+	TableName string
+	DDBClient *dynamodb.Client
+	// Threshold は Window 内でロックアウトするまでの認証失敗の回数
+	Threshold int
+	Window    time.Duration
+	// Duration はロックアウトを続ける時間
+	Duration time.Duration
+	// Audit はロックアウトの監査ログの書き込み先（nil の場合はログ出力のみ）
+	Audit *AuditLog
+}
+
+// lockoutItem は AuthFailures テーブルの項目
+type lockoutItem struct {
+	Subject     string `dynamodbav:"subject"`
+	Failures    int    `dynamodbav:"failures"`
+	WindowStart int64  `dynamodbav:"windowStart"`
+	// LockedUntil はロックアウトの期限（Unix秒、ロックアウトされていない場合は0）
+	LockedUntil int64 `dynamodbav:"lockedUntil"`
+}
+
+// NewLockoutGuardFromEnv は環境変数から LockoutGuard を作成する
+// AUTHZ_LOCKOUT_THRESHOLD が 0 の場合は nil を返す（ロックアウト無効）
+func NewLockoutGuardFromEnv(ddb *dynamodb.Client, audit *AuditLog) (*LockoutGuard, error) {
+	threshold := DefaultLockoutThreshold
+	if v := os.Getenv("AUTHZ_LOCKOUT_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid AUTHZ_LOCKOUT_THRESHOLD: %q", v)
+		}
+		threshold = n
+	}
+	if threshold == 0 {
+		return nil, nil
+	}
+	window, err := durationFromEnv("AUTHZ_LOCKOUT_WINDOW_SECONDS", DefaultLockoutWindow)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := durationFromEnv("AUTHZ_LOCKOUT_DURATION_SECONDS", DefaultLockoutDuration)
+	if err != nil {
+		return nil, err
+	}
+	if window == 0 || duration == 0 {
+		return nil, errors.New("AUTHZ_LOCKOUT_WINDOW_SECONDS and AUTHZ_LOCKOUT_DURATION_SECONDS must be positive")
+	}
+
+	return &LockoutGuard{
+		TableName: DefaultLockoutTableName,
+		DDBClient: ddb,
+		Threshold: threshold,
+		Window:    window,
+		Duration:  duration,
+		Audit:     audit,
+	}, nil
+}
+
+// lockoutSubject はリクエストのロックアウトの対象を返す（送信元IPがない TOKEN タイプでは空文字）
+// トークン先頭は対象にしない（異なるトークンを試す総当たりは止められず、正規のトークンと同じ先頭を送るだけで第三者をロックアウトできるため）
+func lockoutSubject(sourceIP string) string {
+	if sourceIP == "" {
+		return ""
+	}
+	return lockoutSubjectIP + sourceIP
+}
+
+// isLockoutFailure は Deny理由がロックアウトの回数に数える失敗かを返す
+func isLockoutFailure(denyContext map[string]interface{}) bool {
+	reason, _ := denyContext["reason"].(string)
+	return slices.Contains(lockoutFailureReasons, reason)
+}
+
+// checkLockout は送信元IPがロックアウト中の場合に Denyレスポンスに含める context を返す
+// ロックアウトの状態を取得できない場合やサーキットブレーカーが開いている間は、
+// テーブルの障害で全リクエストを止めたり遅らせたりしないよう検査を省略する
+func (a *Authorizer) checkLockout(ctx context.Context, sourceIP string) map[string]interface{} {
+	subject := lockoutSubject(sourceIP)
+	if a.Lockout == nil || subject == "" {
+		return nil
+	}
+	now := a.now()
+	if !a.allowDynamoDB(now) {
+		a.count(MetricLockoutCheckSkipped, nil)
+		return nil
+	}
+	locked, err := a.Lockout.Locked(ctx, subject, now)
+	a.recordDynamoDBResult(now, err)
+	if err != nil {
+		log.Printf("[Authorizer] %v, skipping lockout check", err)
+		a.count(MetricLockoutCheckSkipped, nil)
+		return nil
+	}
+	if !locked {
+		return nil
+	}
+	log.Printf("[Authorizer] %s is locked out, returning Deny", subject)
+	return map[string]interface{}{
+		"reason": ReasonLockedOut,
+	}
+}
+
+// recordAuthFailure は認証失敗をロックアウトの回数に数える
+// サーキットブレーカーが開いている間は数えない
+func (a *Authorizer) recordAuthFailure(ctx context.Context, sourceIP string, denyContext map[string]interface{}) {
+	subject := lockoutSubject(sourceIP)
+	if a.Lockout == nil || subject == "" || !isLockoutFailure(denyContext) {
+		return
+	}
+	now := a.now()
+	if !a.allowDynamoDB(now) {
+		return
+	}
+
+	locked, err := a.Lockout.RecordFailure(ctx, subject, now)
+	a.recordDynamoDBResult(now, err)
+	if err != nil {
+		log.Printf("[Authorizer] %v", err)
+		return
+	}
+	if locked {
+		a.count(MetricLockout, nil)
+	}
+}
+
+// Locked は対象がロックアウト中かを返す
+func (g *LockoutGuard) Locked(ctx context.Context, subject string, now time.Time) (bool, error) {
+	out, err := g.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(g.TableName),
+		Key:       lockoutKey(subject),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get lockout status: %w", err)
+	}
+	if out.Item == nil {
+		return false, nil
+	}
+
+	var item lockoutItem
+	if err := attributevalue.UnmarshalMap(out.Item, &item); err != nil {
+		return false, fmt.Errorf("failed to parse lockout status: %w", err)
+	}
+	// TTL による削除は遅れることがあるため、期限も確認する
+	return now.Before(time.Unix(item.LockedUntil, 0)), nil
+}
+
+// RecordFailure は対象の認証失敗を1回数え、しきい値に達した場合はロックアウトする
+// ロックアウトすると失敗の回数を数え直す（Window が Duration より長くても、期限後の1回の失敗で再びロックアウトしない）
+// ロックアウトした場合は true を返す（既にロックアウト中の場合は false）
+func (g *LockoutGuard) RecordFailure(ctx context.Context, subject string, now time.Time) (bool, error) {
+	item, err := g.incrementFailures(ctx, subject, now)
+	if err != nil {
+		return false, err
+	}
+	if item.Failures < g.Threshold {
+		return false, nil
+	}
+
+	lockedUntil := now.Add(g.Duration)
+	_, err = g.DDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(g.TableName),
+		Key:                 lockoutKey(subject),
+		UpdateExpression:    aws.String("SET lockedUntil = :until, expiresAt = :expires, failures = :zero, windowStart = :now"),
+		ConditionExpression: aws.String("attribute_not_exists(lockedUntil) OR lockedUntil <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":until":   unixSeconds(lockedUntil),
+			":expires": unixSeconds(lockedUntil.Add(g.Window)),
+			":now":     unixSeconds(now),
+			":zero":    &types.AttributeValueMemberN{Value: "0"},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		// 同時に失敗したリクエストが先にロックアウトした
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock out %s: %w", subject, err)
+	}
+
+	log.Printf("[Authorizer] Locked out %s until %s after %d failures", subject, lockedUntil.UTC().Format(time.RFC3339), item.Failures)
+	if g.Audit != nil {
+		err := g.Audit.Record(ctx, AuditEntry{
+			Subject: subject,
+			Event:   AuditEventLockout,
+			Details: map[string]string{
+				"failures":    strconv.Itoa(item.Failures),
+				"lockedUntil": lockedUntil.UTC().Format(time.RFC3339),
+			},
+		}, now)
+		if err != nil {
+			log.Printf("[Authorizer] %v", err)
+		}
+	}
+	return true, nil
+}
+
+// incrementFailures は Window 内の認証失敗の回数を1増やす
+// Window を過ぎている場合は回数を1から数え直す
+func (g *LockoutGuard) incrementFailures(ctx context.Context, subject string, now time.Time) (*lockoutItem, error) {
+	values := map[string]types.AttributeValue{
+		":one":     &types.AttributeValueMemberN{Value: "1"},
+		":expires": unixSeconds(now.Add(g.Window + g.Duration)),
+	}
+
+	inWindow := map[string]types.AttributeValue{
+		":cutoff": unixSeconds(now.Add(-g.Window)),
+	}
+	for k, v := range values {
+		inWindow[k] = v
+	}
+	out, err := g.DDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(g.TableName),
+		Key:                       lockoutKey(subject),
+		UpdateExpression:          aws.String("ADD failures :one SET expiresAt = :expires"),
+		ConditionExpression:       aws.String("windowStart > :cutoff"),
+		ExpressionAttributeValues: inWindow,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		values[":now"] = unixSeconds(now)
+		out, err = g.DDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(g.TableName),
+			Key:                       lockoutKey(subject),
+			UpdateExpression:          aws.String("SET failures = :one, windowStart = :now, expiresAt = :expires"),
+			ExpressionAttributeValues: values,
+			ReturnValues:              types.ReturnValueAllNew,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record failure for %s: %w", subject, err)
+	}
+
+	var item lockoutItem
+	if err := attributevalue.UnmarshalMap(out.Attributes, &item); err != nil {
+		return nil, fmt.Errorf("failed to parse failures for %s: %w", subject, err)
+	}
+	return &item, nil
+}
+
+func lockoutKey(subject string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"subject": &types.AttributeValueMemberS{Value: subject},
+	}
+}
+
+func unixSeconds(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.Unix(), 10)}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLockoutGuard(threshold int) *LockoutGuard {
+	return &LockoutGuard{
+		TableName: TestLockoutTableName,
+		DDBClient: testDDBClient,
+		Threshold: threshold,
+		Window:    time.Minute,
+		Duration:  10 * time.Minute,
+		Audit:     &AuditLog{TableName: TestAuditTableName, DDBClient: testDDBClient},
+	}
+}
+
+func Test_認証失敗がしきい値に達した送信元IPはロックアウトされること(t *testing.T) {
+	validToken := testutil.GenerateUniqueID("lockout-valid")
+	assert.NoError(t, putTestToken(validToken, true))
+	defer deleteTestToken(validToken)
+
+	now := time.Unix(1_700_000_000, 0)
+	metrics := &recordingMetrics{}
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		Lockout:   newTestLockoutGuard(3),
+		Metrics:   metrics,
+		Now:       func() time.Time { return now },
+	}
+	sourceIP := testutil.GenerateUniqueID("198.51.100")
+	request := func(token string) events.APIGatewayCustomAuthorizerResponse {
+		t.Helper()
+		event := events.APIGatewayCustomAuthorizerRequestTypeRequest{
+			MethodArn: testMethodArn,
+			Headers:   map[string]string{"Authorization": "Bearer " + token},
+		}
+		event.RequestContext.Identity.SourceIP = sourceIP
+		resp, err := auth.RequestHandler(context.Background(), event)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	// しきい値未満の失敗ではロックアウトされない
+	for range 2 {
+		resp := request(testutil.GenerateUniqueID("guess"))
+		assert.Equal(t, "token_not_found", resp.Context["reason"])
+	}
+	assert.Equal(t, "Allow", request(validToken).PolicyDocument.Statement[0].Effect)
+
+	// 3回目の失敗でロックアウトされ、有効なトークンでもDenyになる
+	request(testutil.GenerateUniqueID("guess"))
+	resp := request(validToken)
+	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+	assert.Equal(t, ReasonLockedOut, resp.Context["reason"])
+	assert.Equal(t, []recordedMetric{{Name: MetricLockout}}, metrics.records)
+
+	entries := auditEntries(t, "ip#"+sourceIP)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, AuditEventLockout, entries[0].Event)
+		assert.Equal(t, "3", entries[0].Details["failures"])
+	}
+
+	// ロックアウトの期限を過ぎると再び許可される
+	now = now.Add(10 * time.Minute)
+	assert.Equal(t, "Allow", request(validToken).PolicyDocument.Statement[0].Effect)
+}
+
+func Test_期間を過ぎた認証失敗は数え直されること(t *testing.T) {
+	guard := newTestLockoutGuard(2)
+	subject := testutil.GenerateUniqueID("ip#window")
+	now := time.Unix(1_700_000_000, 0)
+
+	locked, err := guard.RecordFailure(context.Background(), subject, now)
+	assert.NoError(t, err)
+	assert.False(t, locked)
+
+	// Window を過ぎた2回目の失敗は1回目として数える
+	locked, err = guard.RecordFailure(context.Background(), subject, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, locked)
+
+	locked, err = guard.RecordFailure(context.Background(), subject, now.Add(90*time.Second))
+	assert.NoError(t, err)
+	assert.True(t, locked)
+
+	locked, err = guard.RecordFailure(context.Background(), subject, now.Add(100*time.Second))
+	assert.NoError(t, err)
+	assert.False(t, locked, "既にロックアウト中の場合は再度ロックアウトしない")
+}
+
+func Test_ロックアウトの期限後は認証失敗を数え直すこと(t *testing.T) {
+	// Window が Duration より長い場合
+	guard := newTestLockoutGuard(2)
+	guard.Window = time.Hour
+	subject := testutil.GenerateUniqueID("ip#relock")
+	now := time.Unix(1_700_000_000, 0)
+
+	for i, want := range []bool{false, true} {
+		locked, err := guard.RecordFailure(context.Background(), subject, now.Add(time.Duration(i)*time.Second))
+		assert.NoError(t, err)
+		assert.Equal(t, want, locked)
+	}
+
+	// 期限後の1回の失敗ではロックアウトされない
+	afterLockout := now.Add(guard.Duration + time.Minute)
+	locked, err := guard.RecordFailure(context.Background(), subject, afterLockout)
+	assert.NoError(t, err)
+	assert.False(t, locked)
+	locked, err = guard.Locked(context.Background(), subject, afterLockout)
+	assert.NoError(t, err)
+	assert.False(t, locked)
+
+	// しきい値に達すると再びロックアウトされる
+	locked, err = guard.RecordFailure(context.Background(), subject, afterLockout.Add(time.Second))
+	assert.NoError(t, err)
+	assert.True(t, locked)
+}
+
+func Test_送信元IPのないTOKENタイプではロックアウトしないこと(t *testing.T) {
+	validToken := testutil.GenerateUniqueID("lockout-token-type")
+	assert.NoError(t, putTestToken(validToken, true))
+	defer deleteTestToken(validToken)
+
+	metrics := &recordingMetrics{}
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		Lockout:   newTestLockoutGuard(1),
+		Metrics:   metrics,
+	}
+
+	// トークン先頭は数えないため、同じ先頭の未登録トークンで正規のトークンがロックアウトされることもない
+	for range 3 {
+		resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+			AuthorizationToken: "Bearer " + validToken[:8] + "-guess",
+			MethodArn:          testMethodArn,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "token_not_found", resp.Context["reason"])
+	}
+
+	resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + validToken,
+		MethodArn:          testMethodArn,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+	assert.Empty(t, metrics.records)
+}
+
+func Test_ロックアウトの状態を取得できない場合は検査を省略すること(t *testing.T) {
+	guard := newTestLockoutGuard(1)
+	guard.DDBClient = unreachableDDBClient()
+	metrics := &recordingMetrics{}
+	auth := &Authorizer{Lockout: guard, Metrics: metrics}
+
+	assert.Nil(t, auth.checkLockout(context.Background(), "192.0.2.1"))
+	assert.Equal(t, []recordedMetric{{Name: MetricLockoutCheckSkipped}}, metrics.records)
+}
+
+func Test_サーキットブレーカーが開いている間はロックアウトのテーブルを呼び出さないこと(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	guard := newTestLockoutGuard(1)
+	guard.DDBClient = unreachableDDBClient()
+	metrics := &recordingMetrics{}
+	auth := &Authorizer{
+		Lockout: guard,
+		Breaker: &CircuitBreaker{FailureThreshold: 1, OpenDuration: time.Minute},
+		Metrics: metrics,
+		Now:     func() time.Time { return now },
+	}
+
+	// ロックアウトのテーブルの失敗でもブレーカーが開く
+	assert.Nil(t, auth.checkLockout(context.Background(), "192.0.2.1"))
+	assert.False(t, auth.Breaker.Allow(now))
+
+	// 開いている間は呼び出さずに検査を省略し、認証失敗も数えない
+	guard.DDBClient = nil
+	assert.Nil(t, auth.checkLockout(context.Background(), "192.0.2.1"))
+	auth.recordAuthFailure(context.Background(), "192.0.2.1", map[string]interface{}{"reason": "token_not_found"})
+
+	assert.Equal(t, []recordedMetric{
+		{Name: MetricCircuitBreakerOpen},
+		{Name: MetricLockoutCheckSkipped},
+		{Name: MetricLockoutCheckSkipped},
+	}, metrics.records)
+}
+
+func Test_ロックアウトの環境変数が読み込まれること(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold string
+		window    string
+		want      *LockoutGuard
+		wantErr   string
+	}{
+		{"未設定の場合はデフォルト値", "", "", &LockoutGuard{Threshold: DefaultLockoutThreshold, Window: DefaultLockoutWindow, Duration: DefaultLockoutDuration}, ""},
+		{"0の場合は無効", "0", "", nil, ""},
+		{"不正なしきい値", "-1", "", nil, `invalid AUTHZ_LOCKOUT_THRESHOLD: "-1"`},
+		{"期間が0", "5", "0", nil, "must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AUTHZ_LOCKOUT_THRESHOLD", tt.threshold)
+			t.Setenv("AUTHZ_LOCKOUT_WINDOW_SECONDS", tt.window)
+			t.Setenv("AUTHZ_LOCKOUT_DURATION_SECONDS", "")
+
+			guard, err := NewLockoutGuardFromEnv(nil, nil)
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.want == nil {
+				assert.Nil(t, guard)
+				return
+			}
+			assert.Equal(t, tt.want.Threshold, guard.Threshold)
+			assert.Equal(t, tt.want.Window, guard.Window)
+			assert.Equal(t, tt.want.Duration, guard.Duration)
+		})
+	}
+}
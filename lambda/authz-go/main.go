@@ -2,9 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
+	"os"
+	"slices"
 	"strings"
+	"time"
+
+	"local-gateway/lambda/internaltoken"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -21,23 +28,167 @@ const DefaultTableName = "AllowedTokens"
 type Authorizer struct {
 	TableName string
 	DDBClient *dynamodb.Client
+	// Preloader はメモリに読み込んだトークン（nil の場合はリクエストごとに GetItem する）
+	Preloader *TokenPreloader
+	// Cache は DynamoDB から取得したトークン項目のキャッシュ（nil の場合は縮退運転を行わない）
+	Cache *RecordCache
+	// Breaker は DynamoDB 障害時に呼び出しを止めるサーキットブレーカー（nil の場合は無効）
+	Breaker *CircuitBreaker
+	// Introspector は外部認可サーバー発行トークンの検証に使う（nil の場合は無効）
+	Introspector *IntrospectionValidator
+	// Authenticators は資格情報の種類ごとの認証方式（nil の場合は DynamoDB の不透明トークンのみ）
+	Authenticators AuthenticatorChain
+	// Roles はロールとスコープの対応（nil の場合はロールをスコープに展開しない）
+	Roles *RoleMapping
+	// Rules はルート単位の認可ルール（nil の場合はルール評価を行わない）
+	Rules *RuleSet
+	// ShadowRules は判定に使わず結果の比較だけを行う候補ルール（nil の場合はシャドー評価を行わない）
+	ShadowRules *RuleSet
+	// Metrics はメトリクスの送信先（nil の場合は記録しない）
+	Metrics Metrics
+	// Lockout は認証失敗が続く呼び出し元のロックアウト（nil の場合は無効）
+	Lockout *LockoutGuard
+	// Audit は監査ログの書き込み先（nil の場合はなりすましを受け付けない）
+	Audit *AuditLog
+	// TenantAPIKeys はテナントごとの usage plan の API キー（nil の場合はトークンの apiKey 属性のみを使う）
+	TenantAPIKeys TenantAPIKeys
+	// InternalToken はバックエンドに渡す内部トークンの発行（nil の場合は context に internalToken を含めない）
+	InternalToken *internaltoken.Signer
+	// WebSocketTokenQueryParam は WebSocket $connect でトークンを渡すクエリパラメータ名（空の場合は "token"）
+	WebSocketTokenQueryParam string
+	// Now は現在時刻を返す（テスト用に差し替え可能、nil の場合は time.Now）
+	Now func() time.Time
 }
 
 // NewAuthorizer はAuthorizerを作成する
 // DynamoDBのエンドポイントは環境変数 AWS_ENDPOINT_URL_DYNAMODB で設定可能（LocalStack用）
+// 環境変数 INTROSPECTION_ENDPOINT を設定するとトークンイントロスペクションが有効になる
+// 認可ルールは AUTHZ_RULES_FILE（未設定時は埋め込みの rules.json）から読み込み、不正な場合は起動に失敗する
+// ロール定義も同様に AUTHZ_ROLES_FILE（未設定時は埋め込みの roles.json）から読み込む
+// 認証方式は AUTHENTICATOR_CHAIN（カンマ区切り、未設定時は opaque のみ）の順に評価し、最初に資格情報を認識したもので検証する
+// WebSocket $connect のトークンを渡すクエリパラメータ名は WEBSOCKET_TOKEN_QUERY_PARAM で変更できる
+// AUTHZ_SHADOW_RULES_FILE を設定すると候補ルールをシャドー評価し、判定の食い違いを記録する
+// PRELOAD_TOKENS=true の場合はトークンをメモリに読み込む（上限を超える場合は GetItem にフォールバック）
+// DynamoDB 障害時は AUTHZ_CACHE_MAX_STALE_SECONDS まで直近に取得したトークン項目で認可を続ける（縮退運転）
+// 送信元IPごとの認証失敗が AUTHZ_LOCKOUT_THRESHOLD に達するとロックアウトし、監査ログに記録する（REQUEST タイプのみ）
+// impersonate スコープを持つトークンは X-Act-As-Company ヘッダーで別テナントとして呼び出せる（監査ログに記録）
+// INTERNAL_TOKEN_SIGNING_KEY を設定すると、Allow時にバックエンドが検証できる内部トークンを context に含める
+// AUTHZ_TENANT_API_KEYS を設定すると、apiKey 属性のないトークンにテナントの usage plan の API キーを使う
 func NewAuthorizer(ctx context.Context) (*Authorizer, error) {
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	return &Authorizer{
-		TableName: DefaultTableName,
-		DDBClient: dynamodb.NewFromConfig(cfg),
-	}, nil
+	ddb := dynamodb.NewFromConfig(cfg)
+
+	preloader, err := NewTokenPreloaderFromEnv(ddb, DefaultTableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure token preload: %w", err)
+	}
+	if preloader != nil {
+		loaded, err := preloader.Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to preload tokens: %w", err)
+		}
+		if loaded {
+			log.Printf("[Authorizer] Preloaded tokens into memory")
+		} else {
+			log.Printf("[Authorizer] Token table exceeds %d items, falling back to GetItem", preloader.MaxItems)
+			preloader = nil
+		}
+	}
+
+	cache, err := NewRecordCacheFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure record cache: %w", err)
+	}
+
+	breaker, err := NewCircuitBreakerFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure circuit breaker: %w", err)
+	}
+
+	introspector, err := NewIntrospectionValidatorFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure introspection: %w", err)
+	}
+
+	roles, err := LoadRoleMapping()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+
+	rules, err := LoadRuleSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load authorization rules: %w", err)
+	}
+
+	shadowRules, err := LoadShadowRuleSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load shadow authorization rules: %w", err)
+	}
+
+	internalToken, err := internaltoken.NewSignerFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure internal token: %w", err)
+	}
+	if internalToken == nil {
+		log.Printf("[Authorizer] INTERNAL_TOKEN_SIGNING_KEY is not set, internal tokens will not be issued")
+	}
+
+	tenantAPIKeys, err := NewTenantAPIKeysFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	audit := &AuditLog{TableName: DefaultAuditTableName, DDBClient: ddb}
+	lockout, err := NewLockoutGuardFromEnv(ddb, audit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure lockout: %w", err)
+	}
+
+	auth := &Authorizer{
+		TableName:    DefaultTableName,
+		DDBClient:    ddb,
+		Preloader:    preloader,
+		Cache:        cache,
+		Breaker:      breaker,
+		Introspector: introspector,
+		Roles:        roles,
+		Rules:        rules,
+		ShadowRules:  shadowRules,
+		Metrics:      NewEMFMetrics(),
+		Lockout:      lockout,
+		Audit:        audit,
+
+		TenantAPIKeys: tenantAPIKeys,
+		InternalToken: internalToken,
+
+		WebSocketTokenQueryParam: os.Getenv("WEBSOCKET_TOKEN_QUERY_PARAM"),
+	}
+
+	// opaque / hmac 等は Authorizer の DynamoDB 検索を使うため、Authorizer の作成後に組み立てる
+	auth.Authenticators, err = NewAuthenticatorChainFromEnv(auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure authenticators: %w", err)
+	}
+	return auth, nil
 }
 
+func (a *Authorizer) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
+
+// generatePolicy は IAM ポリシーを生成する
+// context が API Gateway の制約（ValidateContext）を満たさない場合はエラーを返す
 func generatePolicy(principalID, effect, methodArn string, ctx map[string]interface{}) (events.APIGatewayCustomAuthorizerResponse, error) {
+	if err := ValidateContext(ctx); err != nil {
+		return events.APIGatewayCustomAuthorizerResponse{}, fmt.Errorf("invalid authorizer context: %w", err)
+	}
 	return events.APIGatewayCustomAuthorizerResponse{
 		PrincipalID: principalID,
 		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
@@ -54,9 +205,82 @@ func generatePolicy(principalID, effect, methodArn string, ctx map[string]interf
 	}, nil
 }
 
-// Handler はAPIGateway Lambda Authorizerのハンドラ
+// authRequest は TOKEN / REQUEST タイプのイベントを共通化した認可リクエスト
+type authRequest struct {
+	AuthorizationToken string
+	MethodArn          string
+	// Headers はヘッダー名を小文字に正規化したリクエストヘッダー（TOKENタイプでは空）
+	Headers  map[string]string
+	SourceIP string
+	// ClientCert は mTLS のクライアント証明書（mTLS でない場合は nil）
+	ClientCert *events.APIGatewayCustomAuthorizerRequestTypeRequestIdentityClientCert
+}
+
+// Invoke は Lambda のエントリポイントで、イベントの type に応じてハンドラを振り分ける
+// REQUEST タイプのうち WebSocket API の $connect は WebSocketConnectHandler で処理する
+func (a *Authorizer) Invoke(ctx context.Context, payload json.RawMessage) (events.APIGatewayCustomAuthorizerResponse, error) {
+	var probe struct {
+		Type           string                         `json:"type"`
+		RequestContext WebSocketConnectRequestContext `json:"requestContext"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return events.APIGatewayCustomAuthorizerResponse{}, fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	if probe.Type == "REQUEST" && isWebSocketConnect(probe.RequestContext) {
+		var event WebSocketConnectEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return events.APIGatewayCustomAuthorizerResponse{}, fmt.Errorf("failed to decode WebSocket $connect event: %w", err)
+		}
+		return a.WebSocketConnectHandler(ctx, event)
+	}
+
+	if probe.Type == "REQUEST" {
+		var event events.APIGatewayCustomAuthorizerRequestTypeRequest
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return events.APIGatewayCustomAuthorizerResponse{}, fmt.Errorf("failed to decode REQUEST event: %w", err)
+		}
+		return a.RequestHandler(ctx, event)
+	}
+
+	var event events.APIGatewayCustomAuthorizerRequest
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return events.APIGatewayCustomAuthorizerResponse{}, fmt.Errorf("failed to decode TOKEN event: %w", err)
+	}
+	return a.Handler(ctx, event)
+}
+
+// Handler はAPIGateway Lambda Authorizer（TOKENタイプ）のハンドラ
 func (a *Authorizer) Handler(ctx context.Context, event events.APIGatewayCustomAuthorizerRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
-	raw := strings.TrimSpace(event.AuthorizationToken)
+	return a.authorize(ctx, authRequest{
+		AuthorizationToken: event.AuthorizationToken,
+		MethodArn:          event.MethodArn,
+	})
+}
+
+// RequestHandler はAPIGateway Lambda Authorizer（REQUESTタイプ）のハンドラ
+// トークンは Authorization ヘッダーから取得し、ヘッダーと送信元IPはルールの条件式で参照できる
+// mTLS が有効な場合はクライアント証明書も認証に使える
+func (a *Authorizer) RequestHandler(ctx context.Context, event events.APIGatewayCustomAuthorizerRequestTypeRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	headers := make(map[string]string, len(event.Headers))
+	for k, v := range event.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+
+	req := authRequest{
+		AuthorizationToken: headers["authorization"],
+		MethodArn:          event.MethodArn,
+		Headers:            headers,
+		SourceIP:           event.RequestContext.Identity.SourceIP,
+	}
+	if cert := event.RequestContext.Identity.ClientCert; cert.SubjectDN != "" {
+		req.ClientCert = &cert
+	}
+	return a.authorize(ctx, req)
+}
+
+func (a *Authorizer) authorize(ctx context.Context, req authRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	raw := strings.TrimSpace(req.AuthorizationToken)
 	// WARNING: 本番環境では機密情報をログに出力しないこと
 	// 開発/検証用のダミートークンのみ使用する前提でログ出力しています
 	// 本番移植時は log.Printf("[Authorizer] Token received (length: %d)", len(raw)) に変更してください
@@ -70,9 +294,180 @@ func (a *Authorizer) Handler(ctx context.Context, event events.APIGatewayCustomA
 	// 本番移植時はこの行を削除するか、log.Printf("[Authorizer] Token extracted (length: %d)", len(token)) に変更してください
 	log.Printf("[Authorizer] Extracted token: %q", token)
 
-	if token == "" {
-		log.Printf("[Authorizer] Token is empty, returning Deny")
-		return generatePolicy("anonymous", "Deny", event.MethodArn, nil)
+	// ロックアウト中の呼び出し元はトークンを検索せずにDenyする
+	if denyContext := a.checkLockout(ctx, req.SourceIP); denyContext != nil {
+		return generatePolicy("anonymous", "Deny", req.MethodArn, denyContext)
+	}
+
+	cred := &Credential{
+		Token:         token,
+		Authorization: raw,
+		Headers:       req.Headers,
+		ClientCert:    req.ClientCert,
+		MethodArn:     req.MethodArn,
+	}
+	identity, denyContext, recognized := a.authenticators().Authenticate(ctx, cred)
+	if !recognized {
+		if raw == "" {
+			log.Printf("[Authorizer] Token is empty, returning Deny")
+			return generatePolicy("anonymous", "Deny", req.MethodArn, nil)
+		}
+		log.Printf("[Authorizer] No authenticator recognized the credential, returning Deny")
+		denyContext = map[string]interface{}{
+			"reason": "unsupported_credential",
+		}
+		a.recordAuthFailure(ctx, req.SourceIP, denyContext)
+		return generatePolicy("anonymous", "Deny", req.MethodArn, denyContext)
+	}
+	if identity == nil {
+		a.recordAuthFailure(ctx, req.SourceIP, denyContext)
+		// 認証できない呼び出し元は特定できないため anonymous とする
+		return generatePolicy("anonymous", "Deny", req.MethodArn, denyContext)
+	}
+	if a.Roles != nil {
+		a.Roles.Expand(identity)
+	}
+
+	// なりすましはスコープ展開後に検査し、以降の検査・ルール評価はなりすまし先のテナントで行う
+	if denyContext := a.applyActAs(ctx, req, identity); denyContext != nil {
+		return generatePolicy(identity.PrincipalID(), "Deny", req.MethodArn, denyContext)
+	}
+
+	// ルール（候補ルールのシャドー評価を含む）は制限の検査より先に評価する
+	// 制限でDenyするリクエストでも候補ルールとの比較を記録するため（判定は制限の結果を優先する）
+	decision, err := a.evaluateRules(req, identity)
+
+	if denyContext := a.checkRestrictions(req, identity); denyContext != nil {
+		return generatePolicy(identity.PrincipalID(), "Deny", req.MethodArn, denyContext)
+	}
+
+	if err != nil {
+		log.Printf("[Authorizer] %v, returning Deny", err)
+		return generatePolicy(identity.PrincipalID(), "Deny", req.MethodArn, map[string]interface{}{
+			"reason": "invalid_method_arn",
+		})
+	}
+	if !decision.Allowed {
+		return generatePolicy(identity.PrincipalID(), "Deny", req.MethodArn, ruleDenyContext(decision))
+	}
+
+	authCtx, err := a.authContext(identity)
+	if err != nil {
+		// context が不正だと API Gateway はレスポンスを破棄するため、原因をログに残してDenyする
+		log.Printf("[Authorizer] Failed to build authorizer context: %v, returning Deny", err)
+		return generatePolicy(identity.PrincipalID(), "Deny", req.MethodArn, map[string]interface{}{
+			"error": "invalid_context",
+		})
+	}
+
+	log.Printf("[Authorizer] Token is valid, returning Allow")
+	resp, err := generatePolicy(identity.PrincipalID(), "Allow", req.MethodArn, authCtx)
+	// api_key_source = AUTHORIZER の場合、API Gateway はこのキーで usage plan を適用する
+	resp.UsageIdentifierKey = a.usageIdentifierKey(identity)
+	return resp, err
+}
+
+// lookupRecord は DynamoDB からトークン項目を取得して TokenRecord に変換する（存在しない場合は nil）
+// 取得・変換に失敗した場合は Denyレスポンスに含める context を返す
+func (a *Authorizer) lookupRecord(ctx context.Context, key string) (*TokenRecord, bool, map[string]interface{}) {
+	item, degraded, err := a.getTokenItem(ctx, key)
+	if err != nil {
+		log.Printf("[Authorizer] DynamoDB GetItem error: %v", err)
+		return nil, false, map[string]interface{}{
+			"error": "ddb_get_failed",
+		}
+	}
+	if item == nil {
+		return nil, false, nil
+	}
+
+	rec, err := parseTokenRecord(item)
+	if err != nil {
+		log.Printf("[Authorizer] %v, returning Deny", err)
+		return nil, false, map[string]interface{}{
+			"error": "invalid_token_record",
+		}
+	}
+	return rec, degraded, nil
+}
+
+// identityFromActiveRecord は有効なトークン項目から Identity を作成する
+// 無効化・猶予期間切れのトークンは Identity が nil となり、Denyレスポンスに含める context を返す
+func (a *Authorizer) identityFromActiveRecord(rec *TokenRecord, degraded bool) (*Identity, map[string]interface{}) {
+	log.Printf("[Authorizer] Token found in DynamoDB, checking active status")
+	if !rec.IsActive() {
+		log.Printf("[Authorizer] Token is inactive, returning Deny")
+		return nil, nil
+	}
+
+	identity := identityFromRecord(rec)
+	if rec.ReplacedBy != "" {
+		if !a.now().Before(time.Unix(rec.GraceExpiresAt, 0)) {
+			log.Printf("[Authorizer] Token was rotated and its grace period has ended, returning Deny")
+			return nil, map[string]interface{}{
+				"reason": "token_rotated",
+			}
+		}
+		log.Printf("[Authorizer] Token was rotated, accepting it until the grace period ends")
+		identity.RotationPending = true
+	}
+	identity.Degraded = degraded
+
+	return identity, nil
+}
+
+// getTokenItem はトークンの項目を返す（存在しない場合は nil）
+// プリロードが有効な場合はメモリ上の項目を使い、見つからない場合のみ GetItem する
+// DynamoDB を呼び出せない場合は MaxStale 内のキャッシュを使い、degraded が true になる
+func (a *Authorizer) getTokenItem(ctx context.Context, token string) (item map[string]types.AttributeValue, degraded bool, err error) {
+	if a.Preloader != nil {
+		if item, found := a.Preloader.Lookup(ctx, token); found {
+			return item, false, nil
+		}
+	}
+
+	now := a.now()
+	if a.Cache != nil {
+		if item, ok := a.Cache.Fresh(token, now); ok {
+			return item, false, nil
+		}
+	}
+
+	item, err = a.fetchTokenItem(ctx, token)
+	if err != nil {
+		if a.Cache != nil {
+			if item, ok := a.Cache.Stale(token, now); ok {
+				log.Printf("[Authorizer][Degraded] DynamoDB unavailable (%v), using cached token record", err)
+				a.count(MetricDegradedDecision, nil)
+				return item, true, nil
+			}
+		}
+		return nil, false, err
+	}
+
+	if a.Cache != nil {
+		// 未登録・無効（active=false）になったトークンは縮退運転でも許可しない
+		if item == nil || !isActiveItem(item) {
+			a.Cache.Delete(token)
+		} else {
+			a.Cache.Put(token, item, now)
+		}
+	}
+	return item, false, nil
+}
+
+// isActiveItem はトークンの項目が無効化（active=false）されていないかを返す（TokenRecord.IsActive と同じ判定）
+func isActiveItem(item map[string]types.AttributeValue) bool {
+	active, ok := item["active"].(*types.AttributeValueMemberBOOL)
+	return !ok || active.Value
+}
+
+// fetchTokenItem は DynamoDB からトークンの項目を取得する
+// サーキットブレーカーが開いている間は呼び出さずにエラーを返す
+func (a *Authorizer) fetchTokenItem(ctx context.Context, token string) (map[string]types.AttributeValue, error) {
+	now := a.now()
+	if !a.allowDynamoDB(now) {
+		return nil, errCircuitOpen
 	}
 
 	out, err := a.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
@@ -84,39 +479,103 @@ func (a *Authorizer) Handler(ctx context.Context, event events.APIGatewayCustomA
 		// 本番環境で強整合性が必要な場合は aws.Bool(true) に変更
 		ConsistentRead: aws.Bool(false),
 	})
+	a.recordDynamoDBResult(now, err)
 	if err != nil {
-		log.Printf("[Authorizer] DynamoDB GetItem error: %v", err)
-		return generatePolicy("user", "Deny", event.MethodArn, map[string]interface{}{
-			"error": "ddb_get_failed",
-		})
+		return nil, err
 	}
+	return out.Item, nil
+}
 
-	if out.Item == nil {
-		log.Printf("[Authorizer] Token not found in DynamoDB, returning Deny")
-		return generatePolicy("user", "Deny", event.MethodArn, map[string]interface{}{
-			"reason": "token_not_found",
-		})
-	}
+// allowDynamoDB はサーキットブレーカーが DynamoDB の呼び出しを許可しているかを返す
+func (a *Authorizer) allowDynamoDB(now time.Time) bool {
+	return a.Breaker == nil || a.Breaker.Allow(now)
+}
 
-	log.Printf("[Authorizer] Token found in DynamoDB, checking active status")
-	if v, ok := out.Item["active"].(*types.AttributeValueMemberBOOL); ok && v.Value == false {
-		log.Printf("[Authorizer] Token is inactive, returning Deny")
-		return generatePolicy("user", "Deny", event.MethodArn, nil)
+// recordDynamoDBResult は DynamoDB の呼び出し結果をサーキットブレーカーに記録する
+func (a *Authorizer) recordDynamoDBResult(now time.Time, err error) {
+	if a.Breaker == nil {
+		return
+	}
+	if err == nil {
+		a.Breaker.Success()
+		return
 	}
+	if a.Breaker.Failure(now) {
+		log.Printf("[Authorizer][Degraded] Circuit breaker opened for %s", a.Breaker.OpenDuration)
+		a.count(MetricCircuitBreakerOpen, nil)
+	}
+}
 
-	log.Printf("[Authorizer] Token is valid, returning Allow")
+// introspect は外部認可サーバーのイントロスペクション結果でトークンを検証する
+func (a *Authorizer) introspect(ctx context.Context, token string) (*Identity, map[string]interface{}) {
+	result, reason, err := a.Introspector.Validate(ctx, token)
+	if err != nil {
+		log.Printf("[Authorizer] Introspection error: %v", err)
+		return nil, map[string]interface{}{
+			"error": "introspection_failed",
+		}
+	}
 
-	// Contextに追加情報を含める
-	// TODO: 本番環境ではDynamoDBから取得するように変更
-	authContext := map[string]interface{}{
-		"token":         token, // WARNING: 本番環境では削除
-		"companyId":     "12345",
-		"scope":         "read:stores",
-		"internalToken": "internal_abc",
+	if reason != "" {
+		log.Printf("[Authorizer] Introspection rejected token (%s), returning Deny", reason)
+		return nil, map[string]interface{}{
+			"reason": reason,
+		}
 	}
 
+	log.Printf("[Authorizer] Token is active by introspection")
+	return identityFromIntrospection(token, result), nil
+}
+
+// ruleDenyContext はルールでDenyされた場合の context を返す
+func ruleDenyContext(d RuleDecision) map[string]interface{} {
+	if d.RuleID == "" {
+		return map[string]interface{}{"reason": d.Reason}
+	}
+	return map[string]interface{}{
+		"reason":     "rule_failed",
+		"rule":       d.RuleID,
+		"ruleDetail": d.Reason,
+	}
+}
 
-	return generatePolicy("user", "Allow", event.MethodArn, authContext)
+// authContext はAllow時にバックエンドへ渡す context を返す
+// scope / roles はスペース区切りの文字列として渡す
+func (a *Authorizer) authContext(id *Identity) (map[string]interface{}, error) {
+	b := NewContextBuilder().
+		List("scope", id.Scopes).
+		StringIfSet("companyId", id.CompanyID).
+		StringIfSet("clientId", id.ClientID).
+		StringIfSet("userId", id.UserID).
+		StringIfSet("actor", id.Actor).
+		StringIfSet("actorCompanyId", id.ActorCompanyID)
+	if a.InternalToken != nil {
+		// バックエンドは X-Company-Id 等のヘッダーではなく、内部トークンのクレームを信頼する
+		token, err := a.InternalToken.Sign(id.PrincipalID(), internaltoken.Claims{
+			CompanyID: id.CompanyID,
+			Scope:     strings.Join(id.Scopes, ContextListSeparator),
+			Actor:     id.Actor,
+		}, a.now())
+		if err != nil {
+			return nil, err
+		}
+		b.String("internalToken", token)
+	}
+	if len(id.Roles) > 0 {
+		b.List("roles", id.Roles)
+	}
+	for _, k := range slices.Sorted(maps.Keys(id.Claims)) {
+		b.String(k, id.Claims[k])
+	}
+	if id.Degraded {
+		// DynamoDB 障害時にキャッシュ済みのトークン項目で認可したことを示す
+		b.Bool("degraded", true)
+	}
+	if id.RotationPending {
+		// バックエンドが Deprecation ヘッダー等で新トークンへの切り替えを促せるようにする
+		b.Bool("token_rotation_pending", true)
+	}
+	return b.Build()
 }
 
 func main() {
@@ -125,5 +584,5 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to initialize authorizer: %v", err)
 	}
-	lambda.Start(auth.Handler)
+	lambda.Start(auth.HandleEvent)
 }
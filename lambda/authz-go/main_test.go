@@ -4,8 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"local-gateway/lambda/internaltoken"
 	"local-gateway/lambda/testutil"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -14,12 +18,32 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-const TestTableName = "AllowedTokens_Test"
+const (
+	TestTableName        = "AllowedTokens_Test"
+	TestLockoutTableName = "AuthFailures_Test"
+	TestAuditTableName   = "AuthzAuditLog_Test"
+)
 
 var testDDBClient *dynamodb.Client
 var testAuthorizer *Authorizer
 var testMethodArn string
 
+// 内部トークンの署名・検証（テスト用の鍵）
+var (
+	testInternalTokenKey    = []byte(strings.Repeat("k", internaltoken.MinKeyLength))
+	testInternalTokenSigner = &internaltoken.Signer{
+		Key:      testInternalTokenKey,
+		Issuer:   internaltoken.DefaultIssuer,
+		Audience: internaltoken.DefaultAudience,
+		TTL:      internaltoken.DefaultTTL,
+	}
+	testInternalTokenVerifier = &internaltoken.Verifier{
+		Key:      testInternalTokenKey,
+		Issuer:   internaltoken.DefaultIssuer,
+		Audience: internaltoken.DefaultAudience,
+	}
+)
+
 func TestMain(m *testing.M) {
 	ctx := context.Background()
 
@@ -40,22 +64,31 @@ func TestMain(m *testing.M) {
 
 	// テスト用Authorizerを作成（DIパターン）
 	testAuthorizer = &Authorizer{
-		TableName: TestTableName,
-		DDBClient: testDDBClient,
+		TableName:     TestTableName,
+		DDBClient:     testDDBClient,
+		InternalToken: testInternalTokenSigner,
 	}
 
 	// テスト用テーブル作成
-	schema := testutil.NewSimpleTableSchema(TestTableName, "token", types.ScalarAttributeTypeS)
-	if err := testutil.EnsureTable(ctx, testDDBClient, schema); err != nil {
-		fmt.Printf("Failed to setup test table: %v\n", err)
-		os.Exit(1)
+	schemas := []testutil.TableSchema{
+		testutil.NewSimpleTableSchema(TestTableName, "token", types.ScalarAttributeTypeS),
+		testutil.NewSimpleTableSchema(TestLockoutTableName, "subject", types.ScalarAttributeTypeS),
+		auditTableSchema(TestAuditTableName),
+	}
+	for _, schema := range schemas {
+		if err := testutil.EnsureTable(ctx, testDDBClient, schema); err != nil {
+			fmt.Printf("Failed to setup test table: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	// 全テスト実行
 	code := m.Run()
 
 	// テスト用テーブル削除
-	testutil.DeleteTable(ctx, testDDBClient, TestTableName)
+	for _, schema := range schemas {
+		testutil.DeleteTable(ctx, testDDBClient, schema.TableName)
+	}
 
 	os.Exit(code)
 }
@@ -70,6 +103,18 @@ func putTestToken(token string, active bool) error {
 	return testutil.PutItem(ctx, testDDBClient, TestTableName, item)
 }
 
+// ヘルパー関数: 追加属性付きのテストトークンを投入
+func putTestRecord(token string, attrs map[string]types.AttributeValue) error {
+	ctx := context.Background()
+	item := map[string]types.AttributeValue{
+		"token": &types.AttributeValueMemberS{Value: token},
+	}
+	for k, v := range attrs {
+		item[k] = v
+	}
+	return testutil.PutItem(ctx, testDDBClient, TestTableName, item)
+}
+
 // ヘルパー関数: テストトークンを削除
 func deleteTestToken(token string) error {
 	ctx := context.Background()
@@ -146,7 +191,7 @@ func Test_存在しないトークンの場合はDenyを返すこと(t *testing.
 	resp, err := testAuthorizer.Handler(context.Background(), event)
 
 	assert.NoError(t, err)
-	assert.Equal(t, "user", resp.PrincipalID)
+	assert.Equal(t, "anonymous", resp.PrincipalID)
 	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
 	assert.Equal(t, "token_not_found", resp.Context["reason"])
 }
@@ -165,7 +210,7 @@ func Test_非アクティブなトークンの場合はDenyを返すこと(t *te
 	resp, err := testAuthorizer.Handler(context.Background(), event)
 
 	assert.NoError(t, err)
-	assert.Equal(t, "user", resp.PrincipalID)
+	assert.Equal(t, "anonymous", resp.PrincipalID)
 	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
 }
 
@@ -183,14 +228,21 @@ func Test_有効なトークンの場合はAllowを返すこと(t *testing.T) {
 	resp, err := testAuthorizer.Handler(context.Background(), event)
 
 	assert.NoError(t, err)
-	assert.Equal(t, "user", resp.PrincipalID)
+	assert.Equal(t, "token:"+cacheKey(testToken)[:16], resp.PrincipalID)
 	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
-	assert.Equal(t, testToken, resp.Context["token"])
+	assert.NotContains(t, resp.Context, "token", "生のトークンは context に含めない")
 
 	// contextにハードコードされた値が含まれることを確認
 	assert.Equal(t, "12345", resp.Context["companyId"])
 	assert.Equal(t, "read:stores", resp.Context["scope"])
-	assert.Equal(t, "internal_abc", resp.Context["internalToken"])
+
+	// 内部トークンのクレームが context と一致すること
+	claims, err := testInternalTokenVerifier.Verify(resp.Context["internalToken"].(string), time.Now())
+	if assert.NoError(t, err) {
+		assert.Equal(t, resp.PrincipalID, claims.Subject)
+		assert.Equal(t, "12345", claims.CompanyID)
+		assert.Equal(t, "read:stores", claims.Scope)
+	}
 }
 
 func Test_Bearerプレフィックス付きトークンが正しく処理されること(t *testing.T) {
@@ -218,9 +270,227 @@ func Test_Bearerプレフィックス付きトークンが正しく処理され
 			resp, err := testAuthorizer.Handler(context.Background(), event)
 
 			assert.NoError(t, err)
-			assert.Equal(t, "user", resp.PrincipalID)
+			assert.Equal(t, "token:"+cacheKey(testToken)[:16], resp.PrincipalID)
+			assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+		})
+	}
+}
+
+func Test_イベントのtypeに応じてハンドラが振り分けられること(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("invoke")
+	err := putTestToken(testToken, true)
+	assert.NoError(t, err)
+	defer deleteTestToken(testToken)
+
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{
+			"TOKENタイプのイベント",
+			fmt.Sprintf(`{"type":"TOKEN","authorizationToken":"Bearer %s","methodArn":%q}`, testToken, testMethodArn),
+		},
+		{
+			"REQUESTタイプのイベント",
+			fmt.Sprintf(`{"type":"REQUEST","methodArn":%q,"headers":{"authorization":"Bearer %s"}}`, testMethodArn, testToken),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := testAuthorizer.Invoke(context.Background(), []byte(tt.payload))
+
+			assert.NoError(t, err)
+			assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+		})
+	}
+}
+
+func Test_ローテーション済みトークンは猶予期間中のみAllowを返すこと(t *testing.T) {
+	now := time.Now()
+	oldToken := testutil.GenerateUniqueID("rotated")
+	err := putTestRecord(oldToken, map[string]types.AttributeValue{
+		"replacedBy":     &types.AttributeValueMemberS{Value: testutil.GenerateUniqueID("new")},
+		"graceExpiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(time.Hour).Unix(), 10)},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(oldToken)
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		effect  string
+		context map[string]interface{}
+	}{
+		{"猶予期間中はローテーション中のヒント付きでAllowを返すこと", now, "Allow", map[string]interface{}{"token_rotation_pending": true}},
+		{"猶予期間後はDenyを返すこと", now.Add(2 * time.Hour), "Deny", map[string]interface{}{"reason": "token_rotated"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &Authorizer{
+				TableName: TestTableName,
+				DDBClient: testDDBClient,
+				Now:       func() time.Time { return tt.now },
+			}
+
+			resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+				AuthorizationToken: "Bearer " + oldToken,
+				MethodArn:          testMethodArn,
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.PolicyDocument.Statement[0].Effect)
+			for k, v := range tt.context {
+				assert.Equal(t, v, resp.Context[k])
+			}
+		})
+	}
+}
+
+func Test_ローテーションされていないトークンにはヒントが含まれないこと(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("current")
+	err := putTestToken(testToken, true)
+	assert.NoError(t, err)
+	defer deleteTestToken(testToken)
+
+	resp, err := testAuthorizer.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + testToken,
+		MethodArn:          testMethodArn,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+	assert.NotContains(t, resp.Context, "token_rotation_pending")
+}
+
+func Test_トークンごとに異なるprincipalIdが設定されること(t *testing.T) {
+	clientToken := testutil.GenerateUniqueID("principal-client")
+	err := putTestRecord(clientToken, map[string]types.AttributeValue{
+		"clientId": &types.AttributeValueMemberS{Value: "client-a"},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(clientToken)
+
+	userToken := testutil.GenerateUniqueID("principal-user")
+	err = putTestRecord(userToken, map[string]types.AttributeValue{
+		"clientId": &types.AttributeValueMemberS{Value: "client-a"},
+		"userId":   &types.AttributeValueMemberS{Value: "user-1"},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(userToken)
+
+	plainToken := testutil.GenerateUniqueID("principal-plain")
+	assert.NoError(t, putTestToken(plainToken, true))
+	defer deleteTestToken(plainToken)
+
+	tests := []struct {
+		name      string
+		token     string
+		principal string
+	}{
+		{"clientIdがprincipalIdになること", clientToken, "client-a"},
+		{"userIdはclientIdより優先されること", userToken, "user-1"},
+		{"どちらもない場合はトークンのハッシュになること", plainToken, "token:" + cacheKey(plainToken)[:16]},
+	}
+
+	seen := make(map[string]bool)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := testAuthorizer.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+				AuthorizationToken: "Bearer " + tt.token,
+				MethodArn:          testMethodArn,
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+			assert.Equal(t, tt.principal, resp.PrincipalID)
+			assert.False(t, seen[resp.PrincipalID], "principalId が重複しないこと")
+			seen[resp.PrincipalID] = true
+		})
+	}
+}
+
+func Test_ロールがスコープに展開されてcontextに含まれること(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("roles")
+	err := putTestRecord(testToken, map[string]types.AttributeValue{
+		"scopes": &types.AttributeValueMemberSS{Value: []string{"read:reports"}},
+		"roles":  &types.AttributeValueMemberSS{Value: []string{"store-admin", "unknown-role"}},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(testToken)
+
+	roles, err := ParseRoleMapping(defaultRoles)
+	assert.NoError(t, err)
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		Roles:     roles,
+	}
+
+	resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + testToken,
+		MethodArn:          testMethodArn,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+	assert.Equal(t, "read:reports read:stores write:stores", resp.Context["scope"])
+	assert.Equal(t, "store-admin unknown-role", resp.Context["roles"])
+}
+
+func Test_不正なロール定義はエラーになること(t *testing.T) {
+	tests := []struct {
+		name    string
+		roles   string
+		wantErr string
+	}{
+		{"未対応のバージョン", `{"version": 2, "roles": {}}`, "unsupported roles version 2"},
+		{"スコープが空", `{"version": 1, "roles": {"empty": {"scopes": []}}}`, `roles["empty"]: scopes is required`},
+		{"未知のフィールド", `{"version": 1, "roles": {"r": {"scope": ["x"]}}}`, `unknown field "scope"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRoleMapping([]byte(tt.roles))
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_トークンのAPIキーがusageIdentifierKeyに設定されること(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("apikey")
+	err := putTestRecord(testToken, map[string]types.AttributeValue{
+		"apiKey": &types.AttributeValueMemberS{Value: "tenant-a-api-key-0000000000"},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(testToken)
+
+	plainToken := testutil.GenerateUniqueID("no-apikey")
+	assert.NoError(t, putTestToken(plainToken, true))
+	defer deleteTestToken(plainToken)
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"APIキーがあれば設定されること", testToken, "tenant-a-api-key-0000000000"},
+		{"APIキーがなければ空になること", plainToken, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := testAuthorizer.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+				AuthorizationToken: "Bearer " + tt.token,
+				MethodArn:          testMethodArn,
+			})
+
+			assert.NoError(t, err)
 			assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
-			assert.Equal(t, testToken, resp.Context["token"])
+			assert.Equal(t, tt.want, resp.UsageIdentifierKey)
+			assert.NotContains(t, resp.Context, "apiKey")
 		})
 	}
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MethodARN は API Gateway の methodArn を分解したもの
+// 形式: arn:aws:execute-api:{region}:{accountId}:{apiId}/{stage}/{httpMethod}/{resourcePath}
+type MethodARN struct {
+	Region    string
+	AccountID string
+	APIID     string
+	Stage     string
+	Method    string
+	// Path は先頭が "/" のリソースパス（パスがない場合は "/"）
+	Path string
+}
+
+// ParseMethodARN は methodArn を分解する
+func ParseMethodARN(arn string) (MethodARN, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "execute-api" {
+		return MethodARN{}, fmt.Errorf("invalid method ARN: %q", arn)
+	}
+
+	resource := strings.SplitN(parts[5], "/", 4)
+	if len(resource) < 3 || resource[0] == "" || resource[1] == "" || resource[2] == "" {
+		return MethodARN{}, fmt.Errorf("invalid method ARN resource: %q", parts[5])
+	}
+
+	path := "/"
+	if len(resource) == 4 {
+		path += resource[3]
+	}
+
+	return MethodARN{
+		Region:    parts[3],
+		AccountID: parts[4],
+		APIID:     resource[0],
+		Stage:     resource[1],
+		Method:    resource[2],
+		Path:      path,
+	}, nil
+}
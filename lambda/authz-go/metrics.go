@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// MetricsNamespace は CloudWatch メトリクスの名前空間
+const MetricsNamespace = "LocalGateway/Authorizer"
+
+// Metrics は Authorizer が発行するメトリクスの送信先
+type Metrics interface {
+	// Count はディメンション付きのカウントメトリクスを1件記録する
+	Count(name string, dimensions map[string]string)
+}
+
+// EMFMetrics は CloudWatch Embedded Metric Format（EMF）でメトリクスを出力する
+// Lambda の標準出力に書き出したログが CloudWatch Logs でメトリクスに変換される
+type EMFMetrics struct {
+	Namespace string
+	Writer    io.Writer
+	// Now は現在時刻を返す（テスト用に差し替え可能、nil の場合は time.Now）
+	Now func() time.Time
+}
+
+// NewEMFMetrics は標準出力に書き出す EMFMetrics を作成する
+func NewEMFMetrics() *EMFMetrics {
+	return &EMFMetrics{
+		Namespace: MetricsNamespace,
+		Writer:    os.Stdout,
+	}
+}
+
+// Count はカウントメトリクスを EMF 形式の1行として書き出す
+func (m *EMFMetrics) Count(name string, dimensions map[string]string) {
+	now := time.Now
+	if m.Now != nil {
+		now = m.Now
+	}
+
+	keys := make([]string, 0, len(dimensions))
+	for k := range dimensions {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	doc := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": now().UnixMilli(),
+			"CloudWatchMetrics": []map[string]interface{}{
+				{
+					"Namespace":  m.Namespace,
+					"Dimensions": [][]string{keys},
+					"Metrics":    []map[string]string{{"Name": name, "Unit": "Count"}},
+				},
+			},
+		},
+		name: 1,
+	}
+	for k, v := range dimensions {
+		doc[k] = v
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(m.Writer, string(b))
+}
+
+// count は Metrics が設定されている場合のみメトリクスを記録する
+func (a *Authorizer) count(name string, dimensions map[string]string) {
+	if a.Metrics != nil {
+		a.Metrics.Count(name, dimensions)
+	}
+}
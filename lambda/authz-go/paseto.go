@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// PASETOPublicHeader は PASETO v4.public トークンのヘッダー
+// v4.public は Ed25519 署名のみで、JWT の alg のようにトークン側でアルゴリズムを選べない
+const PASETOPublicHeader = "v4.public."
+
+// PASETOAuthenticator は内部サービスが発行した PASETO v4.public トークンを Ed25519 公開鍵で検証する
+// 鍵はフッター（{"kid":"..."}）の kid で選び、フッターに kid がない場合は kid が空の鍵を使う
+type PASETOAuthenticator struct {
+	// Keys は kid と公開鍵の対応
+	Keys map[string]ed25519.PublicKey
+	// Issuer は iss クレームに期待する値（空の場合は検査しない）
+	Issuer string
+	// Audience は aud クレームに期待する値（空の場合は検査しない）
+	Audience string
+	// Now は現在時刻を返す（テスト用に差し替え可能）
+	Now func() time.Time
+
+	claims []claimMapping
+}
+
+// NewPASETOAuthenticatorFromEnv は環境変数から PASETOAuthenticator を作成する
+// PASETO_PUBLIC_KEYS は "kid:16進数の公開鍵" のカンマ区切り（kid を省略した鍵はフッターに kid がないトークンに使う）
+func NewPASETOAuthenticatorFromEnv() (*PASETOAuthenticator, error) {
+	keys, err := ParsePASETOPublicKeys(os.Getenv("PASETO_PUBLIC_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("PASETO_PUBLIC_KEYS is required for the paseto authenticator")
+	}
+	return NewPASETOAuthenticator(keys, os.Getenv("PASETO_ISSUER"), os.Getenv("PASETO_AUDIENCE")), nil
+}
+
+// NewPASETOAuthenticator は PASETOAuthenticator を作成する
+// クレームは JWT の既定の対応（sub・client_id・company_id・scope 等）で Identity に変換する
+func NewPASETOAuthenticator(keys map[string]ed25519.PublicKey, issuer, audience string) *PASETOAuthenticator {
+	claims, _ := buildClaimMappings(nil)
+	return &PASETOAuthenticator{
+		Keys:     keys,
+		Issuer:   issuer,
+		Audience: audience,
+		claims:   claims,
+	}
+}
+
+// ParsePASETOPublicKeys は "kid:hex,..." 形式の公開鍵の一覧をパースする
+func ParsePASETOPublicKeys(s string) (map[string]ed25519.PublicKey, error) {
+	keys := map[string]ed25519.PublicKey{}
+	for _, entry := range splitList(s) {
+		kid, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			kid, encoded = "", entry
+		}
+		if _, dup := keys[kid]; dup {
+			return nil, fmt.Errorf("PASETO_PUBLIC_KEYS: duplicate key id %q", kid)
+		}
+		b, err := hex.DecodeString(encoded)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("PASETO_PUBLIC_KEYS: key %q must be a hex-encoded %d-byte Ed25519 public key", kid, ed25519.PublicKeySize)
+		}
+		keys[kid] = ed25519.PublicKey(b)
+	}
+	return keys, nil
+}
+
+func (p *PASETOAuthenticator) Name() string { return AuthenticatorPASETO }
+
+func (p *PASETOAuthenticator) Recognizes(cred *Credential) bool {
+	return strings.HasPrefix(cred.Token, PASETOPublicHeader)
+}
+
+func (p *PASETOAuthenticator) Authenticate(ctx context.Context, cred *Credential) (*Identity, map[string]interface{}) {
+	claims, err := p.verify(cred.Token)
+	if err != nil {
+		log.Printf("[Authorizer] PASETO rejected: %v, returning Deny", err)
+		return nil, map[string]interface{}{
+			"reason": "invalid_token",
+		}
+	}
+
+	if reason := p.checkClaims(claims); reason != "" {
+		log.Printf("[Authorizer] PASETO rejected (%s), returning Deny", reason)
+		return nil, map[string]interface{}{
+			"reason": reason,
+		}
+	}
+
+	log.Printf("[Authorizer] PASETO is valid")
+	return identityFromClaims(cred.Token, TokenTypePASETO, p.claims, claims), nil
+}
+
+// verify はトークンの署名を検証し、クレームを返す
+func (p *PASETOAuthenticator) verify(token string) (map[string]interface{}, error) {
+	body, ok := strings.CutPrefix(token, PASETOPublicHeader)
+	if !ok {
+		return nil, errors.New("not a v4.public token")
+	}
+
+	payload, encodedFooter, _ := strings.Cut(body, ".")
+	signed, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(signed) < ed25519.SignatureSize {
+		return nil, errors.New("malformed payload")
+	}
+	footer, err := base64.RawURLEncoding.DecodeString(encodedFooter)
+	if err != nil {
+		return nil, errors.New("malformed footer")
+	}
+
+	kid, err := pasetoKeyID(footer)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := p.Keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	message := signed[:len(signed)-ed25519.SignatureSize]
+	sig := signed[len(signed)-ed25519.SignatureSize:]
+	if !ed25519.Verify(key, pasetoPAE([]byte(PASETOPublicHeader), message, footer, nil), sig) {
+		return nil, errors.New("signature verification failed")
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(message, &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %w", err)
+	}
+	return claims, nil
+}
+
+// checkClaims は登録済みクレームを検証し、Deny理由を返す（有効な場合は空文字）
+// PASETO の exp / nbf は RFC 3339 形式の文字列
+func (p *PASETOAuthenticator) checkClaims(claims map[string]interface{}) string {
+	now := p.now()
+
+	exp, err := pasetoTime(claims, "exp")
+	if err != nil || exp.IsZero() {
+		return "invalid_token"
+	}
+	if !now.Before(exp) {
+		return "token_expired"
+	}
+	nbf, err := pasetoTime(claims, "nbf")
+	if err != nil {
+		return "invalid_token"
+	}
+	if !nbf.IsZero() && now.Before(nbf) {
+		return "token_not_yet_valid"
+	}
+
+	if iss, _ := claims["iss"].(string); p.Issuer != "" && iss != p.Issuer {
+		return "invalid_token"
+	}
+	if aud, _ := claims["aud"].(string); p.Audience != "" && aud != p.Audience {
+		return "invalid_token"
+	}
+	return ""
+}
+
+func (p *PASETOAuthenticator) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+// pasetoKeyID はフッターの kid を返す（フッターがない場合は空文字）
+func pasetoKeyID(footer []byte) (string, error) {
+	if len(footer) == 0 {
+		return "", nil
+	}
+	var f struct {
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(footer, &f); err != nil {
+		return "", errors.New("footer must be a JSON object")
+	}
+	return f.Kid, nil
+}
+
+// pasetoTime は RFC 3339 形式の時刻クレームを返す（クレームがない場合はゼロ値）
+func pasetoTime(claims map[string]interface{}, name string) (time.Time, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s must be a string", name)
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// pasetoPAE は PASETO の Pre-Authentication Encoding を返す
+// 要素数と各要素の長さを 64bit リトルエンディアン（最上位ビットは0）で前置して連結する
+func pasetoPAE(pieces ...[]byte) []byte {
+	le64 := func(n int) []byte {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, uint64(n)&(1<<63-1))
+		return b
+	}
+
+	out := le64(len(pieces))
+	for _, p := range pieces {
+		out = append(out, le64(len(p))...)
+		out = append(out, p...)
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+// ヘルパー関数: v4.public トークンを作成
+func signTestPASETO(t *testing.T, key ed25519.PrivateKey, claims map[string]interface{}, footer string) string {
+	t.Helper()
+	message, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to encode claims: %v", err)
+	}
+	sig := ed25519.Sign(key, pasetoPAE([]byte(PASETOPublicHeader), message, []byte(footer), nil))
+	token := PASETOPublicHeader + base64.RawURLEncoding.EncodeToString(append(message, sig...))
+	if footer != "" {
+		token += "." + base64.RawURLEncoding.EncodeToString([]byte(footer))
+	}
+	return token
+}
+
+func Test_PASETOの公式テストベクターを検証できること(t *testing.T) {
+	// https://github.com/paseto-standard/test-vectors の 4-S-1
+	pub, err := ParsePASETOPublicKeys("1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")
+	assert.NoError(t, err)
+	p := NewPASETOAuthenticator(pub, "", "")
+	token := "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"
+
+	claims, err := p.verify(token)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "this is a signed message", claims["data"])
+}
+
+func Test_PASETOトークンが検証されcontextに対応付けられること(t *testing.T) {
+	pub1, priv1, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	pub2, priv2, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	keys, err := ParsePASETOPublicKeys("svc-1:" + hex.EncodeToString(pub1) + "," + hex.EncodeToString(pub2))
+	assert.NoError(t, err)
+	p := NewPASETOAuthenticator(keys, "inventory-service", "local-gateway")
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	p.Now = func() time.Time { return now }
+	auth := &Authorizer{Authenticators: AuthenticatorChain{p, &OpaqueAuthenticator{}}}
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":        "inventory-service",
+			"aud":        "local-gateway",
+			"sub":        "svc-inventory",
+			"company_id": "12345",
+			"scope":      "read:stores write:stores",
+			"exp":        now.Add(time.Hour).Format(time.RFC3339),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		effect  string
+		context map[string]interface{}
+	}{
+		{"フッターのkidの鍵で検証されること", signTestPASETO(t, priv1, claims(nil), `{"kid":"svc-1"}`), "Allow", map[string]interface{}{
+			"userId": "svc-inventory", "companyId": "12345", "scope": "read:stores write:stores",
+		}},
+		{"フッターがない場合はkidのない鍵で検証されること", signTestPASETO(t, priv2, claims(nil), ""), "Allow", nil},
+		{"異なる鍵の署名はDenyになること", signTestPASETO(t, otherPriv, claims(nil), `{"kid":"svc-1"}`), "Deny", map[string]interface{}{"reason": "invalid_token"}},
+		{"未知のkidはDenyになること", signTestPASETO(t, priv1, claims(nil), `{"kid":"svc-9"}`), "Deny", map[string]interface{}{"reason": "invalid_token"}},
+		{"期限切れはDenyになること", signTestPASETO(t, priv1, claims(map[string]interface{}{"exp": now.Add(-time.Minute).Format(time.RFC3339)}), `{"kid":"svc-1"}`), "Deny", map[string]interface{}{"reason": "token_expired"}},
+		{"expがない場合はDenyになること", signTestPASETO(t, priv1, claims(map[string]interface{}{"exp": nil}), `{"kid":"svc-1"}`), "Deny", map[string]interface{}{"reason": "invalid_token"}},
+		{"有効期間前はDenyになること", signTestPASETO(t, priv1, claims(map[string]interface{}{"nbf": now.Add(time.Minute).Format(time.RFC3339)}), `{"kid":"svc-1"}`), "Deny", map[string]interface{}{"reason": "token_not_yet_valid"}},
+		{"異なるaudienceはDenyになること", signTestPASETO(t, priv1, claims(map[string]interface{}{"aud": "other"}), `{"kid":"svc-1"}`), "Deny", map[string]interface{}{"reason": "invalid_token"}},
+		{"異なるissuerはDenyになること", signTestPASETO(t, priv1, claims(map[string]interface{}{"iss": "other"}), `{"kid":"svc-1"}`), "Deny", map[string]interface{}{"reason": "invalid_token"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+				AuthorizationToken: "Bearer " + tt.token,
+				MethodArn:          testMethodArn,
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.PolicyDocument.Statement[0].Effect)
+			for k, v := range tt.context {
+				assert.Equal(t, v, resp.Context[k], k)
+			}
+		})
+	}
+}
+
+func Test_改ざんされたPASETOトークンは検証に失敗すること(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	p := NewPASETOAuthenticator(map[string]ed25519.PublicKey{"k": pub}, "", "")
+	token := signTestPASETO(t, priv, map[string]interface{}{"sub": "a"}, `{"kid":"k"}`)
+
+	// フッターは署名対象なので、kid を書き換えると検証に失敗する
+	_, err = p.verify(token[:len(token)-len(`eyJraWQiOiJrIn0`)] + base64.RawURLEncoding.EncodeToString([]byte(`{"kid":"k","x":1}`)))
+	assert.ErrorContains(t, err, "signature verification failed")
+
+	_, err = p.verify("v4.local.abc")
+	assert.ErrorContains(t, err, "not a v4.public token")
+}
+
+func Test_不正なPASETO公開鍵の設定はエラーになること(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    string
+		wantErr string
+	}{
+		{"16進数でない", "k1:zz", `key "k1" must be a hex-encoded 32-byte Ed25519 public key`},
+		{"長さが異なる", "k1:abcd", `key "k1" must be a hex-encoded 32-byte Ed25519 public key`},
+		{"kidの重複", "k1:" + hex.EncodeToString(make([]byte, 32)) + ",k1:" + hex.EncodeToString(make([]byte, 32)), `duplicate key id "k1"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePASETOPublicKeys(tt.keys)
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"local-gateway/lambda/tokensync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// DefaultPreloadMaxItems はプリロードするトークン数の上限（超える場合は GetItem にフォールバック）
+	DefaultPreloadMaxItems = 1000
+	// DefaultPreloadPollInterval はバージョンマーカーを確認する間隔
+	DefaultPreloadPollInterval = 30 * time.Second
+)
+
+// TokenPreloader は AllowedTokens をコールドスタート時にメモリへ読み込み、
+// バージョンマーカー（token-stream-processor が更新）をポーリングして変更のあったトークンだけを読み直す
+type TokenPreloader struct {
+	TableName string
+	DDBClient *dynamodb.Client
+	// MaxItems はプリロードするトークン数の上限
+	MaxItems int
+	// PollInterval はバージョンマーカーを確認する間隔（0 の場合は毎回確認する）
+	PollInterval time.Duration
+	// Now は現在時刻を返す（テスト用に差し替え可能、nil の場合は time.Now）
+	Now func() time.Time
+
+	mu sync.Mutex
+	// items はトークンをキーとした項目（nil の場合はプリロード無効）
+	items     map[string]map[string]types.AttributeValue
+	version   int64
+	checkedAt time.Time
+}
+
+// NewTokenPreloaderFromEnv は環境変数からプリロードの設定を読み込む
+// PRELOAD_TOKENS が "true" でない場合は nil を返す（プリロード無効）
+func NewTokenPreloaderFromEnv(client *dynamodb.Client, tableName string) (*TokenPreloader, error) {
+	if os.Getenv("PRELOAD_TOKENS") != "true" {
+		return nil, nil
+	}
+
+	p := &TokenPreloader{
+		TableName:    tableName,
+		DDBClient:    client,
+		MaxItems:     DefaultPreloadMaxItems,
+		PollInterval: DefaultPreloadPollInterval,
+	}
+	if v := os.Getenv("PRELOAD_MAX_ITEMS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid PRELOAD_MAX_ITEMS: %q", v)
+		}
+		p.MaxItems = n
+	}
+	if v := os.Getenv("PRELOAD_POLL_INTERVAL_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PRELOAD_POLL_INTERVAL_SECONDS: %q", v)
+		}
+		p.PollInterval = time.Duration(n) * time.Second
+	}
+	return p, nil
+}
+
+func (p *TokenPreloader) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+// Load はテーブル全体をスキャンしてメモリに読み込む
+// トークン数が MaxItems を超える場合は読み込まずに false を返す
+func (p *TokenPreloader) Load(ctx context.Context) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.load(ctx)
+}
+
+func (p *TokenPreloader) load(ctx context.Context) (bool, error) {
+	// スキャン中の変更を取りこぼさないよう、スキャン前のバージョンを記録する
+	marker, err := p.getMarker(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	items := make(map[string]map[string]types.AttributeValue)
+	paginator := dynamodb.NewScanPaginator(p.DDBClient, &dynamodb.ScanInput{
+		TableName:      aws.String(p.TableName),
+		ConsistentRead: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to scan tokens: %w", err)
+		}
+		for _, item := range page.Items {
+			token, ok := item["token"].(*types.AttributeValueMemberS)
+			if !ok || tokensync.IsReserved(token.Value) {
+				continue
+			}
+			items[token.Value] = item
+		}
+		if len(items) > p.MaxItems {
+			p.items = nil
+			return false, nil
+		}
+	}
+
+	p.items = items
+	p.version = marker.Version
+	p.checkedAt = p.now()
+	return true, nil
+}
+
+// Lookup はメモリ上のトークン項目を返す
+// プリロードが無効な場合や未登録のトークンは found が false になる（呼び出し側で GetItem する）
+func (p *TokenPreloader) Lookup(ctx context.Context, token string) (item map[string]types.AttributeValue, found bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.items == nil {
+		return nil, false
+	}
+	if p.now().Sub(p.checkedAt) >= p.PollInterval {
+		if err := p.refresh(ctx); err != nil {
+			// マーカーを確認できない場合は手持ちのデータで継続し、次回のポーリングで再試行する
+			log.Printf("[Authorizer] Failed to refresh preloaded tokens: %v", err)
+		}
+		p.checkedAt = p.now()
+	}
+
+	item, found = p.items[token]
+	return item, found
+}
+
+// refresh はバージョンマーカーを確認し、前回以降に変更されたトークンだけを読み直す
+func (p *TokenPreloader) refresh(ctx context.Context) error {
+	marker, err := p.getMarker(ctx)
+	if err != nil {
+		return err
+	}
+	if marker.Version == p.version {
+		return nil
+	}
+
+	tokens, ok := marker.ChangedSince(p.version)
+	if !ok {
+		log.Printf("[Authorizer] Change history is truncated, reloading all tokens")
+		loaded, err := p.load(ctx)
+		if err != nil {
+			return err
+		}
+		if !loaded {
+			log.Printf("[Authorizer] Token table exceeds %d items, falling back to GetItem", p.MaxItems)
+		}
+		return nil
+	}
+
+	for _, token := range tokens {
+		out, err := p.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(p.TableName),
+			Key:            map[string]types.AttributeValue{"token": &types.AttributeValueMemberS{Value: token}},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to reload token: %w", err)
+		}
+		if out.Item == nil {
+			delete(p.items, token)
+		} else {
+			p.items[token] = out.Item
+		}
+	}
+	log.Printf("[Authorizer] Reloaded %d changed tokens (version %d -> %d)", len(tokens), p.version, marker.Version)
+	p.version = marker.Version
+	return nil
+}
+
+func (p *TokenPreloader) getMarker(ctx context.Context) (tokensync.Marker, error) {
+	var marker tokensync.Marker
+	out, err := p.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(p.TableName),
+		Key:            map[string]types.AttributeValue{"token": &types.AttributeValueMemberS{Value: tokensync.MarkerToken}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return marker, fmt.Errorf("failed to get version marker: %w", err)
+	}
+	if out.Item == nil {
+		return marker, nil
+	}
+	if err := attributevalue.UnmarshalMap(out.Item, &marker); err != nil {
+		return marker, fmt.Errorf("invalid version marker: %w", err)
+	}
+	return marker, nil
+}
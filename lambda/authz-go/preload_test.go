@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"local-gateway/lambda/testutil"
+	"local-gateway/lambda/tokensync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/stretchr/testify/assert"
+)
+
+// ヘルパー関数: token-stream-processor と同様にバージョンマーカーへ変更を記録
+func recordTestChanges(t *testing.T, marker *tokensync.Marker, tokens ...string) {
+	t.Helper()
+	marker.Record(tokens)
+	item, err := attributevalue.MarshalMap(marker)
+	if err != nil {
+		t.Fatalf("failed to encode marker: %v", err)
+	}
+	if err := testutil.PutItem(context.Background(), testDDBClient, TestTableName, item); err != nil {
+		t.Fatalf("failed to put marker: %v", err)
+	}
+}
+
+func Test_プリロードしたトークンで認可されバージョンマーカーで失効が反映されること(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("preload")
+	assert.NoError(t, putTestToken(testToken, true))
+	defer deleteTestToken(testToken)
+	defer deleteTestToken(tokensync.MarkerToken)
+
+	now := time.Unix(1_700_000_000, 0)
+	preloader := &TokenPreloader{
+		TableName:    TestTableName,
+		DDBClient:    testDDBClient,
+		MaxItems:     DefaultPreloadMaxItems,
+		PollInterval: DefaultPreloadPollInterval,
+		Now:          func() time.Time { return now },
+	}
+	loaded, err := preloader.Load(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, loaded)
+
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		Preloader: preloader,
+	}
+	methodArn, err := testutil.TestMethodArn()
+	assert.NoError(t, err)
+	event := events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + testToken,
+		MethodArn:          methodArn,
+	}
+
+	resp, err := auth.Handler(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+
+	// トークンを無効化し、stream processor と同様にマーカーへ記録する
+	assert.NoError(t, putTestToken(testToken, false))
+	var marker tokensync.Marker
+	recordTestChanges(t, &marker, testToken)
+
+	// ポーリング間隔内はメモリ上のデータが使われる
+	resp, err = auth.Handler(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+
+	// ポーリング間隔を過ぎると変更が反映される
+	now = now.Add(DefaultPreloadPollInterval)
+	resp, err = auth.Handler(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+}
+
+func Test_プリロードにないトークンはGetItemで検索されること(t *testing.T) {
+	preloader := &TokenPreloader{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		MaxItems:  DefaultPreloadMaxItems,
+	}
+	loaded, err := preloader.Load(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, loaded)
+
+	// プリロード後に発行されたトークン
+	testToken := testutil.GenerateUniqueID("issued")
+	assert.NoError(t, putTestToken(testToken, true))
+	defer deleteTestToken(testToken)
+
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		Preloader: preloader,
+	}
+
+	methodArn, err := testutil.TestMethodArn()
+	assert.NoError(t, err)
+
+	resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + testToken,
+		MethodArn:          methodArn,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+}
+
+func Test_トークン数が上限を超える場合はプリロードしないこと(t *testing.T) {
+	for _, prefix := range []string{"over-1", "over-2"} {
+		token := testutil.GenerateUniqueID(prefix)
+		assert.NoError(t, putTestToken(token, true))
+		defer deleteTestToken(token)
+	}
+
+	preloader := &TokenPreloader{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		MaxItems:  1,
+	}
+
+	loaded, err := preloader.Load(context.Background())
+
+	assert.NoError(t, err)
+	assert.False(t, loaded)
+	_, found := preloader.Lookup(context.Background(), "allow")
+	assert.False(t, found)
+}
+
+func Test_管理用のトークンはDenyになること(t *testing.T) {
+	var marker tokensync.Marker
+	recordTestChanges(t, &marker, "x")
+	defer deleteTestToken(tokensync.MarkerToken)
+
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+	}
+
+	methodArn, err := testutil.TestMethodArn()
+	assert.NoError(t, err)
+
+	resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + tokensync.MarkerToken,
+		MethodArn:          methodArn,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+	assert.Equal(t, "token_not_found", resp.Context["reason"])
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"slices"
+)
+
+// トークンの利用制限に違反した場合の Deny 理由
+const (
+	ReasonStageNotAllowed     = "stage_not_allowed"
+	ReasonOutsideAccessWindow = "outside_access_window"
+)
+
+// checkRestrictions はトークンに設定された利用制限を検査し、違反している場合は Deny レスポンスの context を返す
+// 制限が設定されていないトークンや、制限を満たすリクエストでは nil を返す
+func (a *Authorizer) checkRestrictions(req authRequest, id *Identity) map[string]interface{} {
+	if len(id.Stages) > 0 || len(id.APIIDs) > 0 {
+		arn, err := ParseMethodARN(req.MethodArn)
+		if err != nil {
+			log.Printf("[Authorizer] %v, returning Deny", err)
+			return map[string]interface{}{"reason": "invalid_method_arn"}
+		}
+		if !allowedStage(id, arn) {
+			log.Printf("[Authorizer] Token is not valid for API %q stage %q, returning Deny", arn.APIID, arn.Stage)
+			return map[string]interface{}{"reason": ReasonStageNotAllowed}
+		}
+	}
+
+	if len(id.AccessWindows) > 0 {
+		ok, err := inAccessWindows(id.AccessWindows, a.now())
+		if err != nil {
+			log.Printf("[Authorizer] Invalid token record: %v, returning Deny", err)
+			return map[string]interface{}{"error": "invalid_token_record"}
+		}
+		if !ok {
+			log.Printf("[Authorizer] Request is outside the token's access windows, returning Deny")
+			return map[string]interface{}{"reason": ReasonOutsideAccessWindow}
+		}
+	}
+	return nil
+}
+
+// allowedStage はリクエスト先の API ID・ステージがトークンの許可対象かを返す
+// stages / apiIds のうち未設定のものは制限しない
+func allowedStage(id *Identity, arn MethodARN) bool {
+	if len(id.Stages) > 0 && !slices.Contains(id.Stages, arn.Stage) {
+		return false
+	}
+	if len(id.APIIDs) > 0 && !slices.Contains(id.APIIDs, arn.APIID) {
+		return false
+	}
+	return true
+}
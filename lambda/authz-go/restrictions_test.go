@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ステージを限定したトークンは他のステージでDenyを返すこと(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("staged")
+	err := putTestRecord(testToken, map[string]types.AttributeValue{
+		"stages": &types.AttributeValueMemberSS{Value: []string{"test", "local"}},
+		"apiIds": &types.AttributeValueMemberSS{Value: []string{"abc123"}},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(testToken)
+
+	tests := []struct {
+		name      string
+		methodArn string
+		effect    string
+		reason    interface{}
+	}{
+		{"許可されたステージとAPIではAllowを返すこと", "arn:aws:execute-api:ap-northeast-1:123456789012:abc123/test/GET/resource", "Allow", nil},
+		{"許可されていないステージではDenyを返すこと", "arn:aws:execute-api:ap-northeast-1:123456789012:abc123/prod/GET/resource", "Deny", "stage_not_allowed"},
+		{"許可されていないAPIではDenyを返すこと", "arn:aws:execute-api:ap-northeast-1:123456789012:other9/test/GET/resource", "Deny", "stage_not_allowed"},
+		{"解析できないmethodArnではDenyを返すこと", "invalid", "Deny", "invalid_method_arn"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := testAuthorizer.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+				AuthorizationToken: "Bearer " + testToken,
+				MethodArn:          tt.methodArn,
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.PolicyDocument.Statement[0].Effect)
+			assert.Equal(t, tt.reason, resp.Context["reason"])
+		})
+	}
+}
+
+func Test_ステージ制限のないトークンはどのステージでも使えること(t *testing.T) {
+	tests := []struct {
+		name string
+		id   *Identity
+		arn  MethodARN
+		want bool
+	}{
+		{"制限なし", &Identity{}, MethodARN{APIID: "abc123", Stage: "prod"}, true},
+		{"ステージのみ制限", &Identity{Stages: []string{"test"}}, MethodARN{APIID: "any", Stage: "test"}, true},
+		{"ステージ不一致", &Identity{Stages: []string{"test"}}, MethodARN{APIID: "abc123", Stage: "prod"}, false},
+		{"APIのみ制限", &Identity{APIIDs: []string{"abc123"}}, MethodARN{APIID: "abc123", Stage: "prod"}, true},
+		{"API不一致", &Identity{APIIDs: []string{"abc123"}}, MethodARN{APIID: "other9", Stage: "test"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, allowedStage(tt.id, tt.arn))
+		})
+	}
+}
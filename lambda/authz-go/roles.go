@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+)
+
+// RolesVersion はサポートするロール定義ファイルのバージョン
+const RolesVersion = 1
+
+//go:embed roles.json
+var defaultRoles []byte
+
+// RoleMapping はロール名とスコープの対応（roles.json）
+type RoleMapping struct {
+	Version int             `json:"version"`
+	Roles   map[string]Role `json:"roles"`
+}
+
+// Role はロールに含まれるスコープ
+type Role struct {
+	Scopes []string `json:"scopes"`
+}
+
+// LoadRoleMapping は環境変数 AUTHZ_ROLES_FILE のロール定義を読み込む
+// 未設定の場合はバイナリに埋め込まれた roles.json を使う
+func LoadRoleMapping() (*RoleMapping, error) {
+	data := defaultRoles
+	if path := os.Getenv("AUTHZ_ROLES_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read roles file: %w", err)
+		}
+		data = b
+	}
+	return ParseRoleMapping(data)
+}
+
+// ParseRoleMapping はロール定義をパースし、検証する
+func ParseRoleMapping(data []byte) (*RoleMapping, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var m RoleMapping
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse roles: %w", err)
+	}
+	if m.Version != RolesVersion {
+		return nil, fmt.Errorf("unsupported roles version %d (expected %d)", m.Version, RolesVersion)
+	}
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(m.Roles)) {
+		if len(m.Roles[name].Scopes) == 0 {
+			errs = append(errs, fmt.Errorf("roles[%q]: scopes is required", name))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Expand はトークンのロールをスコープに展開し、Identity のスコープに追加する
+// 定義されていないロールは無視する
+func (m *RoleMapping) Expand(id *Identity) {
+	for _, name := range id.Roles {
+		role, ok := m.Roles[name]
+		if !ok {
+			log.Printf("[Authorizer] Unknown role %q is ignored", name)
+			continue
+		}
+		id.addScopes(role.Scopes)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+)
+
+// RulesVersion はサポートするルール定義ファイルのバージョン
+const RulesVersion = 1
+
+//go:embed rules.json
+var defaultRules []byte
+
+// ルール定義の effect
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// $CONNECT は WebSocket API の $connect ルート（methodArn のメソッド部分が $connect になる）
+var validRuleMethods = []string{"*", "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "$CONNECT"}
+
+// RuleSet はルート単位の認可ルール定義（rules.json）
+type RuleSet struct {
+	Version int `json:"version"`
+	// DefaultEffect はどのルールにもマッチしない場合の判定（allow / deny）
+	DefaultEffect string `json:"defaultEffect"`
+	Rules         []Rule `json:"rules"`
+}
+
+// Rule は HTTP メソッドとパスパターンに対する認可条件
+// 条件が空の項目は検査しない
+type Rule struct {
+	ID      string   `json:"id"`
+	Methods []string `json:"methods"`
+	// Path はパスパターン（"*" と "{name}" は1セグメント、末尾の "**" は0個以上のセグメントにマッチ）
+	Path           string   `json:"path"`
+	RequiredScopes []string `json:"requiredScopes,omitempty"`
+	AllowedTenants []string `json:"allowedTenants,omitempty"`
+	TokenTypes     []string `json:"tokenTypes,omitempty"`
+	// Condition は追加の条件を表す CEL 式（利用できる変数は newConditionEnv を参照）
+	Condition string `json:"condition,omitempty"`
+
+	program cel.Program
+}
+
+// RuleDecision はルール評価の結果
+type RuleDecision struct {
+	Allowed bool
+	// RuleID は判定に使われたルール（どのルールにもマッチしない場合は空）
+	RuleID string
+	// Reason はDenyの理由
+	Reason string
+}
+
+// LoadRuleSet は環境変数 AUTHZ_RULES_FILE のルール定義を読み込む
+// 未設定の場合はバイナリに埋め込まれた rules.json を使う
+func LoadRuleSet() (*RuleSet, error) {
+	data := defaultRules
+	if path := os.Getenv("AUTHZ_RULES_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rules file: %w", err)
+		}
+		data = b
+	}
+	return ParseRuleSet(data)
+}
+
+// LoadShadowRuleSet は環境変数 AUTHZ_SHADOW_RULES_FILE の候補ルール定義を読み込む
+// 未設定の場合は nil を返す（シャドー評価は無効）
+func LoadShadowRuleSet() (*RuleSet, error) {
+	path := os.Getenv("AUTHZ_SHADOW_RULES_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shadow rules file: %w", err)
+	}
+	return ParseRuleSet(data)
+}
+
+// ParseRuleSet はルール定義をパースし、検証する
+func ParseRuleSet(data []byte) (*RuleSet, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var rs RuleSet
+	if err := dec.Decode(&rs); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+	if err := rs.validate(); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+func (rs *RuleSet) validate() error {
+	if rs.Version != RulesVersion {
+		return fmt.Errorf("unsupported rules version %d (expected %d)", rs.Version, RulesVersion)
+	}
+	if rs.DefaultEffect != EffectAllow && rs.DefaultEffect != EffectDeny {
+		return fmt.Errorf("defaultEffect must be %q or %q, got %q", EffectAllow, EffectDeny, rs.DefaultEffect)
+	}
+
+	env, err := newConditionEnv()
+	if err != nil {
+		return fmt.Errorf("failed to create condition environment: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var errs []error
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		if err := r.validate(env); err != nil {
+			errs = append(errs, fmt.Errorf("rules[%d] (id=%q): %w", i, r.ID, err))
+			continue
+		}
+		if seen[r.ID] {
+			errs = append(errs, fmt.Errorf("rules[%d] (id=%q): duplicate id", i, r.ID))
+		}
+		seen[r.ID] = true
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Rule) validate(env *cel.Env) error {
+	if r.ID == "" {
+		return errors.New("id is required")
+	}
+	if len(r.Methods) == 0 {
+		return errors.New("methods is required")
+	}
+	for _, m := range r.Methods {
+		if !slices.Contains(validRuleMethods, strings.ToUpper(m)) {
+			return fmt.Errorf("unsupported method %q", m)
+		}
+	}
+	if !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("path must start with \"/\": %q", r.Path)
+	}
+	segments := splitPath(r.Path)
+	for i, seg := range segments {
+		if seg == "**" && i != len(segments)-1 {
+			return fmt.Errorf("\"**\" is only allowed as the last segment: %q", r.Path)
+		}
+	}
+	for _, t := range r.TokenTypes {
+		if !slices.Contains(tokenTypes, t) {
+			return fmt.Errorf("unsupported token type %q", t)
+		}
+	}
+	if r.Condition != "" {
+		prg, err := compileCondition(env, r.Condition)
+		if err != nil {
+			return err
+		}
+		r.program = prg
+	}
+	return nil
+}
+
+// Evaluate はリクエストに最初にマッチしたルールで認可判定を行う
+func (rs *RuleSet) Evaluate(req RequestInfo, id *Identity) RuleDecision {
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		if !r.matches(req.ARN) {
+			continue
+		}
+		if reason := r.check(req, id); reason != "" {
+			return RuleDecision{RuleID: r.ID, Reason: reason}
+		}
+		return RuleDecision{Allowed: true, RuleID: r.ID}
+	}
+
+	if rs.DefaultEffect == EffectAllow {
+		return RuleDecision{Allowed: true}
+	}
+	return RuleDecision{Reason: "no_matching_rule"}
+}
+
+func (r *Rule) matches(arn MethodARN) bool {
+	methodOK := false
+	for _, m := range r.Methods {
+		if m == "*" || strings.EqualFold(m, arn.Method) {
+			methodOK = true
+			break
+		}
+	}
+	return methodOK && matchPath(splitPath(r.Path), splitPath(arn.Path))
+}
+
+// check はルールの条件を検査し、満たさない場合はDenyの理由を返す
+// 条件式の評価エラーもDenyとして扱う
+func (r *Rule) check(req RequestInfo, id *Identity) string {
+	for _, s := range r.RequiredScopes {
+		if !slices.Contains(id.Scopes, s) {
+			return "missing_scope:" + s
+		}
+	}
+	if len(r.AllowedTenants) > 0 && !slices.Contains(r.AllowedTenants, id.CompanyID) {
+		return "tenant_not_allowed"
+	}
+	if len(r.TokenTypes) > 0 && !slices.Contains(r.TokenTypes, id.TokenType) {
+		return "token_type_not_allowed"
+	}
+	if r.program != nil {
+		ok, err := evalCondition(r.program, req, id)
+		if err != nil {
+			return "condition_error: " + err.Error()
+		}
+		if !ok {
+			return "condition_not_met"
+		}
+	}
+	return ""
+}
+
+func matchPath(pattern, path []string) bool {
+	for i, seg := range pattern {
+		if seg == "**" {
+			return true
+		}
+		if i >= len(path) {
+			return false
+		}
+		if seg == "*" || (strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")) {
+			continue
+		}
+		if seg != path[i] {
+			return false
+		}
+	}
+	return len(pattern) == len(path)
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
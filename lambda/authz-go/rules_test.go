@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRulesJSON = `{
+  "version": 1,
+  "defaultEffect": "deny",
+  "rules": [
+    {"id": "stores-read", "methods": ["GET"], "path": "/stores/**", "requiredScopes": ["read:stores"]},
+    {"id": "stores-write", "methods": ["POST", "PUT", "DELETE"], "path": "/stores/{id}", "requiredScopes": ["write:stores"], "allowedTenants": ["12345"]},
+    {"id": "partner", "methods": ["*"], "path": "/partner/*", "tokenTypes": ["introspection"]}
+  ]
+}`
+
+func mustParseRuleSet(t *testing.T, data string) *RuleSet {
+	t.Helper()
+	rs, err := ParseRuleSet([]byte(data))
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+	return rs
+}
+
+func Test_methodArnが分解されること(t *testing.T) {
+	tests := []struct {
+		name string
+		arn  string
+		want MethodARN
+	}{
+		{
+			name: "リソースパス付き",
+			arn:  "arn:aws:execute-api:ap-northeast-1:123456789012:abc123/test/GET/stores/s-1",
+			want: MethodARN{Region: "ap-northeast-1", AccountID: "123456789012", APIID: "abc123", Stage: "test", Method: "GET", Path: "/stores/s-1"},
+		},
+		{
+			name: "リソースパスなし",
+			arn:  "arn:aws:execute-api:ap-northeast-1:000000000000:test/test/GET",
+			want: MethodARN{Region: "ap-northeast-1", AccountID: "000000000000", APIID: "test", Stage: "test", Method: "GET", Path: "/"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMethodARN(tt.arn)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := ParseMethodARN("arn:aws:lambda:ap-northeast-1:123456789012:function:foo")
+	assert.Error(t, err)
+}
+
+func Test_埋め込みのルール定義が読み込めること(t *testing.T) {
+	rs, err := ParseRuleSet(defaultRules)
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, rs.Rules)
+}
+
+func Test_埋め込みのルール定義で店舗APIの操作ごとにスコープが判定されること(t *testing.T) {
+	rs, err := ParseRuleSet(defaultRules)
+	assert.NoError(t, err)
+	reader := &Identity{CompanyID: "12345", Scopes: []string{"read:stores"}, TokenType: TokenTypeOpaque}
+	admin := &Identity{CompanyID: "12345", Scopes: []string{"read:stores", "write:stores"}, TokenType: TokenTypeOpaque}
+
+	tests := []struct {
+		method   string
+		path     string
+		identity *Identity
+		allowed  bool
+	}{
+		{"GET", "/stores", reader, true},
+		{"GET", "/stores/s-1", reader, true},
+		{"POST", "/stores", reader, false},
+		{"PUT", "/stores/s-1", reader, false},
+		{"DELETE", "/stores/s-1", reader, false},
+		{"POST", "/stores", admin, true},
+		{"PUT", "/stores/s-1", admin, true},
+		{"DELETE", "/stores/s-1", admin, true},
+		{"POST", "/stores/s-1", admin, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path+" "+strings.Join(tt.identity.Scopes, ","), func(t *testing.T) {
+			req := RequestInfo{ARN: MethodARN{Stage: "test", Method: tt.method, Path: tt.path}}
+
+			assert.Equal(t, tt.allowed, rs.Evaluate(req, tt.identity).Allowed)
+		})
+	}
+}
+
+func Test_不正なルール定義は該当ルールを示すエラーになること(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr string
+	}{
+		{
+			name:    "未対応のバージョン",
+			rules:   `{"version": 2, "defaultEffect": "deny", "rules": []}`,
+			wantErr: "unsupported rules version 2",
+		},
+		{
+			name:    "パスが/で始まらない",
+			rules:   `{"version": 1, "defaultEffect": "deny", "rules": [{"id": "ok", "methods": ["GET"], "path": "/a"}, {"id": "bad-path", "methods": ["GET"], "path": "stores"}]}`,
+			wantErr: `rules[1] (id="bad-path"): path must start with "/"`,
+		},
+		{
+			name:    "未対応のメソッド",
+			rules:   `{"version": 1, "defaultEffect": "deny", "rules": [{"id": "bad-method", "methods": ["FETCH"], "path": "/a"}]}`,
+			wantErr: `rules[0] (id="bad-method"): unsupported method "FETCH"`,
+		},
+		{
+			name:    "IDの重複",
+			rules:   `{"version": 1, "defaultEffect": "deny", "rules": [{"id": "dup", "methods": ["GET"], "path": "/a"}, {"id": "dup", "methods": ["GET"], "path": "/b"}]}`,
+			wantErr: `rules[1] (id="dup"): duplicate id`,
+		},
+		{
+			name:    "未知のフィールド",
+			rules:   `{"version": 1, "defaultEffect": "deny", "rules": [{"id": "typo", "methods": ["GET"], "path": "/a", "requiredScope": ["x"]}]}`,
+			wantErr: `unknown field "requiredScope"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRuleSet([]byte(tt.rules))
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_ルールに従って認可判定されること(t *testing.T) {
+	rs := mustParseRuleSet(t, testRulesJSON)
+	reader := &Identity{CompanyID: "12345", Scopes: []string{"read:stores"}, TokenType: TokenTypeOpaque}
+	writer := &Identity{CompanyID: "12345", Scopes: []string{"write:stores"}, TokenType: TokenTypeOpaque}
+	otherTenant := &Identity{CompanyID: "99999", Scopes: []string{"write:stores"}, TokenType: TokenTypeOpaque}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		identity *Identity
+		want     RuleDecision
+	}{
+		{"スコープがあればAllowになること", "GET", "/stores/s-1", reader, RuleDecision{Allowed: true, RuleID: "stores-read"}},
+		{"**は0個のセグメントにもマッチすること", "GET", "/stores", reader, RuleDecision{Allowed: true, RuleID: "stores-read"}},
+		{"スコープが不足していればDenyになること", "PUT", "/stores/s-1", reader, RuleDecision{RuleID: "stores-write", Reason: "missing_scope:write:stores"}},
+		{"許可されていないテナントはDenyになること", "DELETE", "/stores/s-1", otherTenant, RuleDecision{RuleID: "stores-write", Reason: "tenant_not_allowed"}},
+		{"許可されたテナントはAllowになること", "POST", "/stores/s-1", writer, RuleDecision{Allowed: true, RuleID: "stores-write"}},
+		{"トークン種別が異なればDenyになること", "GET", "/partner/x", reader, RuleDecision{RuleID: "partner", Reason: "token_type_not_allowed"}},
+		{"マッチするルールがなければデフォルトでDenyになること", "GET", "/unknown", reader, RuleDecision{Reason: "no_matching_rule"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := RequestInfo{ARN: MethodARN{Stage: "test", Method: tt.method, Path: tt.path}}
+
+			assert.Equal(t, tt.want, rs.Evaluate(req, tt.identity))
+		})
+	}
+}
+
+func Test_ルールでDenyされた場合は失敗したルールがcontextに含まれること(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("rules")
+	err := putTestRecord(testToken, map[string]types.AttributeValue{
+		"companyId": &types.AttributeValueMemberS{Value: "12345"},
+		"scopes":    &types.AttributeValueMemberSS{Value: []string{"read:stores"}},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(testToken)
+
+	auth := &Authorizer{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+		Rules:     mustParseRuleSet(t, testRulesJSON),
+	}
+
+	readArn, err := testutil.TestMethodArnWithPath("GET", "/stores/s-1")
+	assert.NoError(t, err)
+	writeArn, err := testutil.TestMethodArnWithPath("PUT", "/stores/s-1")
+	assert.NoError(t, err)
+
+	resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + testToken,
+		MethodArn:          readArn,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+
+	resp, err = auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + testToken,
+		MethodArn:          writeArn,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+	assert.Equal(t, "rule_failed", resp.Context["reason"])
+	assert.Equal(t, "stores-write", resp.Context["rule"])
+	assert.Equal(t, "missing_scope:write:stores", resp.Context["ruleDetail"])
+}
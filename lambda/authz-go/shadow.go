@@ -0,0 +1,68 @@
+package main
+
+import "log"
+
+// MetricShadowDecisionMismatch は有効なルールと候補ルールの判定が食い違った件数のメトリクス名
+const MetricShadowDecisionMismatch = "ShadowDecisionMismatch"
+
+// evaluateRules は有効なルールで認可判定を行い、候補ルールが設定されていればシャドー評価も行う
+// 判定に使うのは有効なルールの結果のみで、候補ルールの結果は比較・記録にだけ使う
+func (a *Authorizer) evaluateRules(req authRequest, id *Identity) (RuleDecision, error) {
+	if a.Rules == nil && a.ShadowRules == nil {
+		return RuleDecision{Allowed: true}, nil
+	}
+
+	arn, err := ParseMethodARN(req.MethodArn)
+	if err != nil {
+		if a.Rules == nil {
+			// シャドー評価のみの場合は判定に影響させない
+			log.Printf("[Authorizer][Shadow] Skipped: %v", err)
+			return RuleDecision{Allowed: true}, nil
+		}
+		return RuleDecision{}, err
+	}
+
+	info := RequestInfo{
+		ARN:      arn,
+		Headers:  req.Headers,
+		SourceIP: req.SourceIP,
+		Now:      a.now(),
+	}
+
+	decision := RuleDecision{Allowed: true}
+	if a.Rules != nil {
+		decision = a.Rules.Evaluate(info, id)
+		if !decision.Allowed {
+			log.Printf("[Authorizer] Rule %q denied %s %s (%s), returning Deny", decision.RuleID, arn.Method, arn.Path, decision.Reason)
+		}
+	}
+
+	if a.ShadowRules != nil {
+		a.compareShadow(info, id, decision)
+	}
+	return decision, nil
+}
+
+// compareShadow は候補ルールで判定し、有効なルールの判定と食い違えばログとメトリクスに記録する
+func (a *Authorizer) compareShadow(info RequestInfo, id *Identity, active RuleDecision) {
+	shadow := a.ShadowRules.Evaluate(info, id)
+	if shadow.Allowed == active.Allowed {
+		return
+	}
+
+	log.Printf("[Authorizer][Shadow] Decision mismatch for %s %s: active=%s (rule=%q, reason=%q) shadow=%s (rule=%q, reason=%q)",
+		info.ARN.Method, info.ARN.Path,
+		effectOf(active), active.RuleID, active.Reason,
+		effectOf(shadow), shadow.RuleID, shadow.Reason)
+	a.count(MetricShadowDecisionMismatch, map[string]string{
+		"Active": effectOf(active),
+		"Shadow": effectOf(shadow),
+	})
+}
+
+func effectOf(d RuleDecision) string {
+	if d.Allowed {
+		return "Allow"
+	}
+	return "Deny"
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 候補ルール: 書き込みに加えて読み取りにもテナント制限をかける
+const testShadowRulesJSON = `{
+  "version": 1,
+  "defaultEffect": "deny",
+  "rules": [
+    {"id": "stores-read-v2", "methods": ["GET"], "path": "/stores/**", "requiredScopes": ["read:stores"], "allowedTenants": ["12345"]},
+    {"id": "stores-write", "methods": ["POST", "PUT", "DELETE"], "path": "/stores/{id}", "requiredScopes": ["write:stores"], "allowedTenants": ["12345"]}
+  ]
+}`
+
+// recordedMetric は recordingMetrics に記録されたメトリクス
+type recordedMetric struct {
+	Name       string
+	Dimensions map[string]string
+}
+
+// recordingMetrics はテスト用に記録したメトリクスを保持する
+type recordingMetrics struct {
+	records []recordedMetric
+}
+
+func (m *recordingMetrics) Count(name string, dimensions map[string]string) {
+	m.records = append(m.records, recordedMetric{Name: name, Dimensions: dimensions})
+}
+
+func Test_シャドー評価で判定が食い違った場合はメトリクスを記録し有効なルールで判定すること(t *testing.T) {
+	reader := &Identity{CompanyID: "99999", Scopes: []string{"read:stores"}, TokenType: TokenTypeOpaque}
+
+	tests := []struct {
+		name        string
+		rules       *RuleSet
+		method      string
+		path        string
+		wantAllowed bool
+		wantMetrics []recordedMetric
+	}{
+		{
+			name:        "有効なルールでAllow・候補ルールでDenyの場合",
+			rules:       mustParseRuleSet(t, testRulesJSON),
+			method:      "GET",
+			path:        "/stores/s-1",
+			wantAllowed: true,
+			wantMetrics: []recordedMetric{{Name: MetricShadowDecisionMismatch, Dimensions: map[string]string{"Active": "Allow", "Shadow": "Deny"}}},
+		},
+		{
+			name:        "判定が一致する場合",
+			rules:       mustParseRuleSet(t, testRulesJSON),
+			method:      "PUT",
+			path:        "/stores/s-1",
+			wantAllowed: false,
+			wantMetrics: nil,
+		},
+		{
+			name:        "有効なルールが未設定の場合はAllowと比較すること",
+			rules:       nil,
+			method:      "GET",
+			path:        "/unknown",
+			wantAllowed: true,
+			wantMetrics: []recordedMetric{{Name: MetricShadowDecisionMismatch, Dimensions: map[string]string{"Active": "Allow", "Shadow": "Deny"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := &recordingMetrics{}
+			auth := &Authorizer{
+				Rules:       tt.rules,
+				ShadowRules: mustParseRuleSet(t, testShadowRulesJSON),
+				Metrics:     metrics,
+			}
+			methodArn, err := testutil.TestMethodArnWithPath(tt.method, tt.path)
+			assert.NoError(t, err)
+
+			decision, err := auth.evaluateRules(authRequest{MethodArn: methodArn}, reader)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAllowed, decision.Allowed)
+			assert.Equal(t, tt.wantMetrics, metrics.records)
+		})
+	}
+}
+
+func Test_シャドー評価の結果はレスポンスに影響しないこと(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("shadow")
+	err := putTestRecord(testToken, map[string]types.AttributeValue{
+		"companyId": &types.AttributeValueMemberS{Value: "99999"},
+		"scopes":    &types.AttributeValueMemberSS{Value: []string{"read:stores"}},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(testToken)
+
+	metrics := &recordingMetrics{}
+	auth := &Authorizer{
+		TableName:   TestTableName,
+		DDBClient:   testDDBClient,
+		Rules:       mustParseRuleSet(t, testRulesJSON),
+		ShadowRules: mustParseRuleSet(t, testShadowRulesJSON),
+		Metrics:     metrics,
+	}
+	methodArn, err := testutil.TestMethodArnWithPath("GET", "/stores/s-1")
+	assert.NoError(t, err)
+
+	resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + testToken,
+		MethodArn:          methodArn,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+	assert.NotContains(t, resp.Context, "reason")
+	assert.Len(t, metrics.records, 1)
+}
+
+func Test_制限でDenyされる場合もシャドー評価が記録されること(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("shadow")
+	err := putTestRecord(testToken, map[string]types.AttributeValue{
+		"companyId": &types.AttributeValueMemberS{Value: "99999"},
+		"scopes":    &types.AttributeValueMemberSS{Value: []string{"read:stores"}},
+		// テストの methodArn のステージ（test）は許可しない
+		"stages": &types.AttributeValueMemberSS{Value: []string{"prod"}},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(testToken)
+
+	metrics := &recordingMetrics{}
+	auth := &Authorizer{
+		TableName:   TestTableName,
+		DDBClient:   testDDBClient,
+		Rules:       mustParseRuleSet(t, testRulesJSON),
+		ShadowRules: mustParseRuleSet(t, testShadowRulesJSON),
+		Metrics:     metrics,
+	}
+	methodArn, err := testutil.TestMethodArnWithPath("GET", "/stores/s-1")
+	assert.NoError(t, err)
+
+	resp, err := auth.Handler(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + testToken,
+		MethodArn:          methodArn,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+	assert.Equal(t, ReasonStageNotAllowed, resp.Context["reason"])
+	assert.Equal(t, []recordedMetric{{Name: MetricShadowDecisionMismatch, Dimensions: map[string]string{"Active": "Allow", "Shadow": "Deny"}}}, metrics.records)
+}
+
+func Test_EMF形式でメトリクスが出力されること(t *testing.T) {
+	var buf bytes.Buffer
+	m := &EMFMetrics{
+		Namespace: MetricsNamespace,
+		Writer:    &buf,
+		Now:       func() time.Time { return time.UnixMilli(1_700_000_000_000) },
+	}
+
+	m.Count(MetricShadowDecisionMismatch, map[string]string{"Shadow": "Deny", "Active": "Allow"})
+
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": float64(1_700_000_000_000),
+			"CloudWatchMetrics": []interface{}{
+				map[string]interface{}{
+					"Namespace":  MetricsNamespace,
+					"Dimensions": []interface{}{[]interface{}{"Active", "Shadow"}},
+					"Metrics":    []interface{}{map[string]interface{}{"Name": MetricShadowDecisionMismatch, "Unit": "Count"}},
+				},
+			},
+		},
+		"Active":                     "Allow",
+		"Shadow":                     "Deny",
+		MetricShadowDecisionMismatch: float64(1),
+	}, got)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// TenantAPIKeys はテナント（companyId）ごとの usage plan の API キー（キーの値）
+// トークンの項目に apiKey 属性がない呼び出し元（JWT・PASETO・イントロスペクション・HMAC 等）は
+// テナントのキーで usage plan を適用する
+type TenantAPIKeys map[string]string
+
+// NewTenantAPIKeysFromEnv は AUTHZ_TENANT_API_KEYS（{"<companyId>": "<API キーの値>"} の JSON）から TenantAPIKeys を作成する
+// 未設定の場合は nil を返す（トークンの apiKey 属性のみを使う）
+func NewTenantAPIKeysFromEnv() (TenantAPIKeys, error) {
+	raw := os.Getenv("AUTHZ_TENANT_API_KEYS")
+	if raw == "" {
+		return nil, nil
+	}
+	var keys TenantAPIKeys
+	if err := json.Unmarshal([]byte(raw), &keys); err != nil {
+		return nil, fmt.Errorf("invalid AUTHZ_TENANT_API_KEYS: %w", err)
+	}
+	for companyID, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("invalid AUTHZ_TENANT_API_KEYS: empty API key for company %q", companyID)
+		}
+	}
+	return keys, nil
+}
+
+// usageIdentifierKey は Allow 時に usageIdentifierKey として返す API キーを返す
+// トークンの apiKey 属性を優先し、ない場合はテナントのキーを使う（どちらもない場合は空）
+// usage plan を使う場合、各メソッドは API キー必須のため、キーのない呼び出し元は API Gateway が 403 にする
+// なりすまし（act-as）の場合は元の呼び出し元のテナントで計測し、サポート担当者の呼び出しをなりすまし先の使用量に含めない
+func (a *Authorizer) usageIdentifierKey(id *Identity) string {
+	if id.APIKey != "" {
+		return id.APIKey
+	}
+	if id.ActorCompanyID != "" {
+		return a.TenantAPIKeys[id.ActorCompanyID]
+	}
+	return a.TenantAPIKeys[id.CompanyID]
+}
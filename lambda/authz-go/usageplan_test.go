@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_テナントのAPIキーを環境変数から読み込めること(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    TenantAPIKeys
+		wantErr string
+	}{
+		{name: "未設定", env: "", want: nil},
+		{name: "テナントごとのキー", env: `{"12345": "tenant-a-api-key-0000000000"}`, want: TenantAPIKeys{"12345": "tenant-a-api-key-0000000000"}},
+		{name: "不正なJSON", env: `["12345"]`, wantErr: "invalid AUTHZ_TENANT_API_KEYS"},
+		{name: "空のキー", env: `{"12345": ""}`, wantErr: `empty API key for company "12345"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AUTHZ_TENANT_API_KEYS", tt.env)
+
+			got, err := NewTenantAPIKeysFromEnv()
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_APIキー属性のない呼び出し元にテナントのAPIキーが使われること(t *testing.T) {
+	a := &Authorizer{TenantAPIKeys: TenantAPIKeys{
+		"12345": "tenant-a-api-key-0000000000",
+		"67890": "tenant-b-api-key-0000000000",
+	}}
+
+	tests := []struct {
+		name     string
+		identity *Identity
+		want     string
+	}{
+		{"トークンのAPIキーを優先すること", &Identity{CompanyID: "12345", APIKey: "token-api-key-000000000000"}, "token-api-key-000000000000"},
+		{"APIキーがなければテナントのキーを使うこと", &Identity{CompanyID: "12345"}, "tenant-a-api-key-0000000000"},
+		{"テナントのキーもなければ空になること", &Identity{CompanyID: "99999"}, ""},
+		{"なりすましの場合は元の呼び出し元のトークンのキーを使うこと", &Identity{CompanyID: "67890", ActorCompanyID: "12345", APIKey: "token-api-key-000000000000"}, "token-api-key-000000000000"},
+		{"なりすましの場合は元の呼び出し元のテナントのキーを使うこと", &Identity{CompanyID: "67890", ActorCompanyID: "12345"}, "tenant-a-api-key-0000000000"},
+		{"元の呼び出し元のテナントのキーがなければなりすまし先のキーを使わないこと", &Identity{CompanyID: "67890", ActorCompanyID: "99999"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, a.usageIdentifierKey(tt.identity))
+		})
+	}
+}
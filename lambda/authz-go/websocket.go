@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	// DefaultWebSocketTokenQueryParam はトークンを渡すクエリパラメータのデフォルト名
+	DefaultWebSocketTokenQueryParam = "token"
+	// WebSocketTokenProtocolPrefix は Sec-WebSocket-Protocol でトークンを渡す場合のサブプロトコルのプレフィックス
+	// 例: Sec-WebSocket-Protocol: live-updates, bearer.<token>
+	WebSocketTokenProtocolPrefix = "bearer."
+)
+
+// WebSocketConnectEvent は WebSocket API の $connect ルートで REQUEST タイプの Authorizer に渡されるイベント
+// methodArn は arn:aws:execute-api:{region}:{accountId}:{apiId}/{stage}/$connect の形式
+type WebSocketConnectEvent struct {
+	Type                  string                         `json:"type"`
+	MethodArn             string                         `json:"methodArn"`
+	Headers               map[string]string              `json:"headers"`
+	QueryStringParameters map[string]string              `json:"queryStringParameters"`
+	RequestContext        WebSocketConnectRequestContext `json:"requestContext"`
+}
+
+// WebSocketConnectRequestContext は $connect イベントの requestContext
+type WebSocketConnectRequestContext struct {
+	RouteKey     string                                                      `json:"routeKey"`
+	EventType    string                                                      `json:"eventType"`
+	ConnectionID string                                                      `json:"connectionId"`
+	Identity     events.APIGatewayCustomAuthorizerRequestTypeRequestIdentity `json:"identity"`
+}
+
+// isWebSocketConnect は REQUEST タイプのイベントが WebSocket の $connect かを判定する
+func isWebSocketConnect(rc WebSocketConnectRequestContext) bool {
+	return rc.EventType == "CONNECT" || rc.RouteKey == "$connect"
+}
+
+// WebSocketConnectHandler は WebSocket API の $connect ルートの Authorizer ハンドラ
+// ブラウザの WebSocket API はヘッダーを設定できないため、トークンはクエリパラメータ
+// または Sec-WebSocket-Protocol ヘッダーのサブプロトコル（bearer.<token>）から取得する
+// トークン取得後の検証と context は REST API と同じ
+func (a *Authorizer) WebSocketConnectHandler(ctx context.Context, event WebSocketConnectEvent) (events.APIGatewayCustomAuthorizerResponse, error) {
+	headers := make(map[string]string, len(event.Headers))
+	for k, v := range event.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+
+	param := a.WebSocketTokenQueryParam
+	if param == "" {
+		param = DefaultWebSocketTokenQueryParam
+	}
+
+	token := event.QueryStringParameters[param]
+	if token == "" {
+		token = tokenFromWebSocketProtocol(headers["sec-websocket-protocol"])
+	}
+
+	return a.authorize(ctx, authRequest{
+		AuthorizationToken: token,
+		MethodArn:          event.MethodArn,
+		Headers:            headers,
+		SourceIP:           event.RequestContext.Identity.SourceIP,
+	})
+}
+
+// tokenFromWebSocketProtocol はカンマ区切りのサブプロトコルから bearer.<token> 形式のトークンを取り出す
+func tokenFromWebSocketProtocol(header string) string {
+	for _, p := range strings.Split(header, ",") {
+		p = strings.TrimSpace(p)
+		if token, ok := strings.CutPrefix(p, WebSocketTokenProtocolPrefix); ok {
+			return token
+		}
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConnectArn = "arn:aws:execute-api:ap-northeast-1:000000000000:ws123/test/$connect"
+
+// ヘルパー関数: WebSocket $connect の Authorizer イベントを作成
+func connectPayload(t *testing.T, query, headers map[string]string) json.RawMessage {
+	t.Helper()
+	payload, err := json.Marshal(map[string]interface{}{
+		"type":                  "REQUEST",
+		"methodArn":             testConnectArn,
+		"headers":               headers,
+		"queryStringParameters": query,
+		"requestContext": map[string]interface{}{
+			"routeKey":     "$connect",
+			"eventType":    "CONNECT",
+			"connectionId": "conn-1",
+			"identity":     map[string]string{"sourceIp": "203.0.113.1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode event: %v", err)
+	}
+	return payload
+}
+
+func Test_WebSocketのconnectルートでクエリまたはサブプロトコルのトークンが検証されること(t *testing.T) {
+	testToken := testutil.GenerateUniqueID("ws")
+	err := putTestRecord(testToken, map[string]types.AttributeValue{
+		"clientId": &types.AttributeValueMemberS{Value: "browser-app"},
+		"scopes":   &types.AttributeValueMemberSS{Value: []string{"read:stores"}},
+	})
+	assert.NoError(t, err)
+	defer deleteTestToken(testToken)
+
+	rules, err := ParseRuleSet(defaultRules)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		queryParam string
+		query      map[string]string
+		headers    map[string]string
+		effect     string
+	}{
+		{"クエリパラメータのトークンでAllowになること", "", map[string]string{"token": testToken}, nil, "Allow"},
+		{"設定したクエリパラメータ名で取得できること", "access_token", map[string]string{"access_token": testToken}, nil, "Allow"},
+		{"サブプロトコルのトークンでAllowになること", "", nil, map[string]string{"Sec-WebSocket-Protocol": "store-updates, bearer." + testToken}, "Allow"},
+		{"トークンがなければDenyになること", "", map[string]string{"other": "x"}, map[string]string{"Sec-WebSocket-Protocol": "store-updates"}, "Deny"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &Authorizer{
+				TableName:                TestTableName,
+				DDBClient:                testDDBClient,
+				Rules:                    rules,
+				WebSocketTokenQueryParam: tt.queryParam,
+			}
+
+			resp, err := auth.Invoke(context.Background(), connectPayload(t, tt.query, tt.headers))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.PolicyDocument.Statement[0].Effect)
+			assert.Equal(t, []string{testConnectArn}, resp.PolicyDocument.Statement[0].Resource)
+			if tt.effect == "Allow" {
+				// REST API と同じ context が返る
+				assert.Equal(t, "browser-app", resp.PrincipalID)
+				assert.Equal(t, "read:stores", resp.Context["scope"])
+				assert.Equal(t, "browser-app", resp.Context["clientId"])
+			}
+		})
+	}
+}
+
+func Test_サブプロトコルからトークンが取り出されること(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"bearer.abc", "abc"},
+		{"store-updates, bearer.abc.def", "abc.def"},
+		{"store-updates", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, tokenFromWebSocketProtocol(tt.header))
+		})
+	}
+}
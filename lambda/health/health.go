@@ -0,0 +1,91 @@
+// Package health は Lambda のヘルスチェック・ウォームアップイベントを扱う
+//
+// 定期的なウォームアップ（EventBridge のスケジュール）やデプロイ後のスモークチェックで、
+// 認可処理を通さずに依存先（DynamoDB・署名鍵等）を確認し、結果をレポートとして返す
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// EventType はヘルスチェックイベントの type（{"type":"HEALTH_CHECK"}）
+	EventType = "HEALTH_CHECK"
+	// DefaultCheckTimeout は1つの確認に使える時間
+	DefaultCheckTimeout = 3 * time.Second
+)
+
+// 確認結果の状態
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// IsEvent はペイロードがヘルスチェックイベントかを返す
+// EventBridge のスケジュールイベント（ウォームアップ）もヘルスチェックとして扱う
+func IsEvent(payload []byte) bool {
+	var probe struct {
+		Type       string `json:"type"`
+		Source     string `json:"source"`
+		DetailType string `json:"detail-type"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return false
+	}
+	return probe.Type == EventType || (probe.Source == "aws.events" && probe.DetailType == "Scheduled Event")
+}
+
+// Check は1つの依存先の確認
+type Check struct {
+	Name string
+	// Run は依存先を確認し、利用できない場合はエラーを返す
+	Run func(ctx context.Context) error
+}
+
+// Result は1つの確認の結果
+type Result struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report はヘルスチェックのレポート（いずれかの確認が失敗した場合は Status が fail）
+type Report struct {
+	Service   string   `json:"service"`
+	Status    string   `json:"status"`
+	CheckedAt string   `json:"checkedAt"`
+	Checks    []Result `json:"checks"`
+}
+
+// Run は確認を順に実行してレポートを返す
+// 各確認は DefaultCheckTimeout で打ち切り、失敗しても残りの確認を続ける
+func Run(ctx context.Context, service string, checks []Check, now time.Time) Report {
+	report := Report{
+		Service:   service,
+		Status:    StatusOK,
+		CheckedAt: now.UTC().Format(time.RFC3339),
+		Checks:    make([]Result, 0, len(checks)),
+	}
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, DefaultCheckTimeout)
+		start := time.Now()
+		err := c.Run(checkCtx)
+		cancel()
+
+		result := Result{
+			Name:      c.Name,
+			Status:    StatusOK,
+			LatencyMs: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			result.Status = StatusFail
+			result.Error = err.Error()
+			report.Status = StatusFail
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
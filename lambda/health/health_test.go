@@ -0,0 +1,63 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ヘルスチェックイベントを判別できること(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    bool
+	}{
+		{"HEALTH_CHECKタイプ", `{"type":"HEALTH_CHECK"}`, true},
+		{"EventBridgeのスケジュールイベント", `{"source":"aws.events","detail-type":"Scheduled Event","detail":{}}`, true},
+		{"Authorizerのイベント", `{"type":"TOKEN","authorizationToken":"Bearer allow"}`, false},
+		{"別のEventBridgeイベント", `{"source":"aws.events","detail-type":"EC2 Instance State-change Notification"}`, false},
+		{"JSONでない", `not json`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsEvent([]byte(tt.payload)))
+		})
+	}
+}
+
+func Test_いずれかの確認が失敗した場合はfailになること(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	checks := []Check{
+		{Name: "ok", Run: func(ctx context.Context) error { return nil }},
+		{Name: "broken", Run: func(ctx context.Context) error { return errors.New("unavailable") }},
+		{Name: "deadline", Run: func(ctx context.Context) error {
+			if _, ok := ctx.Deadline(); !ok {
+				return errors.New("no deadline")
+			}
+			return nil
+		}},
+	}
+
+	report := Run(context.Background(), "svc", checks, now)
+
+	assert.Equal(t, "svc", report.Service)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, "2026-10-19T12:00:00Z", report.CheckedAt)
+	if assert.Len(t, report.Checks, 3) {
+		assert.Equal(t, StatusOK, report.Checks[0].Status)
+		assert.Equal(t, StatusFail, report.Checks[1].Status)
+		assert.Equal(t, "unavailable", report.Checks[1].Error)
+		assert.Equal(t, StatusOK, report.Checks[2].Status, "各確認にはタイムアウトが設定される")
+	}
+}
+
+func Test_確認がない場合はokになること(t *testing.T) {
+	report := Run(context.Background(), "svc", nil, time.Now())
+
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Empty(t, report.Checks)
+}
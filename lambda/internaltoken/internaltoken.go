@@ -0,0 +1,169 @@
+// Package internaltoken は Authorizer がバックエンドに渡す内部トークンを扱う
+//
+// 内部トークンは Authorizer と各バックエンドで共有する鍵で署名した HS256 の JWT で、
+// 認可済みの呼び出し元（テナント・スコープ等）を表す。バックエンドは X-Company-Id 等の
+// ヘッダーを信頼せず、内部トークンを検証してクレームから値を取得する
+package internaltoken
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultIssuer は内部トークンの iss
+	DefaultIssuer = "authz-go"
+	// DefaultAudience は内部トークンの aud（バックエンド共通）
+	DefaultAudience = "backend"
+	// DefaultTTL は内部トークンの有効期間
+	// API Gateway は認可結果（context）をキャッシュするため、キャッシュの TTL より長くする
+	DefaultTTL = 10 * time.Minute
+	// DefaultLeeway は exp・iat の検査で許容する時刻のずれ
+	DefaultLeeway = 30 * time.Second
+	// MinKeyLength は署名鍵の最小のバイト数（HS256 のハッシュ長）
+	MinKeyLength = 32
+)
+
+// ErrMissing は内部トークンがないことを表す
+var ErrMissing = errors.New("internal token is missing")
+
+// Claims は内部トークンのクレーム
+// sub は Authorizer の principalId
+type Claims struct {
+	CompanyID string `json:"company_id,omitempty"`
+	// Scope はスペース区切りのスコープ（Authorizer の context と同じ形式）
+	Scope string `json:"scope,omitempty"`
+	// Actor はなりすましの場合の元の呼び出し元
+	Actor string `json:"actor,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Scopes はスコープの一覧を返す
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// Signer は内部トークンを発行する
+type Signer struct {
+	Key      []byte
+	Issuer   string
+	Audience string
+	TTL      time.Duration
+}
+
+// Verifier は内部トークンを検証する
+type Verifier struct {
+	Key      []byte
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// KeyFromEnv は INTERNAL_TOKEN_SIGNING_KEY から署名鍵を読み込む（未設定の場合は nil）
+func KeyFromEnv() ([]byte, error) {
+	key := os.Getenv("INTERNAL_TOKEN_SIGNING_KEY")
+	if key == "" {
+		return nil, nil
+	}
+	if len(key) < MinKeyLength {
+		return nil, fmt.Errorf("INTERNAL_TOKEN_SIGNING_KEY must be at least %d bytes", MinKeyLength)
+	}
+	return []byte(key), nil
+}
+
+// NewSignerFromEnv は環境変数から Signer を作成する
+// INTERNAL_TOKEN_SIGNING_KEY が未設定の場合は nil を返す
+// 有効期間は INTERNAL_TOKEN_TTL_SECONDS、aud は INTERNAL_TOKEN_AUDIENCE で変更できる
+func NewSignerFromEnv() (*Signer, error) {
+	key, err := KeyFromEnv()
+	if err != nil || key == nil {
+		return nil, err
+	}
+	ttl := DefaultTTL
+	if v := os.Getenv("INTERNAL_TOKEN_TTL_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid INTERNAL_TOKEN_TTL_SECONDS: %q", v)
+		}
+		ttl = time.Duration(n) * time.Second
+	}
+	return &Signer{
+		Key:      key,
+		Issuer:   DefaultIssuer,
+		Audience: audienceFromEnv(),
+		TTL:      ttl,
+	}, nil
+}
+
+// NewVerifierFromEnv は環境変数から Verifier を作成する
+// INTERNAL_TOKEN_SIGNING_KEY が未設定の場合は nil を返す
+func NewVerifierFromEnv() (*Verifier, error) {
+	key, err := KeyFromEnv()
+	if err != nil || key == nil {
+		return nil, err
+	}
+	return &Verifier{
+		Key:      key,
+		Issuer:   DefaultIssuer,
+		Audience: audienceFromEnv(),
+		Leeway:   DefaultLeeway,
+	}, nil
+}
+
+func audienceFromEnv() string {
+	if v := os.Getenv("INTERNAL_TOKEN_AUDIENCE"); v != "" {
+		return v
+	}
+	return DefaultAudience
+}
+
+// Sign は subject（principalId）とクレームから内部トークンを発行する
+func (s *Signer) Sign(subject string, claims Claims, now time.Time) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    s.Issuer,
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{s.Audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.TTL)),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.Key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign internal token: %w", err)
+	}
+	return token, nil
+}
+
+// Verify は内部トークンの署名・有効期限・iss・aud を検証してクレームを返す
+// "Bearer " で始まる場合は取り除いてから検証する
+func (v *Verifier) Verify(token string, now time.Time) (*Claims, error) {
+	token = strings.TrimSpace(token)
+	if len(token) > len("Bearer ") && strings.EqualFold(token[:len("Bearer ")], "Bearer ") {
+		token = strings.TrimSpace(token[len("Bearer "):])
+	}
+	if token == "" {
+		return nil, ErrMissing
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return v.Key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(v.Issuer),
+		jwt.WithAudience(v.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(v.Leeway),
+		jwt.WithTimeFunc(func() time.Time { return now }),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid internal token: %w", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,152 @@
+package internaltoken
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testKey = []byte(strings.Repeat("k", MinKeyLength))
+	testNow = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+)
+
+func testSigner() *Signer {
+	return &Signer{Key: testKey, Issuer: DefaultIssuer, Audience: DefaultAudience, TTL: DefaultTTL}
+}
+
+func testVerifier() *Verifier {
+	return &Verifier{Key: testKey, Issuer: DefaultIssuer, Audience: DefaultAudience, Leeway: DefaultLeeway}
+}
+
+func Test_発行した内部トークンを検証してクレームを取得できること(t *testing.T) {
+	token, err := testSigner().Sign("user-1", Claims{
+		CompanyID: "12345",
+		Scope:     "read:stores write:stores",
+		Actor:     "support-1",
+	}, testNow)
+	assert.NoError(t, err)
+
+	for _, value := range []string{token, "Bearer " + token, "bearer " + token} {
+		claims, err := testVerifier().Verify(value, testNow.Add(time.Minute))
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, "user-1", claims.Subject)
+			assert.Equal(t, "12345", claims.CompanyID)
+			assert.Equal(t, []string{"read:stores", "write:stores"}, claims.Scopes())
+			assert.Equal(t, "support-1", claims.Actor)
+		}
+	}
+}
+
+func Test_不正な内部トークンは検証に失敗すること(t *testing.T) {
+	valid, err := testSigner().Sign("user-1", Claims{CompanyID: "12345"}, testNow)
+	assert.NoError(t, err)
+
+	otherKey := testSigner()
+	otherKey.Key = []byte(strings.Repeat("x", MinKeyLength))
+	wrongKey, _ := otherKey.Sign("user-1", Claims{CompanyID: "12345"}, testNow)
+
+	otherAudience := testSigner()
+	otherAudience.Audience = "other"
+	wrongAudience, _ := otherAudience.Sign("user-1", Claims{CompanyID: "12345"}, testNow)
+
+	otherIssuer := testSigner()
+	otherIssuer.Issuer = "other"
+	wrongIssuer, _ := otherIssuer.Sign("user-1", Claims{CompanyID: "12345"}, testNow)
+
+	noExp, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		CompanyID: "12345",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   DefaultIssuer,
+			Audience: jwt.ClaimStrings{DefaultAudience},
+		},
+	}).SignedString(testKey)
+
+	parts := strings.Split(valid, ".")
+	unsigned := parts[0] + "." + parts[1] + "."
+
+	tests := []struct {
+		name  string
+		token string
+		now   time.Time
+	}{
+		{name: "空", token: "", now: testNow},
+		{name: "Bearerのみ", token: "Bearer ", now: testNow},
+		{name: "JWTでない", token: "internal_abc", now: testNow},
+		{name: "署名の鍵が異なる", token: wrongKey, now: testNow},
+		{name: "署名がない", token: unsigned, now: testNow},
+		{name: "audが異なる", token: wrongAudience, now: testNow},
+		{name: "issが異なる", token: wrongIssuer, now: testNow},
+		{name: "expがない", token: noExp, now: testNow},
+		{name: "期限切れ", token: valid, now: testNow.Add(DefaultTTL + DefaultLeeway + time.Second)},
+		{name: "発行時刻が未来", token: valid, now: testNow.Add(-DefaultLeeway - time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testVerifier().Verify(tt.token, tt.now)
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_内部トークンがない場合はErrMissingが返ること(t *testing.T) {
+	_, err := testVerifier().Verify("  ", testNow)
+
+	assert.ErrorIs(t, err, ErrMissing)
+}
+
+func Test_環境変数から署名と検証の設定を読み込めること(t *testing.T) {
+	t.Run("未設定の場合はnil", func(t *testing.T) {
+		t.Setenv("INTERNAL_TOKEN_SIGNING_KEY", "")
+
+		signer, err := NewSignerFromEnv()
+		assert.NoError(t, err)
+		assert.Nil(t, signer)
+
+		verifier, err := NewVerifierFromEnv()
+		assert.NoError(t, err)
+		assert.Nil(t, verifier)
+	})
+
+	t.Run("設定した値を使うこと", func(t *testing.T) {
+		t.Setenv("INTERNAL_TOKEN_SIGNING_KEY", string(testKey))
+		t.Setenv("INTERNAL_TOKEN_AUDIENCE", "stores-api")
+		t.Setenv("INTERNAL_TOKEN_TTL_SECONDS", "60")
+
+		signer, err := NewSignerFromEnv()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "stores-api", signer.Audience)
+			assert.Equal(t, time.Minute, signer.TTL)
+		}
+		verifier, err := NewVerifierFromEnv()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "stores-api", verifier.Audience)
+		}
+	})
+
+	tests := []struct {
+		name string
+		key  string
+		ttl  string
+	}{
+		{name: "鍵が短い", key: "short", ttl: ""},
+		{name: "TTLが数値でない", key: string(testKey), ttl: "abc"},
+		{name: "TTLが0", key: string(testKey), ttl: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INTERNAL_TOKEN_SIGNING_KEY", tt.key)
+			t.Setenv("INTERNAL_TOKEN_TTL_SECONDS", tt.ttl)
+
+			_, err := NewSignerFromEnv()
+
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package apierror は test-function が返すエラーの種類（コード）とエラーレスポンスのボディを扱う
+//
+// 非Proxy統合では Lambda のエラーの errorMessage が "[<コード>] <メッセージ>" の形式になり、
+// API Gateway の統合レスポンスがコードの接頭辞でステータスコードを選択する。
+// Proxy統合では同じコードからステータスコードを決め、ボディ（Body）を直接返す。
+// ボディの形式は backend-server のエラーレスポンスと共通（Body・Code を変更する場合は backend-server の ErrorResponse・writeError も変更すること）
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Code はエラーの種類
+// errorMessage の接頭辞になるため、値を変更する場合は API Gateway の統合レスポンスのパターンも変更すること
+type Code string
+
+const (
+	// CodeValidation はリクエストの内容が不正な場合（400）
+	CodeValidation Code = "VALIDATION_ERROR"
+	// CodeUnauthorized は内部トークンがない・不正な場合（401）
+	CodeUnauthorized Code = "UNAUTHORIZED"
+	// CodeForbidden はスコープ・テナントが不足している場合（403）
+	CodeForbidden Code = "FORBIDDEN"
+	// CodeNotFound はリソースが存在しない場合（404）
+	CodeNotFound Code = "NOT_FOUND"
+	// CodeMethodNotAllowed はパスに対応していないメソッドの場合（405）
+	CodeMethodNotAllowed Code = "METHOD_NOT_ALLOWED"
+	// CodeConflict はリソースが既に存在する場合（409）
+	CodeConflict Code = "CONFLICT"
+	// CodeInternal はそれ以外のエラー（500）
+	CodeInternal Code = "INTERNAL_ERROR"
+)
+
+// StatusCode はコードに対応する HTTP ステータスコードを返す（未知のコードは 500）
+func (c Code) StatusCode() int {
+	switch c {
+	case CodeValidation:
+		return http.StatusBadRequest
+	case CodeUnauthorized:
+		return http.StatusUnauthorized
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case CodeConflict:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Error はコード付きのエラー
+// Message はそのままレスポンスに含めるため、内部の詳細（DynamoDB のエラー・トークンの内容等）は含めない
+type Error struct {
+	Code    Code
+	Message string
+}
+
+// Error は "[<コード>] <メッセージ>" の形式で返す
+func (e *Error) Error() string {
+	return "[" + string(e.Code) + "] " + e.Message
+}
+
+// StatusCode はエラーに対応する HTTP ステータスコードを返す
+func (e *Error) StatusCode() int {
+	return e.Code.StatusCode()
+}
+
+// Body はエラーレスポンスのボディを返す
+func (e *Error) Body() Body {
+	return Body{Status: StatusError, Code: e.Code, Message: e.Message}
+}
+
+// StatusError はエラーレスポンスの status
+const StatusError = "error"
+
+// Body はエラーレスポンスのボディ
+//
+//	{"status": "error", "code": "NOT_FOUND", "message": "store s-1 not found"}
+type Body struct {
+	Status  string `json:"status"`
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+}
+
+// Validation はリクエストの内容が不正なことを表すエラーを返す
+func Validation(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeValidation, Message: fmt.Sprintf(format, args...)}
+}
+
+// Unauthorized は内部トークンで呼び出し元を確認できなかったことを表すエラーを返す
+func Unauthorized(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeUnauthorized, Message: fmt.Sprintf(format, args...)}
+}
+
+// Forbidden は呼び出し元に権限がないことを表すエラーを返す
+func Forbidden(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeForbidden, Message: fmt.Sprintf(format, args...)}
+}
+
+// NotFound はリソースが存在しないことを表すエラーを返す
+func NotFound(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+// MethodNotAllowed はメソッドに対応していないことを表すエラーを返す
+func MethodNotAllowed(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeMethodNotAllowed, Message: fmt.Sprintf(format, args...)}
+}
+
+// Conflict はリソースが既に存在することを表すエラーを返す
+func Conflict(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+// Internal は内部エラーを返す（詳細は呼び出し元でログに出力し、レスポンスには含めない）
+func Internal() *Error {
+	return &Error{Code: CodeInternal, Message: "internal server error"}
+}
+
+// From は err がコード付きのエラーの場合はそのまま返し、それ以外は Internal を返す
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return Internal()
+}
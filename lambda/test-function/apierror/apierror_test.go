@@ -0,0 +1,81 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_コードに対応するステータスコードとエラーメッセージになること(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        *Error
+		wantStatus int
+		wantError  string
+	}{
+		{"Validation", Validation("name must be at most %d characters", 100), http.StatusBadRequest, "[VALIDATION_ERROR] name must be at most 100 characters"},
+		{"Unauthorized", Unauthorized("missing internal token"), http.StatusUnauthorized, "[UNAUTHORIZED] missing internal token"},
+		{"Forbidden", Forbidden("%s scope is required", "write:stores"), http.StatusForbidden, "[FORBIDDEN] write:stores scope is required"},
+		{"NotFound", NotFound("store %s not found", "s-1"), http.StatusNotFound, "[NOT_FOUND] store s-1 not found"},
+		{"MethodNotAllowed", MethodNotAllowed("method %s is not allowed", "PATCH"), http.StatusMethodNotAllowed, "[METHOD_NOT_ALLOWED] method PATCH is not allowed"},
+		{"Conflict", Conflict("store %s already exists", "s-1"), http.StatusConflict, "[CONFLICT] store s-1 already exists"},
+		{"Internal", Internal(), http.StatusInternalServerError, "[INTERNAL_ERROR] internal server error"},
+		{"未知のコード", &Error{Code: "UNKNOWN", Message: "x"}, http.StatusInternalServerError, "[UNKNOWN] x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantStatus, tt.err.StatusCode())
+			assert.EqualError(t, tt.err, tt.wantError)
+		})
+	}
+}
+
+func Test_エラーのボディが共通の形式になること(t *testing.T) {
+	body, err := json.Marshal(NotFound("store %s not found", "s-1").Body())
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"status":"error","code":"NOT_FOUND","message":"store s-1 not found"}`, string(body))
+}
+
+func Test_Fromはコードのないエラーを内部エラーにすること(t *testing.T) {
+	notFound := NotFound("store s-1 not found")
+
+	assert.Same(t, notFound, From(fmt.Errorf("wrapped: %w", notFound)))
+	assert.Equal(t, Internal(), From(errors.New("operation error DynamoDB: Query")))
+}
+
+// API Gateway の統合レスポンス（terraform/modules/apigateway）の selection_pattern と同じパターン
+// 各エラーがちょうど1つのパターンにマッチすることを確認する
+func Test_エラーメッセージが統合レスポンスのパターンで1つのステータスコードに対応すること(t *testing.T) {
+	// Go の regexp は否定先読みに対応しないため、500 のパターンは「4xx のパターンにマッチしない」で表す
+	patterns := map[int]*regexp.Regexp{
+		http.StatusBadRequest:       regexp.MustCompile(`^\[VALIDATION_ERROR\].*`),
+		http.StatusUnauthorized:     regexp.MustCompile(`^\[UNAUTHORIZED\].*`),
+		http.StatusForbidden:        regexp.MustCompile(`^\[FORBIDDEN\].*`),
+		http.StatusNotFound:         regexp.MustCompile(`^\[NOT_FOUND\].*`),
+		http.StatusMethodNotAllowed: regexp.MustCompile(`^\[METHOD_NOT_ALLOWED\].*`),
+		http.StatusConflict:         regexp.MustCompile(`^\[CONFLICT\].*`),
+	}
+	errs := []*Error{
+		Validation("v"), Unauthorized("u"), Forbidden("f"), NotFound("n"), MethodNotAllowed("m"), Conflict("c"), Internal(),
+	}
+
+	for _, e := range errs {
+		t.Run(string(e.Code), func(t *testing.T) {
+			matched := http.StatusInternalServerError
+			for status, p := range patterns {
+				if p.MatchString(e.Error()) {
+					matched = status
+				}
+			}
+
+			assert.Equal(t, e.StatusCode(), matched)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Headers はリクエストヘッダー（名前の大文字・小文字を区別せず、1つの名前に複数の値を持てる）
+//
+// イベントの形式によってヘッダーの渡され方が異なるため、読み込み時にそろえる
+//   - 非Proxy統合: マッピングテンプレートの headers（1つの名前に1つの値、名前はクライアントが送ったまま）
+//   - REST API の Proxy統合: headers と multiValueHeaders（multiValueHeaders にすべての値が入る）
+//   - HTTP API: headers（名前は小文字、同じ名前のヘッダーはカンマ区切りで1つの値になるため NewHTTPAPIHeaders で分ける）
+type Headers struct {
+	values http.Header
+}
+
+// NewHeaders はイベントのヘッダーから Headers を作成する
+// multi にある名前は multi の値を使い、それ以外は single の値を使う
+// 大文字・小文字だけが異なる名前は同じヘッダーの値としてまとめる
+func NewHeaders(single map[string]string, multi map[string][]string) Headers {
+	values := http.Header{}
+	for name, vs := range multi {
+		for _, v := range vs {
+			values.Add(name, v)
+		}
+	}
+	for name, v := range single {
+		if hasMultiValues(multi, name) {
+			continue
+		}
+		values.Add(name, v)
+	}
+	return Headers{values: values}
+}
+
+// NewHTTPAPIHeaders は HTTP API（ペイロード形式 2.0）のヘッダーから Headers を作成する
+// HTTP API は同じ名前のヘッダーをカンマ区切りの1つの値にまとめるため、カンマで分けて複数の値にする
+// （値にカンマを含むヘッダーも分かれるため、Get は最初の部分を返す）
+// Cookie はセミコロン区切りで、HTTP API では cookies で別に渡されるため分けない
+func NewHTTPAPIHeaders(headers map[string]string) Headers {
+	single := map[string]string{}
+	multi := make(map[string][]string, len(headers))
+	for name, v := range headers {
+		if http.CanonicalHeaderKey(name) == "Cookie" {
+			single[name] = v
+			continue
+		}
+		for _, part := range strings.Split(v, ",") {
+			multi[name] = append(multi[name], strings.TrimSpace(part))
+		}
+	}
+	return NewHeaders(single, multi)
+}
+
+// hasMultiValues は multi に名前（大文字・小文字を区別しない）のヘッダーがあるかを返す
+func hasMultiValues(multi map[string][]string, name string) bool {
+	canonical := http.CanonicalHeaderKey(name)
+	for k := range multi {
+		if http.CanonicalHeaderKey(k) == canonical {
+			return true
+		}
+	}
+	return false
+}
+
+// Get はヘッダーの最初の値を返す（ない場合は ""）
+func (h Headers) Get(name string) string {
+	return h.values.Get(name)
+}
+
+// Values はヘッダーのすべての値を返す
+func (h Headers) Values(name string) []string {
+	return h.values.Values(name)
+}
+
+// Single はヘッダーの値を1つだけ返す（ない場合は ""）
+// 呼び出し元の識別に使うヘッダーは、異なる値が複数ある場合にどれを信頼するか決められないためエラーにする
+// （マッピングテンプレートはクライアントが送ったヘッダーも含めるため、x-internal-token 等で値を追加できる）
+func (h Headers) Single(name string) (string, error) {
+	vs := h.values.Values(name)
+	if len(vs) == 0 {
+		return "", nil
+	}
+	for _, v := range vs[1:] {
+		if v != vs[0] {
+			return "", fmt.Errorf("header %s has %d different values", http.CanonicalHeaderKey(name), len(vs))
+		}
+	}
+	return vs[0], nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ヘッダー名の大文字と小文字を区別せずに値を取得できること(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{name: "正規化された名前", headers: map[string]string{"X-Internal-Token": "Bearer a"}},
+		{name: "小文字（HTTP API・HTTP/2）", headers: map[string]string{"x-internal-token": "Bearer a"}},
+		{name: "大文字", headers: map[string]string{"X-INTERNAL-TOKEN": "Bearer a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHeaders(tt.headers, nil)
+
+			assert.Equal(t, "Bearer a", h.Get("X-Internal-Token"))
+			assert.Equal(t, "Bearer a", h.Get("x-internal-token"))
+		})
+	}
+
+	assert.Equal(t, "", NewHeaders(nil, nil).Get("Authorization"))
+}
+
+func Test_複数の値を持つヘッダーはmultiValueHeadersの値を使うこと(t *testing.T) {
+	// REST API の Proxy統合では headers に最後の値、multiValueHeaders にすべての値が入る
+	h := NewHeaders(
+		map[string]string{"Accept": "text/html", "Host": "api.example.com"},
+		map[string][]string{"accept": {"application/json", "text/html"}},
+	)
+
+	assert.Equal(t, []string{"application/json", "text/html"}, h.Values("Accept"))
+	assert.Equal(t, "application/json", h.Get("Accept"))
+	assert.Equal(t, []string{"api.example.com"}, h.Values("Host"))
+}
+
+func Test_HTTP_APIのカンマ区切りのヘッダーが複数の値として読まれること(t *testing.T) {
+	h := NewHTTPAPIHeaders(map[string]string{
+		"accept":           "application/json, text/html",
+		"x-internal-token": "Bearer a,Bearer b",
+		"cookie":           "session=a, b; theme=dark",
+		"host":             "api.example.com",
+	})
+
+	assert.Equal(t, []string{"application/json", "text/html"}, h.Values("Accept"))
+	assert.Equal(t, []string{"session=a, b; theme=dark"}, h.Values("Cookie"))
+	assert.Equal(t, "api.example.com", h.Get("Host"))
+
+	// 同じ名前で送られた呼び出し元の識別に使うヘッダーを検出できる
+	_, err := h.Single("X-Internal-Token")
+	assert.ErrorContains(t, err, "header X-Internal-Token has 2 different values")
+}
+
+func Test_Singleは異なる値が複数ある場合にエラーになること(t *testing.T) {
+	tests := []struct {
+		name    string
+		single  map[string]string
+		multi   map[string][]string
+		want    string
+		wantErr bool
+	}{
+		{name: "1つの値", single: map[string]string{"X-Internal-Token": "Bearer a"}, want: "Bearer a"},
+		{name: "ヘッダーがない", single: map[string]string{}, want: ""},
+		{name: "同じ値が複数", multi: map[string][]string{"X-Internal-Token": {"Bearer a", "Bearer a"}}, want: "Bearer a"},
+		{name: "大文字と小文字が異なる名前で異なる値", single: map[string]string{"X-Internal-Token": "Bearer a", "x-internal-token": "Bearer b"}, wantErr: true},
+		{name: "multiValueHeadersに異なる値", multi: map[string][]string{"X-Internal-Token": {"Bearer a", "Bearer b"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewHeaders(tt.single, tt.multi).Single("X-Internal-Token")
+
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "header X-Internal-Token has 2 different values")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
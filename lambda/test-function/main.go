@@ -2,54 +2,425 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
+	"local-gateway/lambda/health"
+	"local-gateway/lambda/internaltoken"
+	"local-gateway/lambda/test-function/apierror"
+
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 )
 
-// Request は非Proxy統合のリクエスト形式
+// HealthServiceName はヘルスチェックのレポートに含めるサービス名
+const HealthServiceName = "test-function"
+
+// Request は非Proxy統合のリクエスト形式（マッピングテンプレートで組み立てる）
+// フィールド名は REST API の Proxy統合のイベントにそろえる
+// requestContext はイベントの形式の判定に使うため含めず、requestId 等は最上位に置く
 type Request struct {
 	Body       string            `json:"body"`
 	Headers    map[string]string `json:"headers"`
 	HTTPMethod string            `json:"httpMethod"`
-	Path       string            `json:"path"`
+	// Path はリクエストのパス（ステージ名を除いた $context.path）
+	Path string `json:"path"`
+	// Resource はリソースのパス（"/stores/{id}" 等、$context.resourcePath）
+	Resource string `json:"resource"`
+	// QueryStringParameters はクエリ文字列（デコード済み、同じ名前のパラメーターは1つの値）
+	QueryStringParameters map[string]string `json:"queryStringParameters"`
+	// PathParameters はリソースのパスの {name} に対応する値（デコード済み）
+	PathParameters map[string]string `json:"pathParameters"`
+	StageVariables map[string]string `json:"stageVariables"`
+	Stage          string            `json:"stage"`
+	RequestID      string            `json:"requestId"`
+	SourceIP       string            `json:"sourceIp"`
 }
 
 // Response は非Proxy統合のレスポンス形式
+// Proxy統合では同じ内容をレスポンスボディとして返す
 type Response struct {
-	Message          string            `json:"message"`
-	Status           string            `json:"status"`
-	ReceivedHeaders  map[string]string `json:"receivedHeaders"`
-	CompanyID        string            `json:"companyId,omitempty"`
-	Scope            string            `json:"scope,omitempty"`
-	InternalToken    string            `json:"internalToken,omitempty"`
-	OriginalAuthHeader string          `json:"originalAuthHeader,omitempty"`
+	Message            string            `json:"message"`
+	Status             string            `json:"status"`
+	ReceivedHeaders    map[string]string `json:"receivedHeaders"`
+	Path               string            `json:"path,omitempty"`
+	Query              url.Values        `json:"query,omitempty"`
+	StageVariables     map[string]string `json:"stageVariables,omitempty"`
+	RequestID          string            `json:"requestId,omitempty"`
+	SourceIP           string            `json:"sourceIp,omitempty"`
+	CompanyID          string            `json:"companyId,omitempty"`
+	Scope              string            `json:"scope,omitempty"`
+	InternalToken      string            `json:"internalToken,omitempty"`
+	Actor              string            `json:"actor,omitempty"`
+	OriginalAuthHeader string            `json:"originalAuthHeader,omitempty"`
+}
+
+// Backend は API Gateway から呼び出されるバックエンド
+type Backend struct {
+	// Verifier は内部トークンの検証（nil の場合はすべてのリクエストを拒否する）
+	Verifier *internaltoken.Verifier
+	// Stores は店舗APIのテーブル（nil の場合は店舗APIが 500 を返す）
+	Stores *StoreRepository
+	// Now は現在時刻を返す（テスト用に差し替え可能、nil の場合は time.Now）
+	Now func() time.Time
+}
+
+// NewBackend は環境変数から Backend を作成する
+// INTERNAL_TOKEN_SIGNING_KEY（Authorizer と同じ鍵）が未設定の場合、リクエストはすべて UNAUTHORIZED になる
+// 店舗APIのテーブル名は STORES_TABLE_NAME（未設定時は Stores）で変更できる
+func NewBackend(ctx context.Context) (*Backend, error) {
+	verifier, err := internaltoken.NewVerifierFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure internal token: %w", err)
+	}
+	if verifier == nil {
+		log.Printf("INTERNAL_TOKEN_SIGNING_KEY is not set, all requests will be rejected")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	tableName := os.Getenv("STORES_TABLE_NAME")
+	if tableName == "" {
+		tableName = DefaultStoresTableName
+	}
+
+	return &Backend{
+		Verifier: verifier,
+		Stores: &StoreRepository{
+			TableName: tableName,
+			DDBClient: dynamodb.NewFromConfig(cfg),
+		},
+	}, nil
+}
+
+func (b *Backend) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return time.Now()
 }
 
-func handler(ctx context.Context, event Request) (Response, error) {
+// handler は非Proxy統合のリクエストを処理する
+// 店舗APIはレスポンスボディを返し、エラーは Lambda のエラーとして返す（統合レスポンスでステータスコードを選択する）
+// エラーは常に apierror.Error で、errorMessage は "[<コード>] <メッセージ>" の形式になる
+// 店舗API以外のパスは受け取ったヘッダーと呼び出し元を返す
+func (b *Backend) handler(ctx context.Context, event Request) (interface{}, error) {
 	log.Printf("Received event: %+v", event)
-	// TODO: 本番環境ではログに出力しないこと	
+	// TODO: 本番環境ではログに出力しないこと
 	log.Printf("Headers: %+v", event.Headers)
 
-	// ヘッダーから各値を取得
-	companyID := event.Headers["X-Company-Id"]
-	scope := event.Headers["X-Scope"]
-	internalToken := event.Headers["X-Internal-Token"]
-	originalAuth := event.Headers["Authorization"]
+	// X-Company-Id 等のヘッダーは信頼せず、内部トークンのクレームから取得する
+	headers := NewHeaders(event.Headers, nil)
+	internalToken, err := headers.Single("X-Internal-Token")
+	if err != nil {
+		log.Printf("%v, rejecting request", err)
+		return nil, apierror.Unauthorized("ambiguous internal token")
+	}
+	values, err := b.verify(internalToken)
+	if err != nil {
+		return nil, err
+	}
+	values.InternalToken = internalToken
+
+	req := &apiRequest{
+		Method:         event.HTTPMethod,
+		Path:           event.Path,
+		Body:           event.Body,
+		Query:          newQuery(event.QueryStringParameters, nil),
+		StageVariables: event.StageVariables,
+		RequestID:      event.RequestID,
+		SourceIP:       event.SourceIP,
+		Caller:         values,
+	}
+	resp, matched, err := b.router().dispatch(ctx, req)
+	if !matched {
+		return newResponse(req, event.Headers, headers), nil
+	}
+	if err != nil {
+		return nil, b.apiError(req, err)
+	}
+	return resp.Body, nil
+}
+
+// router は店舗APIのルーターを返す
+func (b *Backend) router() *router {
+	return &router{routes: b.storeRoutes()}
+}
+
+// proxyHandler は REST API の Proxy統合（AWS_PROXY）のリクエストを処理する
+// 内部トークンは RequestContext.Authorizer から直接読む
+func (b *Backend) proxyHandler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	log.Printf("Received proxy event: %s %s", event.HTTPMethod, event.Path)
+	// TODO: 本番環境ではログに出力しないこと
+	log.Printf("Headers: %+v", event.Headers)
+
+	statusCode, body := b.proxyBody(ctx, &apiRequest{
+		Method:         event.HTTPMethod,
+		Path:           event.Path,
+		Body:           event.Body,
+		Query:          newQuery(event.QueryStringParameters, event.MultiValueQueryStringParameters),
+		StageVariables: event.StageVariables,
+		RequestID:      event.RequestContext.RequestID,
+		SourceIP:       event.RequestContext.Identity.SourceIP,
+	}, event.Headers, NewHeaders(event.Headers, event.MultiValueHeaders), event.RequestContext.Authorizer)
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       body,
+	}, nil
+}
+
+// httpAPIHandler は HTTP API（ペイロード形式 2.0）のリクエストを処理する
+// 内部トークンは RequestContext.Authorizer.Lambda から読む
+func (b *Backend) httpAPIHandler(ctx context.Context, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	log.Printf("Received HTTP API event: %s %s", event.RequestContext.HTTP.Method, event.RawPath)
+	// TODO: 本番環境ではログに出力しないこと
+	log.Printf("Headers: %+v", event.Headers)
+
+	var authorizer map[string]interface{}
+	if event.RequestContext.Authorizer != nil {
+		authorizer = event.RequestContext.Authorizer.Lambda
+	}
+	// ステージ名付きのステージ（$default 以外）では rawPath の先頭にステージ名が付く
+	path := event.RawPath
+	if stage := event.RequestContext.Stage; stage != "" && stage != "$default" {
+		path = strings.TrimPrefix(path, "/"+stage)
+	}
+	// queryStringParameters は同じ名前のパラメーターをカンマ区切りでまとめるため、rawQueryString を読む
+	query, err := url.ParseQuery(event.RawQueryString)
+	if err != nil {
+		log.Printf("Failed to parse query string, using queryStringParameters: %v", err)
+		query = newQuery(event.QueryStringParameters, nil)
+	}
+	statusCode, body := b.proxyBody(ctx, &apiRequest{
+		Method:         event.RequestContext.HTTP.Method,
+		Path:           path,
+		Body:           event.Body,
+		Query:          query,
+		StageVariables: event.StageVariables,
+		RequestID:      event.RequestContext.RequestID,
+		SourceIP:       event.RequestContext.HTTP.SourceIP,
+	}, event.Headers, NewHTTPAPIHeaders(event.Headers), authorizer)
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       body,
+	}, nil
+}
+
+// authorizerValues は内部トークンで検証した呼び出し元の値
+type authorizerValues struct {
+	CompanyID     string
+	Scope         string
+	InternalToken string
+	Actor         string
+}
+
+// verify は内部トークン（署名・有効期限・aud）を検証し、クレームから呼び出し元の値を返す
+// 内部トークンがない・不正な場合は UNAUTHORIZED のエラーを返す
+func (b *Backend) verify(internalToken string) (authorizerValues, error) {
+	if b.Verifier == nil {
+		log.Printf("Internal token verifier is not configured, rejecting request")
+		return authorizerValues{}, apierror.Unauthorized("internal token cannot be verified")
+	}
+	claims, err := b.Verifier.Verify(internalToken, b.now())
+	if errors.Is(err, internaltoken.ErrMissing) {
+		log.Printf("Internal token is missing, rejecting request")
+		return authorizerValues{}, apierror.Unauthorized("missing internal token")
+	}
+	if err != nil {
+		log.Printf("%v, rejecting request", err)
+		return authorizerValues{}, apierror.Unauthorized("invalid internal token")
+	}
+	return authorizerValues{
+		CompanyID: claims.CompanyID,
+		Scope:     claims.Scope,
+		Actor:     claims.Actor,
+	}, nil
+}
+
+// contextString は Authorizer の context の値を文字列として返す
+// REST API では値がすべて文字列になるが、HTTP API では元の型のまま渡される
+func contextString(authorizer map[string]interface{}, key string) string {
+	v, ok := authorizer[key]
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// newQuery はイベントのクエリ文字列を url.Values にする
+// multi にある名前は multi の値を使い、それ以外は single の値を使う
+func newQuery(single map[string]string, multi map[string][]string) url.Values {
+	query := url.Values{}
+	for name, vs := range multi {
+		query[name] = append([]string(nil), vs...)
+	}
+	for name, v := range single {
+		if _, ok := multi[name]; !ok {
+			query.Set(name, v)
+		}
+	}
+	return query
+}
 
-	response := Response{
+// newResponse は受け取ったリクエスト（received はイベントのままのヘッダー）と呼び出し元を返すレスポンスを作成する
+func newResponse(req *apiRequest, received map[string]string, headers Headers) Response {
+	values := req.Caller
+	return Response{
 		Message:            "Hello from test-function!",
 		Status:             "success",
-		ReceivedHeaders:    event.Headers,
-		CompanyID:          companyID,
-		Scope:              scope,
-		InternalToken:      internalToken,
-		OriginalAuthHeader: originalAuth,
+		ReceivedHeaders:    received,
+		Path:               req.Path,
+		Query:              req.Query,
+		StageVariables:     req.StageVariables,
+		RequestID:          req.RequestID,
+		SourceIP:           req.SourceIP,
+		CompanyID:          values.CompanyID,
+		Scope:              values.Scope,
+		InternalToken:      values.InternalToken,
+		Actor:              values.Actor,
+		OriginalAuthHeader: headers.Get("Authorization"),
+	}
+}
+
+// proxyBody は Proxy統合のステータスコードとレスポンスボディを返す
+// エラーはコードに対応するステータスコードと apierror.Body のボディを返す
+func (b *Backend) proxyBody(ctx context.Context, req *apiRequest, received map[string]string, headers Headers, authorizer map[string]interface{}) (int, string) {
+	internalToken := contextString(authorizer, "internalToken")
+	values, err := b.verify(internalToken)
+	if err != nil {
+		return errorResponse(apierror.From(err))
+	}
+	// 非Proxy統合の X-Internal-Token ヘッダーと同じく "Bearer " を付けた形式にそろえる
+	values.InternalToken = "Bearer " + internalToken
+	req.Caller = values
+
+	resp, matched, err := b.router().dispatch(ctx, req)
+	if !matched {
+		resp = apiResponse{StatusCode: http.StatusOK, Body: newResponse(req, received, headers)}
+	}
+	if err != nil {
+		return errorResponse(b.apiError(req, err))
+	}
+	if resp.Body == nil {
+		return resp.StatusCode, ""
 	}
 
-	return response, nil
+	body, err := json.Marshal(resp.Body)
+	if err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		return errorResponse(apierror.Internal())
+	}
+	return resp.StatusCode, string(body)
+}
+
+// apiError は店舗APIのエラーをコード付きのエラーに変換する
+// コードのないエラー（DynamoDB のエラー等）はログに出力し、内容を含めない INTERNAL_ERROR にする
+func (b *Backend) apiError(req *apiRequest, err error) *apierror.Error {
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	log.Printf("Failed to handle %s %s: %v", req.Method, req.Path, err)
+	return apierror.Internal()
+}
+
+// errorResponse はエラーのステータスコードとレスポンスボディを返す
+func errorResponse(err *apierror.Error) (int, string) {
+	body, _ := json.Marshal(err.Body())
+	return err.StatusCode(), string(body)
+}
+
+// eventShape はイベントの形式を判定するために読むフィールド
+type eventShape struct {
+	Version        string          `json:"version"`
+	RequestContext json.RawMessage `json:"requestContext"`
+}
+
+// invoke は Lambda のエントリポイント
+// ヘルスチェック・ウォームアップイベントはレポートを返し、それ以外はイベントの形式に応じて処理する
+//   - version が "2.0" のイベント: HTTP API（ペイロード形式 2.0）
+//   - requestContext を含むイベント: REST API の Proxy統合
+//   - それ以外: 非Proxy統合（マッピングテンプレートで組み立てたリクエスト）
+//
+// 統合タイプを切り替えてもコードを変更する必要はない
+func (b *Backend) invoke(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	if health.IsEvent(payload) {
+		return health.Run(ctx, HealthServiceName, b.healthChecks(), b.now()), nil
+	}
+
+	var shape eventShape
+	if err := json.Unmarshal(payload, &shape); err != nil {
+		return nil, fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	switch {
+	case shape.Version == "2.0":
+		var event events.APIGatewayV2HTTPRequest
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("failed to decode HTTP API event: %w", err)
+		}
+		return b.httpAPIHandler(ctx, event)
+	case len(shape.RequestContext) > 0 && string(shape.RequestContext) != "null":
+		var event events.APIGatewayProxyRequest
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("failed to decode proxy event: %w", err)
+		}
+		return b.proxyHandler(ctx, event)
+	}
+
+	var event Request
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode event: %w", err)
+	}
+	return b.handler(ctx, event)
+}
+
+// healthChecks は内部トークンを検証できることと店舗APIのテーブルを確認する
+func (b *Backend) healthChecks() []health.Check {
+	checks := []health.Check{{
+		Name: "internal_token:signing_key",
+		Run: func(ctx context.Context) error {
+			if b.Verifier == nil {
+				return errors.New("INTERNAL_TOKEN_SIGNING_KEY is not set")
+			}
+			return nil
+		},
+	}}
+	if b.Stores != nil {
+		checks = append(checks, health.Check{
+			Name: "dynamodb:" + b.Stores.TableName,
+			Run: func(ctx context.Context) error {
+				_, err := b.Stores.DDBClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+					TableName: aws.String(b.Stores.TableName),
+				})
+				return err
+			},
+		})
+	}
+	return checks
 }
 
 func main() {
-	lambda.Start(handler)
+	backend, err := NewBackend(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create backend: %v", err)
+	}
+	lambda.Start(backend.invoke)
 }
@@ -2,25 +2,119 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"local-gateway/lambda/health"
+	"local-gateway/lambda/internaltoken"
+	"local-gateway/lambda/test-function/apierror"
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/stretchr/testify/assert"
 )
 
+var (
+	testInternalTokenKey = []byte(strings.Repeat("k", internaltoken.MinKeyLength))
+	testNow              = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+)
+
+const TestStoresTableName = "Stores_Test"
+
+var testDDBClient *dynamodb.Client
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	var err error
+	testDDBClient, err = testutil.NewDynamoDBClient(ctx)
+	if err != nil {
+		fmt.Printf("Failed to create DynamoDB client: %v\n", err)
+		os.Exit(1)
+	}
+
+	// テスト用テーブル作成
+	if err := testutil.EnsureTable(ctx, testDDBClient, storesTableSchema(TestStoresTableName)); err != nil {
+		fmt.Printf("Failed to setup test table: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 全テスト実行
+	code := m.Run()
+
+	// テスト用テーブル削除
+	testutil.DeleteTable(ctx, testDDBClient, TestStoresTableName)
+
+	os.Exit(code)
+}
+
+func newTestBackend() *Backend {
+	return &Backend{
+		Verifier: &internaltoken.Verifier{
+			Key:      testInternalTokenKey,
+			Issuer:   internaltoken.DefaultIssuer,
+			Audience: internaltoken.DefaultAudience,
+		},
+		Stores: &StoreRepository{
+			TableName: TestStoresTableName,
+			DDBClient: testDDBClient,
+		},
+		Now: func() time.Time { return testNow },
+	}
+}
+
+// handleEcho は店舗API以外のパスのリクエストを処理し、受け取ったヘッダー等のレスポンスを返す
+func handleEcho(t *testing.T, b *Backend, event Request) (Response, error) {
+	t.Helper()
+	out, err := b.handler(context.Background(), event)
+	if err != nil {
+		return Response{}, err
+	}
+	resp, ok := out.(Response)
+	if !ok {
+		t.Fatalf("unexpected response type %T", out)
+	}
+	return resp, nil
+}
+
+// signTestInternalToken は Authorizer と同じ形式の内部トークンを発行する
+func signTestInternalToken(t *testing.T, claims internaltoken.Claims) string {
+	t.Helper()
+	signer := &internaltoken.Signer{
+		Key:      testInternalTokenKey,
+		Issuer:   internaltoken.DefaultIssuer,
+		Audience: internaltoken.DefaultAudience,
+		TTL:      internaltoken.DefaultTTL,
+	}
+	token, err := signer.Sign("user-1", claims, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
 func Test_非Proxy形式のリクエストを正しく処理できること(t *testing.T) {
+	internalToken := "Bearer " + signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345", Scope: "read:stores"})
 	event := Request{
 		Body: "",
 		Headers: map[string]string{
-			"X-Company-Id":    "12345",
-			"X-Scope":         "read:stores",
-			"X-Internal-Token": "Bearer internal_abc",
-			"Authorization":   "Bearer original_token",
+			"X-Company-Id":     "12345",
+			"X-Scope":          "read:stores",
+			"X-Internal-Token": internalToken,
+			"Authorization":    "Bearer original_token",
 		},
 		HTTPMethod: "GET",
 		Path:       "/test",
 	}
 
-	resp, err := handler(context.Background(), event)
+	resp, err := handleEcho(t, newTestBackend(), event)
 
 	assert.NoError(t, err)
 	assert.Equal(t, "Hello from test-function!", resp.Message)
@@ -29,38 +123,108 @@ func Test_非Proxy形式のリクエストを正しく処理できること(t *t
 	// ヘッダーが正しく取得されていること
 	assert.Equal(t, "12345", resp.CompanyID)
 	assert.Equal(t, "read:stores", resp.Scope)
-	assert.Equal(t, "Bearer internal_abc", resp.InternalToken)
+	assert.Equal(t, internalToken, resp.InternalToken)
 	assert.Equal(t, "Bearer original_token", resp.OriginalAuthHeader)
 
 	// ReceivedHeadersに全ヘッダーが含まれること
 	assert.Equal(t, "12345", resp.ReceivedHeaders["X-Company-Id"])
 	assert.Equal(t, "read:stores", resp.ReceivedHeaders["X-Scope"])
-	assert.Equal(t, "Bearer internal_abc", resp.ReceivedHeaders["X-Internal-Token"])
+	assert.Equal(t, internalToken, resp.ReceivedHeaders["X-Internal-Token"])
 	assert.Equal(t, "Bearer original_token", resp.ReceivedHeaders["Authorization"])
 }
 
-func Test_ヘッダーがない場合でもエラーにならないこと(t *testing.T) {
+func Test_内部トークンがない場合はUNAUTHORIZEDエラーになること(t *testing.T) {
 	event := Request{
-		Body:       "",
-		Headers:    map[string]string{},
+		Body: "",
+		Headers: map[string]string{
+			"X-Company-Id": "12345",
+			"X-Scope":      "read:stores",
+		},
 		HTTPMethod: "GET",
 		Path:       "/test",
 	}
 
-	resp, err := handler(context.Background(), event)
+	_, err := newTestBackend().handler(context.Background(), event)
 
+	var apiErr *apierror.Error
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, apierror.CodeUnauthorized, apiErr.Code)
+	}
+	// 統合レスポンスの selection_pattern が接頭辞で401を選択する
+	assert.True(t, strings.HasPrefix(err.Error(), "[UNAUTHORIZED] "))
+}
+
+func Test_不正な内部トークンはUNAUTHORIZEDエラーになること(t *testing.T) {
+	valid := signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345"})
+	otherKey := &internaltoken.Signer{
+		Key:      []byte(strings.Repeat("x", internaltoken.MinKeyLength)),
+		Issuer:   internaltoken.DefaultIssuer,
+		Audience: internaltoken.DefaultAudience,
+		TTL:      internaltoken.DefaultTTL,
+	}
+	forged, err := otherKey.Sign("user-1", internaltoken.Claims{CompanyID: "12345"}, testNow)
 	assert.NoError(t, err)
-	assert.Equal(t, "Hello from test-function!", resp.Message)
-	assert.Equal(t, "success", resp.Status)
+	otherAudience := *otherKey
+	otherAudience.Key = testInternalTokenKey
+	otherAudience.Audience = "other"
+	wrongAudience, err := otherAudience.Sign("user-1", internaltoken.Claims{CompanyID: "12345"}, testNow)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		token   string
+		backend *Backend
+	}{
+		{name: "固定値のトークン", token: "Bearer internal_abc", backend: newTestBackend()},
+		{name: "署名の鍵が異なる", token: "Bearer " + forged, backend: newTestBackend()},
+		{name: "audが異なる", token: "Bearer " + wrongAudience, backend: newTestBackend()},
+		{name: "期限切れ", token: "Bearer " + valid, backend: &Backend{
+			Verifier: newTestBackend().Verifier,
+			Now:      func() time.Time { return testNow.Add(time.Hour) },
+		}},
+		{name: "検証の鍵が設定されていない", token: "Bearer " + valid, backend: &Backend{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := Request{
+				Headers: map[string]string{
+					"X-Company-Id":     "12345",
+					"X-Internal-Token": tt.token,
+				},
+			}
 
-	// ヘッダーが空の場合は空文字列が返ること
-	assert.Empty(t, resp.CompanyID)
-	assert.Empty(t, resp.Scope)
-	assert.Empty(t, resp.InternalToken)
+			_, err := tt.backend.handler(context.Background(), event)
+
+			var apiErr *apierror.Error
+			if assert.ErrorAs(t, err, &apiErr) {
+				assert.Equal(t, apierror.CodeUnauthorized, apiErr.Code)
+			}
+		})
+	}
+}
+
+func Test_X_Company_Idヘッダーより内部トークンのクレームが優先されること(t *testing.T) {
+	event := Request{
+		Headers: map[string]string{
+			// 偽装されたヘッダー
+			"X-Company-Id":     "99999",
+			"X-Scope":          "write:stores",
+			"X-Internal-Token": "Bearer " + signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345", Scope: "read:stores", Actor: "support-1"}),
+		},
+	}
+
+	resp, err := handleEcho(t, newTestBackend(), event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", resp.CompanyID)
+	assert.Equal(t, "read:stores", resp.Scope)
+	assert.Equal(t, "support-1", resp.Actor)
 }
 
 func Test_マッピングテンプレートから渡されるヘッダーを処理できること(t *testing.T) {
 	// API Gatewayのマッピングテンプレートから渡される形式をシミュレート
+	internalToken := "Bearer " + signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345", Scope: "read:stores"})
 	event := Request{
 		Body: "",
 		Headers: map[string]string{
@@ -69,7 +233,7 @@ func Test_マッピングテンプレートから渡されるヘッダーを処
 			"Accept":            "*/*",
 			"X-Company-Id":      "12345",
 			"X-Scope":           "read:stores",
-			"X-Internal-Token":  "Bearer internal_abc",
+			"X-Internal-Token":  internalToken,
 			"Authorization":     "Bearer original_token",
 			"X-Amzn-Trace-Id":   "Root=1-123456",
 			"X-Forwarded-For":   "192.168.1.1",
@@ -80,14 +244,14 @@ func Test_マッピングテンプレートから渡されるヘッダーを処
 		Path:       "/test/test",
 	}
 
-	resp, err := handler(context.Background(), event)
+	resp, err := handleEcho(t, newTestBackend(), event)
 
 	assert.NoError(t, err)
 
 	// カスタムヘッダーが正しく処理されること
 	assert.Equal(t, "12345", resp.CompanyID)
 	assert.Equal(t, "read:stores", resp.Scope)
-	assert.Equal(t, "Bearer internal_abc", resp.InternalToken)
+	assert.Equal(t, internalToken, resp.InternalToken)
 	assert.Equal(t, "Bearer original_token", resp.OriginalAuthHeader)
 
 	// すべてのヘッダーがReceivedHeadersに含まれること
@@ -97,3 +261,423 @@ func Test_マッピングテンプレートから渡されるヘッダーを処
 	assert.Contains(t, resp.ReceivedHeaders, "X-Internal-Token")
 	assert.Contains(t, resp.ReceivedHeaders, "Authorization")
 }
+
+func Test_ヘルスチェックイベントではレポートが返ること(t *testing.T) {
+	resp, err := newTestBackend().invoke(context.Background(), []byte(`{"type":"HEALTH_CHECK"}`))
+
+	assert.NoError(t, err)
+	report, ok := resp.(health.Report)
+	if assert.True(t, ok) {
+		assert.Equal(t, HealthServiceName, report.Service)
+		assert.Equal(t, health.StatusOK, report.Status)
+	}
+}
+
+func Test_内部トークンの鍵が設定されていない場合はヘルスチェックが失敗すること(t *testing.T) {
+	resp, err := (&Backend{}).invoke(context.Background(), []byte(`{"type":"HEALTH_CHECK"}`))
+
+	assert.NoError(t, err)
+	report, ok := resp.(health.Report)
+	if assert.True(t, ok) {
+		assert.Equal(t, health.StatusFail, report.Status)
+		if assert.Len(t, report.Checks, 1) {
+			assert.Equal(t, "internal_token:signing_key", report.Checks[0].Name)
+		}
+	}
+}
+
+func Test_ヘルスチェック以外のイベントは非Proxy形式として処理されること(t *testing.T) {
+	payload := `{"headers":{"X-Internal-Token":"Bearer ` + signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345"}) + `"},"httpMethod":"GET","path":"/test"}`
+	resp, err := newTestBackend().invoke(context.Background(), []byte(payload))
+
+	assert.NoError(t, err)
+	if assert.IsType(t, Response{}, resp) {
+		assert.Equal(t, "12345", resp.(Response).CompanyID)
+	}
+}
+
+func Test_非Proxy統合では小文字のヘッダー名でも内部トークンを取得できること(t *testing.T) {
+	event := Request{
+		Headers: map[string]string{
+			"x-internal-token": "Bearer " + signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345", Scope: "read:stores"}),
+			"authorization":    "Bearer original_token",
+		},
+		HTTPMethod: "GET",
+		Path:       "/test",
+	}
+
+	resp, err := handleEcho(t, newTestBackend(), event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", resp.CompanyID)
+	assert.Equal(t, "Bearer original_token", resp.OriginalAuthHeader)
+}
+
+func Test_非Proxy統合で内部トークンのヘッダーに異なる値が複数ある場合はUNAUTHORIZEDエラーになること(t *testing.T) {
+	// マッピングテンプレートはクライアントが送ったヘッダーも含めるため、名前の大文字・小文字を変えて値を追加できる
+	event := Request{
+		Headers: map[string]string{
+			"x-internal-token": "Bearer " + signTestInternalToken(t, internaltoken.Claims{CompanyID: "99999", Scope: "read:stores"}),
+			"X-Internal-Token": "Bearer " + signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345", Scope: "read:stores"}),
+		},
+		HTTPMethod: "GET",
+		Path:       "/test",
+	}
+
+	_, err := newTestBackend().handler(context.Background(), event)
+
+	assert.EqualError(t, err, "[UNAUTHORIZED] ambiguous internal token")
+}
+
+func Test_REST_APIのProxy統合ではmultiValueHeadersのAuthorizationヘッダーを読むこと(t *testing.T) {
+	event := events.APIGatewayProxyRequest{
+		HTTPMethod:        "GET",
+		Path:              "/test",
+		Headers:           map[string]string{"authorization": "Bearer second"},
+		MultiValueHeaders: map[string][]string{"authorization": {"Bearer first", "Bearer second"}},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]interface{}{
+				"internalToken": signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345"}),
+			},
+		},
+	}
+
+	resp, err := newTestBackend().proxyHandler(context.Background(), event)
+
+	assert.NoError(t, err)
+	var body Response
+	if assert.NoError(t, json.Unmarshal([]byte(resp.Body), &body)) {
+		assert.Equal(t, "Bearer first", body.OriginalAuthHeader)
+	}
+}
+
+func Test_REST_APIのProxy統合ではAuthorizerのcontextの内部トークンから値を取得できること(t *testing.T) {
+	internalToken := signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345", Scope: "read:stores write:stores", Actor: "support-1"})
+	event := events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Path:       "/test",
+		Headers: map[string]string{
+			"Authorization": "Bearer original_token",
+			"Host":          "api.example.com",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]interface{}{
+				"principalId":   "user-1",
+				"companyId":     "12345",
+				"scope":         "read:stores write:stores",
+				"internalToken": internalToken,
+				"actor":         "support-1",
+			},
+		},
+	}
+
+	resp, err := newTestBackend().proxyHandler(context.Background(), event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Headers["Content-Type"])
+
+	var body Response
+	if assert.NoError(t, json.Unmarshal([]byte(resp.Body), &body)) {
+		assert.Equal(t, "success", body.Status)
+		assert.Equal(t, "12345", body.CompanyID)
+		assert.Equal(t, "read:stores write:stores", body.Scope)
+		// 非Proxy統合の X-Internal-Token ヘッダーと同じ形式になること
+		assert.Equal(t, "Bearer "+internalToken, body.InternalToken)
+		assert.Equal(t, "support-1", body.Actor)
+		assert.Equal(t, "Bearer original_token", body.OriginalAuthHeader)
+		assert.Equal(t, "api.example.com", body.ReceivedHeaders["Host"])
+	}
+}
+
+func Test_HTTP_APIではLambda_Authorizerのcontextの内部トークンから値を取得できること(t *testing.T) {
+	event := events.APIGatewayV2HTTPRequest{
+		Version: "2.0",
+		RawPath: "/test",
+		// HTTP API はヘッダー名を小文字にして渡す
+		Headers: map[string]string{
+			"authorization": "Bearer original_token",
+		},
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			Authorizer: &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+				Lambda: map[string]interface{}{
+					"companyId":              "12345",
+					"scope":                  "read:stores",
+					"internalToken":          signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345", Scope: "read:stores"}),
+					"token_rotation_pending": true,
+				},
+			},
+		},
+	}
+
+	resp, err := newTestBackend().httpAPIHandler(context.Background(), event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Headers["Content-Type"])
+
+	var body Response
+	if assert.NoError(t, json.Unmarshal([]byte(resp.Body), &body)) {
+		assert.Equal(t, "12345", body.CompanyID)
+		assert.Equal(t, "read:stores", body.Scope)
+		assert.Empty(t, body.Actor)
+		assert.Equal(t, "Bearer original_token", body.OriginalAuthHeader)
+	}
+}
+
+func Test_Proxy統合で内部トークンを検証できない場合は401が返ること(t *testing.T) {
+	t.Run("REST API", func(t *testing.T) {
+		event := events.APIGatewayProxyRequest{
+			RequestContext: events.APIGatewayProxyRequestContext{
+				Authorizer: map[string]interface{}{
+					"companyId":     "12345",
+					"internalToken": "internal_abc",
+				},
+			},
+		}
+
+		resp, err := newTestBackend().proxyHandler(context.Background(), event)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Headers["Content-Type"])
+		assert.JSONEq(t, `{"status":"error","code":"UNAUTHORIZED","message":"invalid internal token"}`, resp.Body)
+	})
+
+	t.Run("HTTP API（Authorizerのcontextがない）", func(t *testing.T) {
+		resp, err := newTestBackend().httpAPIHandler(context.Background(), events.APIGatewayV2HTTPRequest{Version: "2.0"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func Test_Authorizerのcontextの文字列以外の値を文字列として取得できること(t *testing.T) {
+	authorizer := map[string]interface{}{
+		"str":  "a",
+		"num":  float64(42),
+		"bool": true,
+		"null": nil,
+	}
+
+	assert.Equal(t, "a", contextString(authorizer, "str"))
+	assert.Equal(t, "42", contextString(authorizer, "num"))
+	assert.Equal(t, "true", contextString(authorizer, "bool"))
+	assert.Empty(t, contextString(authorizer, "null"))
+	assert.Empty(t, contextString(authorizer, "missing"))
+	assert.Empty(t, contextString(nil, "str"))
+}
+
+func Test_イベントの形式に応じて処理が切り替わること(t *testing.T) {
+	internalToken := signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345"})
+
+	tests := []struct {
+		name    string
+		payload string
+		check   func(t *testing.T, resp interface{})
+	}{
+		{
+			name:    "REST APIのProxy統合",
+			payload: `{"resource":"/test","path":"/test","httpMethod":"GET","headers":{"Authorization":"Bearer original_token"},"requestContext":{"resourcePath":"/test","httpMethod":"GET","authorizer":{"companyId":"12345","internalToken":"` + internalToken + `"}},"body":null}`,
+			check: func(t *testing.T, resp interface{}) {
+				if assert.IsType(t, events.APIGatewayProxyResponse{}, resp) {
+					r := resp.(events.APIGatewayProxyResponse)
+					assert.Equal(t, http.StatusOK, r.StatusCode)
+					assert.Contains(t, r.Body, `"companyId":"12345"`)
+				}
+			},
+		},
+		{
+			name:    "HTTP API",
+			payload: `{"version":"2.0","routeKey":"GET /test","rawPath":"/test","headers":{"authorization":"Bearer original_token"},"requestContext":{"http":{"method":"GET","path":"/test"},"authorizer":{"lambda":{"companyId":"12345","internalToken":"` + internalToken + `"}}}}`,
+			check: func(t *testing.T, resp interface{}) {
+				if assert.IsType(t, events.APIGatewayV2HTTPResponse{}, resp) {
+					r := resp.(events.APIGatewayV2HTTPResponse)
+					assert.Equal(t, http.StatusOK, r.StatusCode)
+					assert.Contains(t, r.Body, `"companyId":"12345"`)
+				}
+			},
+		},
+		{
+			name:    "非Proxy統合",
+			payload: `{"headers":{"X-Internal-Token":"Bearer ` + internalToken + `"},"httpMethod":"GET","path":"/test"}`,
+			check: func(t *testing.T, resp interface{}) {
+				if assert.IsType(t, Response{}, resp) {
+					assert.Equal(t, "12345", resp.(Response).CompanyID)
+				}
+			},
+		},
+		{
+			name:    "requestContextがnullの場合は非Proxy統合",
+			payload: `{"headers":{"X-Internal-Token":"Bearer ` + internalToken + `"},"requestContext":null}`,
+			check: func(t *testing.T, resp interface{}) {
+				assert.IsType(t, Response{}, resp)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newTestBackend().invoke(context.Background(), json.RawMessage(tt.payload))
+
+			assert.NoError(t, err)
+			tt.check(t, resp)
+		})
+	}
+}
+
+func Test_不正なイベントはエラーになること(t *testing.T) {
+	_, err := newTestBackend().invoke(context.Background(), json.RawMessage(`not json`))
+
+	assert.Error(t, err)
+}
+
+func Test_非Proxy統合のマッピングテンプレートの出力からリクエストの情報を取得できること(t *testing.T) {
+	internalToken := "Bearer " + signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345", Scope: "read:stores"})
+	// terraform/modules/apigateway のマッピングテンプレートと同じ形式
+	payload := `{
+  "body": "",
+  "headers": {"Host": "api.example.com", "X-Internal-Token": "` + internalToken + `", "X-Actor": ""},
+  "httpMethod": "GET",
+  "path": "/test",
+  "resource": "/test",
+  "queryStringParameters": {"q": "渋谷 店", "limit": "10"},
+  "pathParameters": {},
+  "stageVariables": {"env": "local"},
+  "stage": "test",
+  "requestId": "req-1",
+  "sourceIp": "203.0.113.10"
+}`
+
+	out, err := newTestBackend().invoke(context.Background(), json.RawMessage(payload))
+
+	assert.NoError(t, err)
+	resp, ok := out.(Response)
+	if assert.True(t, ok) {
+		assert.Equal(t, "/test", resp.Path)
+		assert.Equal(t, url.Values{"q": {"渋谷 店"}, "limit": {"10"}}, resp.Query)
+		assert.Equal(t, map[string]string{"env": "local"}, resp.StageVariables)
+		assert.Equal(t, "req-1", resp.RequestID)
+		assert.Equal(t, "203.0.113.10", resp.SourceIP)
+		assert.Equal(t, "12345", resp.CompanyID)
+	}
+}
+
+func Test_非Proxy統合でアポストロフィを含む値を取得できること(t *testing.T) {
+	internalToken := "Bearer " + signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345"})
+	// マッピングテンプレートは $util.escapeJavaScript の \' を ' に戻して出力する（?name=O'Brien）
+	payload := `{
+  "headers": {"X-Internal-Token": "` + internalToken + `"},
+  "httpMethod": "GET",
+  "path": "/test",
+  "resource": "/test",
+  "queryStringParameters": {"name": "O'Brien"},
+  "stageVariables": {"owner": "O'Brien"}
+}`
+
+	out, err := newTestBackend().invoke(context.Background(), json.RawMessage(payload))
+
+	assert.NoError(t, err)
+	resp, ok := out.(Response)
+	if assert.True(t, ok) {
+		assert.Equal(t, url.Values{"name": {"O'Brien"}}, resp.Query)
+		assert.Equal(t, map[string]string{"owner": "O'Brien"}, resp.StageVariables)
+	}
+
+	// $util.escapeJavaScript の出力のままでは JSON として不正になる
+	_, err = newTestBackend().invoke(context.Background(), json.RawMessage(strings.ReplaceAll(payload, "O'Brien", `O\'Brien`)))
+	assert.Error(t, err)
+}
+
+func Test_非Proxy統合でパスパラメーターのあるルートを呼び出せること(t *testing.T) {
+	headers := map[string]string{
+		"X-Internal-Token": "Bearer " + signTestInternalToken(t, internaltoken.Claims{CompanyID: testutil.GenerateUniqueID("company"), Scope: "read:stores write:stores"}),
+	}
+	created, err := newTestBackend().handler(context.Background(), Request{
+		Headers:    headers,
+		HTTPMethod: http.MethodPost,
+		Path:       "/stores",
+		Resource:   "/stores",
+		Body:       `{"name":"新宿店"}`,
+	})
+	assert.NoError(t, err)
+	store, ok := created.(Store)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	got, err := newTestBackend().handler(context.Background(), Request{
+		Headers:        headers,
+		HTTPMethod:     http.MethodGet,
+		Path:           "/stores/" + store.ID,
+		Resource:       "/stores/{id}",
+		PathParameters: map[string]string{"id": store.ID},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &store, got)
+}
+
+func Test_Proxy統合とHTTP_APIで同じ形式のリクエストの情報を取得できること(t *testing.T) {
+	internalToken := signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345"})
+	want := Response{
+		Path:           "/test",
+		Query:          url.Values{"tag": {"a", "b"}, "q": {"渋谷 店"}},
+		StageVariables: map[string]string{"env": "local"},
+		RequestID:      "req-1",
+		SourceIP:       "203.0.113.10",
+	}
+
+	t.Run("REST API", func(t *testing.T) {
+		resp, err := newTestBackend().proxyHandler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/test",
+			// queryStringParameters は同じ名前のパラメーターの最後の値のみ
+			QueryStringParameters:           map[string]string{"tag": "b", "q": "渋谷 店"},
+			MultiValueQueryStringParameters: map[string][]string{"tag": {"a", "b"}, "q": {"渋谷 店"}},
+			StageVariables:                  map[string]string{"env": "local"},
+			RequestContext: events.APIGatewayProxyRequestContext{
+				RequestID:  "req-1",
+				Identity:   events.APIGatewayRequestIdentity{SourceIP: "203.0.113.10"},
+				Authorizer: map[string]interface{}{"internalToken": internalToken},
+			},
+		})
+
+		assert.NoError(t, err)
+		assertRequestInfo(t, want, resp.Body)
+	})
+
+	t.Run("HTTP API", func(t *testing.T) {
+		resp, err := newTestBackend().httpAPIHandler(context.Background(), events.APIGatewayV2HTTPRequest{
+			Version:        "2.0",
+			RawPath:        "/test",
+			RawQueryString: "tag=a&tag=b&q=%E6%B8%8B%E8%B0%B7+%E5%BA%97",
+			// queryStringParameters は同じ名前のパラメーターをカンマ区切りでまとめる
+			QueryStringParameters: map[string]string{"tag": "a,b", "q": "渋谷 店"},
+			StageVariables:        map[string]string{"env": "local"},
+			RequestContext: events.APIGatewayV2HTTPRequestContext{
+				RequestID: "req-1",
+				HTTP:      events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: http.MethodGet, SourceIP: "203.0.113.10"},
+				Authorizer: &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+					Lambda: map[string]interface{}{"internalToken": internalToken},
+				},
+			},
+		})
+
+		assert.NoError(t, err)
+		assertRequestInfo(t, want, resp.Body)
+	})
+}
+
+// assertRequestInfo はレスポンスボディのリクエストの情報（パス・クエリ文字列等）を確認する
+func assertRequestInfo(t *testing.T, want Response, body string) {
+	t.Helper()
+	var got Response
+	if assert.NoError(t, json.Unmarshal([]byte(body), &got)) {
+		assert.Equal(t, want.Path, got.Path)
+		assert.Equal(t, want.Query, got.Query)
+		assert.Equal(t, want.StageVariables, got.StageVariables)
+		assert.Equal(t, want.RequestID, got.RequestID)
+		assert.Equal(t, want.SourceIP, got.SourceIP)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+
+	"local-gateway/lambda/test-function/apierror"
+)
+
+// apiRequest はルートに渡すリクエスト（統合タイプによらない形式）
+type apiRequest struct {
+	Method string
+	Path   string
+	Body   string
+	// Query はクエリ文字列（デコード済み）
+	Query url.Values
+	// StageVariables はステージ変数
+	StageVariables map[string]string
+	// RequestID は API Gateway のリクエストID
+	RequestID string
+	// SourceIP は呼び出し元のIPアドレス
+	SourceIP string
+	// PathParams はパスパターンの {name} に対応する値
+	PathParams map[string]string
+	// Caller は内部トークンで検証した呼び出し元
+	Caller authorizerValues
+}
+
+// apiResponse はルートが返すレスポンス（Body は JSON に変換する、nil の場合はボディなし）
+type apiResponse struct {
+	StatusCode int
+	Body       interface{}
+}
+
+// route は1つのAPI（メソッドとパスパターン）
+type route struct {
+	Method string
+	// Pattern はパスパターン（"{name}" は1セグメントにマッチし、PathParams に入る）
+	Pattern string
+	// Scope は呼び出しに必要なスコープ
+	Scope  string
+	Handle func(ctx context.Context, req *apiRequest) (apiResponse, error)
+}
+
+// router はリクエストのメソッドとパスに対応するルートを呼び出す
+type router struct {
+	routes []route
+}
+
+// dispatch はリクエストに対応するルートを呼び出す
+// パスにマッチするルートがない場合は false を返す（呼び出し元で別の処理を行う）
+// パスにマッチしてメソッドが異なる場合は 405、スコープが足りない場合は 403 を返す
+func (r *router) dispatch(ctx context.Context, req *apiRequest) (apiResponse, bool, error) {
+	path := splitPath(req.Path)
+	pathMatched := false
+	for _, rt := range r.routes {
+		params, ok := matchPattern(splitPath(rt.Pattern), path)
+		if !ok {
+			continue
+		}
+		pathMatched = true
+		if rt.Method != req.Method {
+			continue
+		}
+		if !slices.Contains(strings.Fields(req.Caller.Scope), rt.Scope) {
+			return apiResponse{}, true, apierror.Forbidden("%s scope is required", rt.Scope)
+		}
+		req.PathParams = params
+		resp, err := rt.Handle(ctx, req)
+		return resp, true, err
+	}
+	if pathMatched {
+		return apiResponse{}, true, apierror.MethodNotAllowed("method %s is not allowed", req.Method)
+	}
+	return apiResponse{}, false, nil
+}
+
+// splitPath はパスをセグメントに分割する（先頭・末尾の "/" は無視する）
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// matchPattern はパスがパターンにマッチする場合に {name} の値を返す
+func matchPattern(pattern, path []string) (map[string]string, bool) {
+	if len(pattern) != len(path) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, seg := range pattern {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if path[i] == "" {
+				return nil, false
+			}
+			params[seg[1:len(seg)-1]] = path[i]
+			continue
+		}
+		if seg != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
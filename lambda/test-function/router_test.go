@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"local-gateway/lambda/test-function/apierror"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_パスパターンにマッチした場合にパスパラメータを取得できること(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		path       string
+		wantParams map[string]string
+		wantOK     bool
+	}{
+		{name: "固定のパス", pattern: "/stores", path: "/stores", wantParams: map[string]string{}, wantOK: true},
+		{name: "末尾のスラッシュは無視", pattern: "/stores", path: "/stores/", wantParams: map[string]string{}, wantOK: true},
+		{name: "パスパラメータ", pattern: "/stores/{id}", path: "/stores/abc", wantParams: map[string]string{"id": "abc"}, wantOK: true},
+		{name: "セグメント数が異なる", pattern: "/stores/{id}", path: "/stores", wantOK: false},
+		{name: "セグメントが多い", pattern: "/stores/{id}", path: "/stores/abc/items", wantOK: false},
+		{name: "固定のセグメントが異なる", pattern: "/stores", path: "/test", wantOK: false},
+		{name: "空のセグメント", pattern: "/stores/{id}/items", path: "/stores//items", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, ok := matchPattern(splitPath(tt.pattern), splitPath(tt.path))
+
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.wantParams, params)
+			}
+		})
+	}
+}
+
+func Test_リクエストに対応するルートが呼び出されること(t *testing.T) {
+	var called string
+	handle := func(name string) func(context.Context, *apiRequest) (apiResponse, error) {
+		return func(ctx context.Context, req *apiRequest) (apiResponse, error) {
+			called = name + ":" + req.PathParams["id"]
+			return apiResponse{StatusCode: http.StatusOK}, nil
+		}
+	}
+	r := &router{routes: []route{
+		{Method: http.MethodGet, Pattern: "/items", Scope: "read:items", Handle: handle("list")},
+		{Method: http.MethodGet, Pattern: "/items/{id}", Scope: "read:items", Handle: handle("get")},
+		{Method: http.MethodDelete, Pattern: "/items/{id}", Scope: "write:items", Handle: handle("delete")},
+	}}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		scope       string
+		wantMatched bool
+		wantCalled  string
+		wantStatus  int
+	}{
+		{name: "一覧", method: http.MethodGet, path: "/items", scope: "read:items", wantMatched: true, wantCalled: "list:"},
+		{name: "パスパラメータ付き", method: http.MethodGet, path: "/items/1", scope: "read:items", wantMatched: true, wantCalled: "get:1"},
+		{name: "同じパスの別メソッド", method: http.MethodDelete, path: "/items/1", scope: "read:items write:items", wantMatched: true, wantCalled: "delete:1"},
+		{name: "スコープが足りない", method: http.MethodDelete, path: "/items/1", scope: "read:items", wantMatched: true, wantStatus: http.StatusForbidden},
+		{name: "スコープがない", method: http.MethodGet, path: "/items", scope: "", wantMatched: true, wantStatus: http.StatusForbidden},
+		{name: "許可されていないメソッド", method: http.MethodPost, path: "/items/1", scope: "write:items", wantMatched: true, wantStatus: http.StatusMethodNotAllowed},
+		{name: "マッチしないパス", method: http.MethodGet, path: "/test", scope: "read:items", wantMatched: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = ""
+
+			_, matched, err := r.dispatch(context.Background(), &apiRequest{
+				Method: tt.method,
+				Path:   tt.path,
+				Caller: authorizerValues{Scope: tt.scope},
+			})
+
+			assert.Equal(t, tt.wantMatched, matched)
+			assert.Equal(t, tt.wantCalled, called)
+			if tt.wantStatus == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var apiErr *apierror.Error
+			if assert.ErrorAs(t, err, &apiErr) {
+				assert.Equal(t, tt.wantStatus, apiErr.StatusCode())
+			}
+		})
+	}
+}
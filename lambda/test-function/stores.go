@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"local-gateway/lambda/test-function/apierror"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultStoresTableName は店舗を保持するテーブル名（companyId + storeId）
+	DefaultStoresTableName = "Stores"
+
+	ScopeReadStores  = "read:stores"
+	ScopeWriteStores = "write:stores"
+
+	// maxStoreNameLength・maxStoreAddressLength は店舗名・住所の最大文字数
+	maxStoreNameLength    = 100
+	maxStoreAddressLength = 200
+)
+
+var (
+	errStoreNotFound = errors.New("store not found")
+	errStoreExists   = errors.New("store already exists")
+)
+
+// Store は店舗
+// テナント（companyId）をパーティションキーにし、他のテナントの店舗は取得できない
+type Store struct {
+	CompanyID string `dynamodbav:"companyId" json:"companyId"`
+	ID        string `dynamodbav:"storeId" json:"id"`
+	Name      string `dynamodbav:"name" json:"name"`
+	Address   string `dynamodbav:"address,omitempty" json:"address,omitempty"`
+	CreatedAt string `dynamodbav:"createdAt" json:"createdAt"`
+	UpdatedAt string `dynamodbav:"updatedAt" json:"updatedAt"`
+}
+
+// StoreInput は店舗の作成・更新のリクエストボディ
+type StoreInput struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// StoreRepository は Stores テーブルを読み書きする
+// すべての操作はテナント（companyId）を必ずキーに含める
+type StoreRepository struct {
+	TableName string
+	DDBClient *dynamodb.Client
+}
+
+// storeRoutes は店舗APIのルート
+func (b *Backend) storeRoutes() []route {
+	return []route{
+		{Method: http.MethodGet, Pattern: "/stores", Scope: ScopeReadStores, Handle: b.listStores},
+		{Method: http.MethodPost, Pattern: "/stores", Scope: ScopeWriteStores, Handle: b.createStore},
+		{Method: http.MethodGet, Pattern: "/stores/{id}", Scope: ScopeReadStores, Handle: b.getStore},
+		{Method: http.MethodPut, Pattern: "/stores/{id}", Scope: ScopeWriteStores, Handle: b.updateStore},
+		{Method: http.MethodDelete, Pattern: "/stores/{id}", Scope: ScopeWriteStores, Handle: b.deleteStore},
+	}
+}
+
+func (b *Backend) listStores(ctx context.Context, req *apiRequest) (apiResponse, error) {
+	companyID, err := b.storeTenant(req)
+	if err != nil {
+		return apiResponse{}, err
+	}
+	stores, err := b.Stores.List(ctx, companyID)
+	if err != nil {
+		return apiResponse{}, err
+	}
+	return apiResponse{StatusCode: http.StatusOK, Body: map[string]interface{}{"stores": stores}}, nil
+}
+
+func (b *Backend) getStore(ctx context.Context, req *apiRequest) (apiResponse, error) {
+	companyID, err := b.storeTenant(req)
+	if err != nil {
+		return apiResponse{}, err
+	}
+	store, err := b.Stores.Get(ctx, companyID, req.PathParams["id"])
+	if err != nil {
+		return apiResponse{}, err
+	}
+	if store == nil {
+		return apiResponse{}, storeNotFound(req.PathParams["id"])
+	}
+	return apiResponse{StatusCode: http.StatusOK, Body: store}, nil
+}
+
+func (b *Backend) createStore(ctx context.Context, req *apiRequest) (apiResponse, error) {
+	companyID, err := b.storeTenant(req)
+	if err != nil {
+		return apiResponse{}, err
+	}
+	input, err := decodeStoreInput(req.Body)
+	if err != nil {
+		return apiResponse{}, err
+	}
+
+	now := b.now().UTC().Format(time.RFC3339)
+	store := Store{
+		CompanyID: companyID,
+		ID:        uuid.NewString(),
+		Name:      input.Name,
+		Address:   input.Address,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = b.Stores.Create(ctx, store)
+	if errors.Is(err, errStoreExists) {
+		return apiResponse{}, apierror.Conflict("store %s already exists", store.ID)
+	}
+	if err != nil {
+		return apiResponse{}, err
+	}
+	log.Printf("Created store %s for company %s", store.ID, companyID)
+	return apiResponse{StatusCode: http.StatusCreated, Body: store}, nil
+}
+
+func (b *Backend) updateStore(ctx context.Context, req *apiRequest) (apiResponse, error) {
+	companyID, err := b.storeTenant(req)
+	if err != nil {
+		return apiResponse{}, err
+	}
+	input, err := decodeStoreInput(req.Body)
+	if err != nil {
+		return apiResponse{}, err
+	}
+
+	store, err := b.Stores.Update(ctx, companyID, req.PathParams["id"], *input, b.now())
+	if errors.Is(err, errStoreNotFound) {
+		return apiResponse{}, storeNotFound(req.PathParams["id"])
+	}
+	if err != nil {
+		return apiResponse{}, err
+	}
+	return apiResponse{StatusCode: http.StatusOK, Body: store}, nil
+}
+
+func (b *Backend) deleteStore(ctx context.Context, req *apiRequest) (apiResponse, error) {
+	companyID, err := b.storeTenant(req)
+	if err != nil {
+		return apiResponse{}, err
+	}
+	err = b.Stores.Delete(ctx, companyID, req.PathParams["id"])
+	if errors.Is(err, errStoreNotFound) {
+		return apiResponse{}, storeNotFound(req.PathParams["id"])
+	}
+	if err != nil {
+		return apiResponse{}, err
+	}
+	log.Printf("Deleted store %s for company %s", req.PathParams["id"], companyID)
+	return apiResponse{StatusCode: http.StatusNoContent}, nil
+}
+
+// storeTenant は店舗を操作するテナント（内部トークンの companyId）を返す
+// テナントのないトークン（クライアント単位のトークン等）は店舗を操作できない
+func (b *Backend) storeTenant(req *apiRequest) (string, error) {
+	if req.Caller.CompanyID == "" {
+		return "", apierror.Forbidden("company is required")
+	}
+	if b.Stores == nil {
+		return "", errors.New("stores table is not configured")
+	}
+	return req.Caller.CompanyID, nil
+}
+
+// storeNotFound は店舗が存在しないことを表すエラーを返す
+// 他のテナントの店舗も同じく 404 にし、存在を明かさない
+func storeNotFound(id string) error {
+	return apierror.NotFound("store %s not found", id)
+}
+
+// decodeStoreInput はリクエストボディを読み込んで検証する
+func decodeStoreInput(body string) (*StoreInput, error) {
+	var input StoreInput
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&input); err != nil {
+		return nil, apierror.Validation("request body must be a JSON object with name and address")
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	input.Address = strings.TrimSpace(input.Address)
+	if input.Name == "" {
+		return nil, apierror.Validation("name is required")
+	}
+	if utf8.RuneCountInString(input.Name) > maxStoreNameLength {
+		return nil, apierror.Validation("name must be at most %d characters", maxStoreNameLength)
+	}
+	if utf8.RuneCountInString(input.Address) > maxStoreAddressLength {
+		return nil, apierror.Validation("address must be at most %d characters", maxStoreAddressLength)
+	}
+	return &input, nil
+}
+
+// List はテナントの店舗を返す
+func (r *StoreRepository) List(ctx context.Context, companyID string) ([]Store, error) {
+	stores := []Store{}
+	paginator := dynamodb.NewQueryPaginator(r.DDBClient, &dynamodb.QueryInput{
+		TableName:              aws.String(r.TableName),
+		KeyConditionExpression: aws.String("companyId = :companyId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":companyId": &types.AttributeValueMemberS{Value: companyID},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query stores: %w", err)
+		}
+		var items []Store
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, fmt.Errorf("failed to parse stores: %w", err)
+		}
+		stores = append(stores, items...)
+	}
+	return stores, nil
+}
+
+// Get はテナントの店舗を返す（存在しない場合は nil）
+func (r *StoreRepository) Get(ctx context.Context, companyID, id string) (*Store, error) {
+	out, err := r.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.TableName),
+		Key:       storeKey(companyID, id),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get store: %w", err)
+	}
+	if out.Item == nil {
+		return nil, nil
+	}
+	var store Store
+	if err := attributevalue.UnmarshalMap(out.Item, &store); err != nil {
+		return nil, fmt.Errorf("failed to parse store: %w", err)
+	}
+	return &store, nil
+}
+
+// Create は店舗を作成する（同じIDの店舗がある場合は errStoreExists）
+func (r *StoreRepository) Create(ctx context.Context, store Store) error {
+	item, err := attributevalue.MarshalMap(store)
+	if err != nil {
+		return fmt.Errorf("failed to encode store: %w", err)
+	}
+	_, err = r.DDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(r.TableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(storeId)"),
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return errStoreExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create store: %w", err)
+	}
+	return nil
+}
+
+// Update はテナントの店舗の名前と住所を更新する（存在しない場合は errStoreNotFound）
+func (r *StoreRepository) Update(ctx context.Context, companyID, id string, input StoreInput, now time.Time) (*Store, error) {
+	update := "SET #name = :name, updatedAt = :updatedAt"
+	values := map[string]types.AttributeValue{
+		":name":      &types.AttributeValueMemberS{Value: input.Name},
+		":updatedAt": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+	}
+	if input.Address != "" {
+		update += ", address = :address"
+		values[":address"] = &types.AttributeValueMemberS{Value: input.Address}
+	} else {
+		update += " REMOVE address"
+	}
+
+	out, err := r.DDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(r.TableName),
+		Key:                       storeKey(companyID, id),
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String("attribute_exists(storeId)"),
+		ExpressionAttributeNames:  map[string]string{"#name": "name"},
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil, errStoreNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update store: %w", err)
+	}
+
+	var store Store
+	if err := attributevalue.UnmarshalMap(out.Attributes, &store); err != nil {
+		return nil, fmt.Errorf("failed to parse store: %w", err)
+	}
+	return &store, nil
+}
+
+// Delete はテナントの店舗を削除する（存在しない場合は errStoreNotFound）
+func (r *StoreRepository) Delete(ctx context.Context, companyID, id string) error {
+	_, err := r.DDBClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(r.TableName),
+		Key:                 storeKey(companyID, id),
+		ConditionExpression: aws.String("attribute_exists(storeId)"),
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return errStoreNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete store: %w", err)
+	}
+	return nil
+}
+
+func storeKey(companyID, id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"companyId": &types.AttributeValueMemberS{Value: companyID},
+		"storeId":   &types.AttributeValueMemberS{Value: id},
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"local-gateway/lambda/internaltoken"
+	"local-gateway/lambda/testutil"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// storesTableSchema は Stores テーブルのスキーマ（companyId + storeId）
+func storesTableSchema(name string) testutil.TableSchema {
+	return testutil.TableSchema{
+		TableName: name,
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("companyId"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("storeId"), KeyType: types.KeyTypeRange},
+		},
+		Attributes: []types.AttributeDefinition{
+			{AttributeName: aws.String("companyId"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("storeId"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	}
+}
+
+// callStoresAPI は REST API の Proxy統合で店舗APIを呼び出す
+func callStoresAPI(t *testing.T, claims internaltoken.Claims, method, path, body string) events.APIGatewayProxyResponse {
+	t.Helper()
+	resp, err := newTestBackend().proxyHandler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: method,
+		Path:       path,
+		Body:       body,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]interface{}{
+				"internalToken": signTestInternalToken(t, claims),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func decodeStore(t *testing.T, body string) Store {
+	t.Helper()
+	var store Store
+	if err := json.Unmarshal([]byte(body), &store); err != nil {
+		t.Fatalf("failed to decode store: %v: %s", err, body)
+	}
+	return store
+}
+
+func Test_店舗を作成して取得と更新と削除ができること(t *testing.T) {
+	companyID := testutil.GenerateUniqueID("company")
+	claims := internaltoken.Claims{CompanyID: companyID, Scope: "read:stores write:stores"}
+
+	created := callStoresAPI(t, claims, http.MethodPost, "/stores", `{"name":"渋谷店","address":"東京都渋谷区"}`)
+	assert.Equal(t, http.StatusCreated, created.StatusCode)
+	store := decodeStore(t, created.Body)
+	assert.NotEmpty(t, store.ID)
+	assert.Equal(t, companyID, store.CompanyID)
+	assert.Equal(t, "渋谷店", store.Name)
+	assert.Equal(t, "東京都渋谷区", store.Address)
+	assert.Equal(t, "2026-10-19T12:00:00Z", store.CreatedAt)
+
+	got := callStoresAPI(t, claims, http.MethodGet, "/stores/"+store.ID, "")
+	assert.Equal(t, http.StatusOK, got.StatusCode)
+	assert.Equal(t, store, decodeStore(t, got.Body))
+
+	list := callStoresAPI(t, claims, http.MethodGet, "/stores", "")
+	assert.Equal(t, http.StatusOK, list.StatusCode)
+	var listBody struct {
+		Stores []Store `json:"stores"`
+	}
+	if assert.NoError(t, json.Unmarshal([]byte(list.Body), &listBody)) {
+		assert.Equal(t, []Store{store}, listBody.Stores)
+	}
+
+	updated := callStoresAPI(t, claims, http.MethodPut, "/stores/"+store.ID, `{"name":"渋谷本店"}`)
+	assert.Equal(t, http.StatusOK, updated.StatusCode)
+	updatedStore := decodeStore(t, updated.Body)
+	assert.Equal(t, "渋谷本店", updatedStore.Name)
+	// 住所を省略した場合は削除される
+	assert.Empty(t, updatedStore.Address)
+	assert.Equal(t, store.CreatedAt, updatedStore.CreatedAt)
+
+	deleted := callStoresAPI(t, claims, http.MethodDelete, "/stores/"+store.ID, "")
+	assert.Equal(t, http.StatusNoContent, deleted.StatusCode)
+	assert.Empty(t, deleted.Body)
+
+	assert.Equal(t, http.StatusNotFound, callStoresAPI(t, claims, http.MethodGet, "/stores/"+store.ID, "").StatusCode)
+	assert.Equal(t, http.StatusNotFound, callStoresAPI(t, claims, http.MethodDelete, "/stores/"+store.ID, "").StatusCode)
+}
+
+func Test_他のテナントの店舗は参照も変更もできないこと(t *testing.T) {
+	owner := internaltoken.Claims{CompanyID: testutil.GenerateUniqueID("company"), Scope: "read:stores write:stores"}
+	other := internaltoken.Claims{CompanyID: testutil.GenerateUniqueID("company"), Scope: "read:stores write:stores"}
+
+	created := callStoresAPI(t, owner, http.MethodPost, "/stores", `{"name":"新宿店"}`)
+	assert.Equal(t, http.StatusCreated, created.StatusCode)
+	store := decodeStore(t, created.Body)
+
+	// 存在を明かさないよう、他のテナントの店舗は存在しない店舗と同じく404になる
+	assert.Equal(t, http.StatusNotFound, callStoresAPI(t, other, http.MethodGet, "/stores/"+store.ID, "").StatusCode)
+	assert.Equal(t, http.StatusNotFound, callStoresAPI(t, other, http.MethodPut, "/stores/"+store.ID, `{"name":"乗っ取り"}`).StatusCode)
+	assert.Equal(t, http.StatusNotFound, callStoresAPI(t, other, http.MethodDelete, "/stores/"+store.ID, "").StatusCode)
+
+	list := callStoresAPI(t, other, http.MethodGet, "/stores", "")
+	assert.Equal(t, http.StatusOK, list.StatusCode)
+	assert.JSONEq(t, `{"stores":[]}`, list.Body)
+
+	// 所有するテナントからは変更されていないこと
+	got := callStoresAPI(t, owner, http.MethodGet, "/stores/"+store.ID, "")
+	assert.Equal(t, http.StatusOK, got.StatusCode)
+	assert.Equal(t, "新宿店", decodeStore(t, got.Body).Name)
+}
+
+func Test_操作に必要なスコープとテナントがない場合は403になること(t *testing.T) {
+	companyID := testutil.GenerateUniqueID("company")
+
+	tests := []struct {
+		name   string
+		claims internaltoken.Claims
+		method string
+		path   string
+		body   string
+	}{
+		{name: "read:storesのみで作成", claims: internaltoken.Claims{CompanyID: companyID, Scope: "read:stores"}, method: http.MethodPost, path: "/stores", body: `{"name":"店"}`},
+		{name: "read:storesのみで更新", claims: internaltoken.Claims{CompanyID: companyID, Scope: "read:stores"}, method: http.MethodPut, path: "/stores/1", body: `{"name":"店"}`},
+		{name: "read:storesのみで削除", claims: internaltoken.Claims{CompanyID: companyID, Scope: "read:stores"}, method: http.MethodDelete, path: "/stores/1"},
+		{name: "write:storesのみで一覧", claims: internaltoken.Claims{CompanyID: companyID, Scope: "write:stores"}, method: http.MethodGet, path: "/stores"},
+		{name: "テナントのないトークン", claims: internaltoken.Claims{Scope: "read:stores"}, method: http.MethodGet, path: "/stores"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := callStoresAPI(t, tt.claims, tt.method, tt.path, tt.body)
+
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+			assert.Contains(t, resp.Body, `"code":"FORBIDDEN"`)
+		})
+	}
+}
+
+func Test_不正なリクエストボディは400になること(t *testing.T) {
+	claims := internaltoken.Claims{CompanyID: testutil.GenerateUniqueID("company"), Scope: "write:stores"}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "空", body: ""},
+		{name: "JSONでない", body: "name=店"},
+		{name: "名前がない", body: `{"address":"東京都"}`},
+		{name: "名前が空白のみ", body: `{"name":"  "}`},
+		{name: "名前が長すぎる", body: `{"name":"` + strings.Repeat("店", maxStoreNameLength+1) + `"}`},
+		{name: "住所が長すぎる", body: `{"name":"店","address":"` + strings.Repeat("あ", maxStoreAddressLength+1) + `"}`},
+		{name: "未知のフィールド", body: `{"name":"店","companyId":"other"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := callStoresAPI(t, claims, http.MethodPost, "/stores", tt.body)
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func Test_許可されていないメソッドは405になること(t *testing.T) {
+	claims := internaltoken.Claims{CompanyID: testutil.GenerateUniqueID("company"), Scope: "read:stores write:stores"}
+
+	resp := callStoresAPI(t, claims, http.MethodPatch, "/stores/1", `{"name":"店"}`)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func Test_HTTP_APIのステージ名付きのパスで店舗APIを呼び出せること(t *testing.T) {
+	companyID := testutil.GenerateUniqueID("company")
+	event := events.APIGatewayV2HTTPRequest{
+		Version: "2.0",
+		RawPath: "/test/stores",
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			Stage: "test",
+			HTTP:  events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: http.MethodGet},
+			Authorizer: &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+				Lambda: map[string]interface{}{
+					"internalToken": signTestInternalToken(t, internaltoken.Claims{CompanyID: companyID, Scope: "read:stores"}),
+				},
+			},
+		},
+	}
+
+	resp, err := newTestBackend().httpAPIHandler(context.Background(), event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"stores":[]}`, resp.Body)
+}
+
+func Test_非Proxy統合では店舗APIのエラーをLambdaのエラーとして返すこと(t *testing.T) {
+	companyID := testutil.GenerateUniqueID("company")
+	headers := map[string]string{
+		"X-Internal-Token": "Bearer " + signTestInternalToken(t, internaltoken.Claims{CompanyID: companyID, Scope: "read:stores write:stores"}),
+	}
+
+	out, err := newTestBackend().handler(context.Background(), Request{
+		Headers:    headers,
+		HTTPMethod: http.MethodPost,
+		Path:       "/stores",
+		Body:       `{"name":"池袋店"}`,
+	})
+	assert.NoError(t, err)
+	if assert.IsType(t, Store{}, out) {
+		assert.Equal(t, "池袋店", out.(Store).Name)
+	}
+
+	_, err = newTestBackend().handler(context.Background(), Request{
+		Headers:    headers,
+		HTTPMethod: http.MethodPost,
+		Path:       "/stores",
+		Body:       `{}`,
+	})
+	// 統合レスポンスの selection_pattern が接頭辞で400を選択する
+	assert.EqualError(t, err, "[VALIDATION_ERROR] name is required")
+}
+
+func Test_非Proxy統合ではコードのないエラーを内容を含めないINTERNAL_ERRORにすること(t *testing.T) {
+	backend := newTestBackend()
+	backend.Stores = &StoreRepository{TableName: "Stores_NotExists", DDBClient: backend.Stores.DDBClient}
+
+	_, err := backend.handler(context.Background(), Request{
+		Headers: map[string]string{
+			"X-Internal-Token": "Bearer " + signTestInternalToken(t, internaltoken.Claims{CompanyID: "12345", Scope: "read:stores"}),
+		},
+		HTTPMethod: http.MethodGet,
+		Path:       "/stores",
+	})
+
+	assert.EqualError(t, err, "[INTERNAL_ERROR] internal server error")
+}
+
+func Test_店舗APIのエラーはコード付きの共通のボディになること(t *testing.T) {
+	claims := internaltoken.Claims{CompanyID: testutil.GenerateUniqueID("company"), Scope: "read:stores write:stores"}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantBody string
+	}{
+		{
+			name: "不正なリクエストボディ", method: http.MethodPost, path: "/stores", body: `{}`,
+			wantBody: `{"status":"error","code":"VALIDATION_ERROR","message":"name is required"}`,
+		},
+		{
+			name: "存在しない店舗", method: http.MethodGet, path: "/stores/missing",
+			wantBody: `{"status":"error","code":"NOT_FOUND","message":"store missing not found"}`,
+		},
+		{
+			name: "許可されていないメソッド", method: http.MethodPatch, path: "/stores/missing",
+			wantBody: `{"status":"error","code":"METHOD_NOT_ALLOWED","message":"method PATCH is not allowed"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := callStoresAPI(t, claims, tt.method, tt.path, tt.body)
+
+			assert.JSONEq(t, tt.wantBody, resp.Body)
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	DefaultTableName = "AllowedTokens"
+	// DefaultLockoutTableName は Authorizer が認証失敗の回数とロックアウトを保持するテーブル名
+	DefaultLockoutTableName = "AuthFailures"
+	// DefaultAuditTableName は監査ログのテーブル名（Authorizer と共通）
+	DefaultAuditTableName = "AuthzAuditLog"
+)
+
+// AuditEventUnlock はロックアウトを解除した監査ログのイベント
+const AuditEventUnlock = "unlock"
+
+const (
+	// DefaultGracePeriod はローテーション後に旧トークンを受け付けるデフォルトの猶予期間
+	DefaultGracePeriod = 24 * time.Hour
+	// MaxGracePeriod は指定可能な猶予期間の上限
+	MaxGracePeriod = 30 * 24 * time.Hour
+)
+
+// ローテーション時に新トークンへ引き継がない属性
+var rotationAttributes = []string{"token", "replacedBy", "graceExpiresAt", "rotatedFrom"}
+
+// Admin はトークン管理操作を行うLambdaの構造体
+type Admin struct {
+	TableName        string
+	LockoutTableName string
+	AuditTableName   string
+	DDBClient        *dynamodb.Client
+	// Now は現在時刻を返す（テスト用に差し替え可能、nil の場合は time.Now）
+	Now func() time.Time
+}
+
+// Request はトークン管理操作のリクエスト
+type Request struct {
+	// Action は操作の種類（rotate / unlock）
+	Action string `json:"action"`
+	Token  string `json:"token"`
+	// GracePeriodSeconds は旧トークンを受け付ける猶予期間（秒、省略時は24時間）
+	GracePeriodSeconds int64 `json:"gracePeriodSeconds,omitempty"`
+	// Subject はロックアウトを解除する対象（"ip#<送信元IP>"）
+	Subject string `json:"subject,omitempty"`
+	// Operator は操作した管理者（監査ログに記録する）
+	Operator string `json:"operator,omitempty"`
+}
+
+// Response はトークン管理操作のレスポンス
+type Response struct {
+	Action string `json:"action"`
+	// Token はローテーションで発行された新しいトークン
+	Token string `json:"token,omitempty"`
+	// ReplacedToken はローテーションされた旧トークン
+	ReplacedToken string `json:"replacedToken,omitempty"`
+	// GraceExpiresAt は旧トークンの猶予期限（Unix秒）
+	GraceExpiresAt int64 `json:"graceExpiresAt,omitempty"`
+	// Subject はロックアウトを解除した対象
+	Subject string `json:"subject,omitempty"`
+	// LockedUntil は解除前のロックアウトの期限（Unix秒、ロックアウト中でなかった場合は省略）
+	LockedUntil int64 `json:"lockedUntil,omitempty"`
+}
+
+// NewAdmin はAdminを作成する
+func NewAdmin(ctx context.Context) (*Admin, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	return &Admin{
+		TableName:        DefaultTableName,
+		LockoutTableName: DefaultLockoutTableName,
+		AuditTableName:   DefaultAuditTableName,
+		DDBClient:        dynamodb.NewFromConfig(cfg),
+	}, nil
+}
+
+func (a *Admin) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
+
+// Handler はトークン管理Lambdaのハンドラ
+func (a *Admin) Handler(ctx context.Context, req Request) (Response, error) {
+	switch req.Action {
+	case "rotate":
+		return a.rotate(ctx, req)
+	case "unlock":
+		return a.unlock(ctx, req)
+	default:
+		return Response{}, fmt.Errorf("unsupported action: %q", req.Action)
+	}
+}
+
+// rotate は旧トークンに紐づく新トークンを発行する
+// 旧トークンには replacedBy と猶予期限を設定し、猶予期間中は新旧どちらでも認可される
+func (a *Admin) rotate(ctx context.Context, req Request) (Response, error) {
+	if req.Token == "" {
+		return Response{}, errors.New("token is required")
+	}
+
+	grace := DefaultGracePeriod
+	if req.GracePeriodSeconds != 0 {
+		grace = time.Duration(req.GracePeriodSeconds) * time.Second
+	}
+	if grace <= 0 || grace > MaxGracePeriod {
+		return Response{}, fmt.Errorf("gracePeriodSeconds must be between 1 and %d", int64(MaxGracePeriod/time.Second))
+	}
+
+	out, err := a.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(a.TableName),
+		Key:            tokenKey(req.Token),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to get token: %w", err)
+	}
+	if out.Item == nil {
+		return Response{}, errors.New("token not found")
+	}
+	if _, ok := out.Item["replacedBy"]; ok {
+		return Response{}, errors.New("token has already been rotated")
+	}
+	if v, ok := out.Item["active"].(*types.AttributeValueMemberBOOL); ok && !v.Value {
+		return Response{}, errors.New("inactive token cannot be rotated")
+	}
+
+	newToken, err := generateToken()
+	if err != nil {
+		return Response{}, err
+	}
+	graceExpiresAt := a.now().Add(grace).Unix()
+
+	// 新トークンは旧トークンの属性（companyId, scopes 等）を引き継ぐ
+	item := make(map[string]types.AttributeValue, len(out.Item))
+	for k, v := range out.Item {
+		item[k] = v
+	}
+	for _, k := range rotationAttributes {
+		delete(item, k)
+	}
+	item["token"] = &types.AttributeValueMemberS{Value: newToken}
+	item["rotatedFrom"] = &types.AttributeValueMemberS{Value: req.Token}
+
+	// 新トークンの発行と旧トークンの更新はトランザクションで行う（同時ローテーションも防ぐ）
+	_, err = a.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:                aws.String(a.TableName),
+					Item:                     item,
+					ConditionExpression:      aws.String("attribute_not_exists(#token)"),
+					ExpressionAttributeNames: map[string]string{"#token": "token"},
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName:           aws.String(a.TableName),
+					Key:                 tokenKey(req.Token),
+					UpdateExpression:    aws.String("SET replacedBy = :new, graceExpiresAt = :grace"),
+					ConditionExpression: aws.String("attribute_exists(#token) AND attribute_not_exists(replacedBy)"),
+					ExpressionAttributeNames: map[string]string{
+						"#token": "token",
+					},
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":new":   &types.AttributeValueMemberS{Value: newToken},
+						":grace": &types.AttributeValueMemberN{Value: strconv.FormatInt(graceExpiresAt, 10)},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to rotate token: %w", err)
+	}
+
+	log.Printf("[TokenAdmin] Token rotated (grace period until %s)", time.Unix(graceExpiresAt, 0).UTC().Format(time.RFC3339))
+
+	return Response{
+		Action:         req.Action,
+		Token:          newToken,
+		ReplacedToken:  req.Token,
+		GraceExpiresAt: graceExpiresAt,
+	}, nil
+}
+
+// unlock は対象のロックアウトを解除し、認証失敗の回数もリセットする
+// 解除と監査ログの書き込みは1つのトランザクションで行い、監査ログに記録できない場合は解除しない
+func (a *Admin) unlock(ctx context.Context, req Request) (Response, error) {
+	if !strings.HasPrefix(req.Subject, "ip#") {
+		return Response{}, errors.New(`subject must start with "ip#"`)
+	}
+	if req.Operator == "" {
+		return Response{}, errors.New("operator is required")
+	}
+
+	key := map[string]types.AttributeValue{
+		"subject": &types.AttributeValueMemberS{Value: req.Subject},
+	}
+	// トランザクションの削除は削除前の項目を返せないため、監査ログに含める回数・期限は先に読む
+	out, err := a.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(a.LockoutTableName),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to get lockout: %w", err)
+	}
+
+	var old struct {
+		Failures    int   `dynamodbav:"failures"`
+		LockedUntil int64 `dynamodbav:"lockedUntil"`
+	}
+	if err := attributevalue.UnmarshalMap(out.Item, &old); err != nil {
+		return Response{}, fmt.Errorf("failed to parse lockout: %w", err)
+	}
+	now := a.now()
+	if !now.Before(time.Unix(old.LockedUntil, 0)) {
+		old.LockedUntil = 0
+	}
+
+	details := map[string]string{
+		"operator": req.Operator,
+		"failures": strconv.Itoa(old.Failures),
+	}
+	if old.LockedUntil != 0 {
+		details["lockedUntil"] = time.Unix(old.LockedUntil, 0).UTC().Format(time.RFC3339)
+	}
+	audit, err := auditItem(req.Subject, AuditEventUnlock, details, now)
+	if err != nil {
+		return Response{}, err
+	}
+
+	_, err = a.DDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Delete: &types.Delete{
+					TableName: aws.String(a.LockoutTableName),
+					Key:       key,
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName: aws.String(a.AuditTableName),
+					Item:      audit,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to unlock: %w", err)
+	}
+
+	log.Printf("[TokenAdmin] Unlocked %s", req.Subject)
+
+	return Response{
+		Action:      req.Action,
+		Subject:     req.Subject,
+		LockedUntil: old.LockedUntil,
+	}, nil
+}
+
+// auditItem は Authorizer と同じ形式（subject + 発生時刻順の id）の監査ログの項目を作成する
+func auditItem(subject, event string, details map[string]string, now time.Time) (map[string]types.AttributeValue, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate audit entry id: %w", err)
+	}
+	occurredAt := now.UTC().Format(time.RFC3339Nano)
+
+	item, err := attributevalue.MarshalMap(map[string]interface{}{
+		"subject":    subject,
+		"id":         occurredAt + "#" + hex.EncodeToString(suffix),
+		"event":      event,
+		"occurredAt": occurredAt,
+		"details":    details,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	return item, nil
+}
+
+func tokenKey(token string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"token": &types.AttributeValueMemberS{Value: token},
+	}
+}
+
+// generateToken は推測不可能なトークン文字列を生成する
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func main() {
+	ctx := context.Background()
+	admin, err := NewAdmin(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize token admin: %v", err)
+	}
+	lambda.Start(admin.Handler)
+}
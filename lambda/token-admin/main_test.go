@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"local-gateway/lambda/testutil"
+	"local-gateway/lambda/tokensync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	TestTableName        = "AllowedTokens_AdminTest"
+	TestLockoutTableName = "AuthFailures_AdminTest"
+	TestAuditTableName   = "AuthzAuditLog_AdminTest"
+)
+
+var testDDBClient *dynamodb.Client
+var testAdmin *Admin
+var testNow = time.Unix(1_700_000_000, 0)
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	// DynamoDBクライアント作成
+	var err error
+	testDDBClient, err = testutil.NewDynamoDBClient(ctx)
+	if err != nil {
+		fmt.Printf("Failed to create DynamoDB client: %v\n", err)
+		os.Exit(1)
+	}
+
+	// テスト用Adminを作成（DIパターン）
+	testAdmin = &Admin{
+		TableName:        TestTableName,
+		LockoutTableName: TestLockoutTableName,
+		AuditTableName:   TestAuditTableName,
+		DDBClient:        testDDBClient,
+		Now:              func() time.Time { return testNow },
+	}
+
+	// テスト用テーブル作成
+	schemas := []testutil.TableSchema{
+		testutil.NewSimpleTableSchema(TestTableName, "token", types.ScalarAttributeTypeS),
+		testutil.NewSimpleTableSchema(TestLockoutTableName, "subject", types.ScalarAttributeTypeS),
+		{
+			TableName: TestAuditTableName,
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("subject"), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String("id"), KeyType: types.KeyTypeRange},
+			},
+			Attributes: []types.AttributeDefinition{
+				{AttributeName: aws.String("subject"), AttributeType: types.ScalarAttributeTypeS},
+				{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+			},
+		},
+	}
+	for _, schema := range schemas {
+		if err := testutil.EnsureTable(ctx, testDDBClient, schema); err != nil {
+			fmt.Printf("Failed to setup test table: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// 全テスト実行
+	code := m.Run()
+
+	// テスト用テーブル削除
+	for _, schema := range schemas {
+		testutil.DeleteTable(ctx, testDDBClient, schema.TableName)
+	}
+
+	os.Exit(code)
+}
+
+// ヘルパー関数: テストトークンを取得
+func getTestToken(t *testing.T, token string) map[string]types.AttributeValue {
+	t.Helper()
+	out, err := testDDBClient.GetItem(context.Background(), &dynamodb.GetItemInput{
+		TableName: aws.String(TestTableName),
+		Key:       tokenKey(token),
+	})
+	if err != nil {
+		t.Fatalf("failed to get token: %v", err)
+	}
+	return out.Item
+}
+
+func Test_トークンをローテーションすると新旧トークンが紐づくこと(t *testing.T) {
+	oldToken := testutil.GenerateUniqueID("old")
+	err := testutil.PutItem(context.Background(), testDDBClient, TestTableName, map[string]types.AttributeValue{
+		"token":     &types.AttributeValueMemberS{Value: oldToken},
+		"companyId": &types.AttributeValueMemberS{Value: "12345"},
+		"scopes":    &types.AttributeValueMemberSS{Value: []string{"read:stores"}},
+	})
+	assert.NoError(t, err)
+
+	resp, err := testAdmin.Handler(context.Background(), Request{
+		Action:             "rotate",
+		Token:              oldToken,
+		GracePeriodSeconds: 3600,
+	})
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, resp.Token)
+	assert.NotEqual(t, oldToken, resp.Token)
+	assert.Equal(t, oldToken, resp.ReplacedToken)
+	assert.Equal(t, testNow.Add(time.Hour).Unix(), resp.GraceExpiresAt)
+
+	// 旧トークンには新トークンへのポインタと猶予期限が設定される
+	old := getTestToken(t, oldToken)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: resp.Token}, old["replacedBy"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: fmt.Sprint(resp.GraceExpiresAt)}, old["graceExpiresAt"])
+
+	// 新トークンは旧トークンの属性を引き継ぐ
+	issued := getTestToken(t, resp.Token)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: oldToken}, issued["rotatedFrom"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "12345"}, issued["companyId"])
+	assert.NotContains(t, issued, "replacedBy")
+}
+
+func Test_ローテーションできない場合はエラーを返すこと(t *testing.T) {
+	rotated := testutil.GenerateUniqueID("rotated")
+	err := testutil.PutItem(context.Background(), testDDBClient, TestTableName, map[string]types.AttributeValue{
+		"token":      &types.AttributeValueMemberS{Value: rotated},
+		"replacedBy": &types.AttributeValueMemberS{Value: "other"},
+	})
+	assert.NoError(t, err)
+
+	inactive := testutil.GenerateUniqueID("inactive")
+	err = testutil.PutItem(context.Background(), testDDBClient, TestTableName, map[string]types.AttributeValue{
+		"token":  &types.AttributeValueMemberS{Value: inactive},
+		"active": &types.AttributeValueMemberBOOL{Value: false},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		req     Request
+		wantErr string
+	}{
+		{"存在しないトークン", Request{Action: "rotate", Token: testutil.GenerateUniqueID("missing")}, "token not found"},
+		{"ローテーション済みのトークン", Request{Action: "rotate", Token: rotated}, "already been rotated"},
+		{"非アクティブなトークン", Request{Action: "rotate", Token: inactive}, "inactive token"},
+		{"猶予期間が上限を超える", Request{Action: "rotate", Token: rotated, GracePeriodSeconds: 31 * 24 * 3600}, "gracePeriodSeconds"},
+		{"未対応のアクション", Request{Action: "delete", Token: rotated}, "unsupported action"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testAdmin.Handler(context.Background(), tt.req)
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_ロックアウトを解除すると監査ログに記録されること(t *testing.T) {
+	subject := testutil.GenerateUniqueID("ip#203.0.113")
+	lockedUntil := testNow.Add(10 * time.Minute).Unix()
+	err := testutil.PutItem(context.Background(), testDDBClient, TestLockoutTableName, map[string]types.AttributeValue{
+		"subject":     &types.AttributeValueMemberS{Value: subject},
+		"failures":    &types.AttributeValueMemberN{Value: "10"},
+		"windowStart": &types.AttributeValueMemberN{Value: strconv.FormatInt(testNow.Unix(), 10)},
+		"lockedUntil": &types.AttributeValueMemberN{Value: strconv.FormatInt(lockedUntil, 10)},
+	})
+	assert.NoError(t, err)
+
+	resp, err := testAdmin.Handler(context.Background(), Request{Action: "unlock", Subject: subject, Operator: "support@example.com"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Response{Action: "unlock", Subject: subject, LockedUntil: lockedUntil}, resp)
+
+	out, err := testDDBClient.GetItem(context.Background(), &dynamodb.GetItemInput{
+		TableName: aws.String(TestLockoutTableName),
+		Key:       map[string]types.AttributeValue{"subject": &types.AttributeValueMemberS{Value: subject}},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, out.Item, "認証失敗の回数もリセットされる")
+
+	scan, err := testDDBClient.Scan(context.Background(), &dynamodb.ScanInput{TableName: aws.String(TestAuditTableName)})
+	assert.NoError(t, err)
+	var entries []map[string]interface{}
+	assert.NoError(t, attributevalue.UnmarshalListOfMaps(scan.Items, &entries))
+	var found []map[string]interface{}
+	for _, e := range entries {
+		if e["subject"] == subject {
+			found = append(found, e)
+		}
+	}
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "unlock", found[0]["event"])
+		assert.Equal(t, map[string]interface{}{
+			"operator":    "support@example.com",
+			"failures":    "10",
+			"lockedUntil": time.Unix(lockedUntil, 0).UTC().Format(time.RFC3339),
+		}, found[0]["details"])
+	}
+}
+
+func Test_監査ログに記録できない場合はロックアウトを解除しないこと(t *testing.T) {
+	subject := testutil.GenerateUniqueID("ip#203.0.113")
+	lockedUntil := testNow.Add(10 * time.Minute).Unix()
+	err := testutil.PutItem(context.Background(), testDDBClient, TestLockoutTableName, map[string]types.AttributeValue{
+		"subject":     &types.AttributeValueMemberS{Value: subject},
+		"failures":    &types.AttributeValueMemberN{Value: "10"},
+		"lockedUntil": &types.AttributeValueMemberN{Value: strconv.FormatInt(lockedUntil, 10)},
+	})
+	assert.NoError(t, err)
+
+	admin := *testAdmin
+	admin.AuditTableName = "AuthzAuditLog_Missing"
+
+	_, err = admin.Handler(context.Background(), Request{Action: "unlock", Subject: subject, Operator: "support@example.com"})
+
+	assert.ErrorContains(t, err, "failed to unlock")
+	out, err := testDDBClient.GetItem(context.Background(), &dynamodb.GetItemInput{
+		TableName: aws.String(TestLockoutTableName),
+		Key:       map[string]types.AttributeValue{"subject": &types.AttributeValueMemberS{Value: subject}},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, out.Item, "ロックアウトは解除されない")
+}
+
+func Test_ロックアウトを解除できない場合はエラーを返すこと(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     Request
+		wantErr string
+	}{
+		{"対象の形式が不正", Request{Action: "unlock", Subject: "203.0.113.1", Operator: "support@example.com"}, `subject must start with "ip#"`},
+		{"操作者の指定がない", Request{Action: "unlock", Subject: "ip#203.0.113.1"}, "operator is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testAdmin.Handler(context.Background(), tt.req)
+
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_発行するトークンが管理用のトークンと判定されないこと(t *testing.T) {
+	// base64url のアルファベットに予約プレフィックスの先頭の文字が含まれないこと
+	const base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	assert.NotContains(t, base64URLAlphabet, tokensync.ReservedPrefix[:1])
+
+	for i := 0; i < 10000; i++ {
+		token, err := generateToken()
+		assert.NoError(t, err)
+		if tokensync.IsReserved(token) {
+			t.Fatalf("generated token %q is reserved", token)
+		}
+	}
+}
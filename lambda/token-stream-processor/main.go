@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"local-gateway/lambda/tokensync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const DefaultTableName = "AllowedTokens"
+
+// マーカー更新が競合した場合の再試行回数
+const maxMarkerAttempts = 5
+
+// Processor は AllowedTokens の DynamoDB Streams を受け取り、
+// 変更のあったトークンをバージョンマーカーに記録する Lambda の構造体
+type Processor struct {
+	TableName string
+	DDBClient *dynamodb.Client
+}
+
+// NewProcessor はProcessorを作成する
+func NewProcessor(ctx context.Context) (*Processor, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	return &Processor{
+		TableName: DefaultTableName,
+		DDBClient: dynamodb.NewFromConfig(cfg),
+	}, nil
+}
+
+// Handler は DynamoDB Streams イベントのハンドラ
+// 失敗した場合はエラーを返し、Lambda にバッチ全体を再試行させる
+func (p *Processor) Handler(ctx context.Context, event events.DynamoDBEvent) error {
+	tokens := changedTokens(event)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	for attempt := 1; attempt <= maxMarkerAttempts; attempt++ {
+		err := p.recordChanges(ctx, tokens)
+		if err == nil {
+			log.Printf("[TokenStreamProcessor] Recorded %d changed tokens", len(tokens))
+			return nil
+		}
+
+		var conflict *types.ConditionalCheckFailedException
+		if !errors.As(err, &conflict) {
+			return err
+		}
+		log.Printf("[TokenStreamProcessor] Version marker was updated concurrently, retrying (%d/%d)", attempt, maxMarkerAttempts)
+	}
+	return fmt.Errorf("failed to update version marker after %d attempts", maxMarkerAttempts)
+}
+
+// recordChanges はマーカーのバージョンを上げて変更を追記する
+// 読み込んだバージョンから変わっていない場合のみ書き込む（楽観的ロック）
+func (p *Processor) recordChanges(ctx context.Context, tokens []string) error {
+	out, err := p.DDBClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(p.TableName),
+		Key:            map[string]types.AttributeValue{"token": &types.AttributeValueMemberS{Value: tokensync.MarkerToken}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get version marker: %w", err)
+	}
+
+	var marker tokensync.Marker
+	if out.Item != nil {
+		if err := attributevalue.UnmarshalMap(out.Item, &marker); err != nil {
+			return fmt.Errorf("invalid version marker: %w", err)
+		}
+	}
+	prev := marker.Version
+	marker.Record(tokens)
+
+	item, err := attributevalue.MarshalMap(marker)
+	if err != nil {
+		return fmt.Errorf("failed to encode version marker: %w", err)
+	}
+
+	_, err = p.DDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(p.TableName),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#token) OR #version = :prev"),
+		ExpressionAttributeNames: map[string]string{"#token": "token", "#version": "version"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":prev": &types.AttributeValueMemberN{Value: strconv.FormatInt(prev, 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put version marker: %w", err)
+	}
+	return nil
+}
+
+// changedTokens はイベントに含まれる変更されたトークンを重複なく返す
+// マーカー自身の更新イベントは無視する
+func changedTokens(event events.DynamoDBEvent) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, r := range event.Records {
+		key, ok := r.Change.Keys["token"]
+		if !ok || key.DataType() != events.DataTypeString {
+			continue
+		}
+		token := key.String()
+		if tokensync.IsReserved(token) || seen[token] {
+			continue
+		}
+		seen[token] = true
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func main() {
+	ctx := context.Background()
+	processor, err := NewProcessor(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize token stream processor: %v", err)
+	}
+	lambda.Start(processor.Handler)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"local-gateway/lambda/testutil"
+	"local-gateway/lambda/tokensync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const TestTableName = "AllowedTokens_StreamTest"
+
+var testDDBClient *dynamodb.Client
+var testProcessor *Processor
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	// DynamoDBクライアント作成
+	var err error
+	testDDBClient, err = testutil.NewDynamoDBClient(ctx)
+	if err != nil {
+		fmt.Printf("Failed to create DynamoDB client: %v\n", err)
+		os.Exit(1)
+	}
+
+	// テスト用Processorを作成（DIパターン）
+	testProcessor = &Processor{
+		TableName: TestTableName,
+		DDBClient: testDDBClient,
+	}
+
+	// テスト用テーブル作成
+	schema := testutil.NewSimpleTableSchema(TestTableName, "token", types.ScalarAttributeTypeS)
+	if err := testutil.EnsureTable(ctx, testDDBClient, schema); err != nil {
+		fmt.Printf("Failed to setup test table: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 全テスト実行
+	code := m.Run()
+
+	// テスト用テーブル削除
+	testutil.DeleteTable(ctx, testDDBClient, TestTableName)
+
+	os.Exit(code)
+}
+
+// ヘルパー関数: バージョンマーカーを取得
+func getMarker(t *testing.T) tokensync.Marker {
+	t.Helper()
+	out, err := testDDBClient.GetItem(context.Background(), &dynamodb.GetItemInput{
+		TableName: aws.String(TestTableName),
+		Key:       map[string]types.AttributeValue{"token": &types.AttributeValueMemberS{Value: tokensync.MarkerToken}},
+	})
+	if err != nil {
+		t.Fatalf("failed to get marker: %v", err)
+	}
+	var marker tokensync.Marker
+	if err := attributevalue.UnmarshalMap(out.Item, &marker); err != nil {
+		t.Fatalf("failed to decode marker: %v", err)
+	}
+	return marker
+}
+
+// ヘルパー関数: トークンの変更イベントを作成
+func streamEvent(tokens ...string) events.DynamoDBEvent {
+	var event events.DynamoDBEvent
+	for _, token := range tokens {
+		event.Records = append(event.Records, events.DynamoDBEventRecord{
+			EventName: "MODIFY",
+			Change: events.DynamoDBStreamRecord{
+				Keys: map[string]events.DynamoDBAttributeValue{
+					"token": events.NewStringAttribute(token),
+				},
+			},
+		})
+	}
+	return event
+}
+
+func Test_変更されたトークンがバージョンマーカーに記録されること(t *testing.T) {
+	before := getMarker(t)
+
+	err := testProcessor.Handler(context.Background(), streamEvent("a", "b", "a"))
+	assert.NoError(t, err)
+
+	err = testProcessor.Handler(context.Background(), streamEvent("c"))
+	assert.NoError(t, err)
+
+	marker := getMarker(t)
+	assert.Equal(t, before.Version+2, marker.Version)
+
+	tokens, ok := marker.ChangedSince(before.Version)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b", "c"}, tokens)
+}
+
+func Test_マーカー自身の変更イベントは無視されること(t *testing.T) {
+	before := getMarker(t)
+
+	err := testProcessor.Handler(context.Background(), streamEvent(tokensync.MarkerToken))
+
+	assert.NoError(t, err)
+	assert.Equal(t, before.Version, getMarker(t).Version)
+}
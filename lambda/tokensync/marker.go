@@ -0,0 +1,76 @@
+// Package tokensync は AllowedTokens テーブルの変更を Authorizer のメモリ上のキャッシュへ伝えるための
+// バージョンマーカー項目を扱う
+//
+// token-stream-processor が DynamoDB Streams の変更をマーカー項目に記録し、
+// authz-go はマーカーをポーリングして変更のあったトークンだけを読み直す
+package tokensync
+
+import "strings"
+
+const (
+	// ReservedPrefix は管理用項目のトークンに使うプレフィックス（認可には使えない）
+	// token-admin が発行するトークン（base64url）に現れない文字にし、発行したトークンと衝突しないようにする
+	ReservedPrefix = "!"
+	// MarkerToken はバージョンマーカー項目のキー
+	MarkerToken = ReservedPrefix + "version"
+	// MaxRecentChanges はマーカーに保持する変更履歴の上限
+	MaxRecentChanges = 100
+)
+
+// IsReserved は管理用項目のトークンかを判定する
+func IsReserved(token string) bool {
+	return strings.HasPrefix(token, ReservedPrefix)
+}
+
+// Change は1件のトークン変更
+type Change struct {
+	Token string `dynamodbav:"token"`
+	// Version は変更が記録されたマーカーのバージョン
+	Version int64 `dynamodbav:"version"`
+}
+
+// Marker はバージョンマーカー項目
+type Marker struct {
+	Token string `dynamodbav:"token"`
+	// Version は変更が記録されるたびに1ずつ増える
+	Version int64 `dynamodbav:"version"`
+	// Changes は直近の変更履歴（古い順、最大 MaxRecentChanges 件）
+	Changes []Change `dynamodbav:"changes"`
+}
+
+// Record は変更のあったトークンを新しいバージョンとして記録する
+func (m *Marker) Record(tokens []string) {
+	m.Token = MarkerToken
+	m.Version++
+	for _, t := range tokens {
+		m.Changes = append(m.Changes, Change{Token: t, Version: m.Version})
+	}
+	if over := len(m.Changes) - MaxRecentChanges; over > 0 {
+		// 同じバージョンの変更が途中で切れないよう、バージョン単位で切り詰める
+		for over < len(m.Changes) && m.Changes[over].Version == m.Changes[over-1].Version {
+			over++
+		}
+		m.Changes = m.Changes[over:]
+	}
+}
+
+// ChangedSince は指定バージョンより後に変更されたトークンを返す
+// 変更履歴が切り詰められていて差分を求められない場合は ok が false になる（全件読み直しが必要）
+func (m *Marker) ChangedSince(version int64) (tokens []string, ok bool) {
+	if version >= m.Version {
+		return nil, true
+	}
+	if len(m.Changes) == 0 || m.Changes[0].Version > version+1 {
+		return nil, false
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range m.Changes {
+		if c.Version <= version || seen[c.Token] {
+			continue
+		}
+		seen[c.Token] = true
+		tokens = append(tokens, c.Token)
+	}
+	return tokens, true
+}
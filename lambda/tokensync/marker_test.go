@@ -0,0 +1,65 @@
+package tokensync
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_記録した変更がバージョン以降の差分として取得できること(t *testing.T) {
+	var m Marker
+	m.Record([]string{"a", "b"})
+	m.Record([]string{"b"})
+	m.Record([]string{"c"})
+
+	assert.Equal(t, MarkerToken, m.Token)
+	assert.Equal(t, int64(3), m.Version)
+
+	tests := []struct {
+		name    string
+		version int64
+		want    []string
+	}{
+		{"初回から", 0, []string{"a", "b", "c"}},
+		{"途中から", 1, []string{"b", "c"}},
+		{"最新の場合は差分なし", 3, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, ok := m.ChangedSince(tt.version)
+
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, tokens)
+		})
+	}
+}
+
+func Test_変更履歴が切り詰められた場合は差分を求められないこと(t *testing.T) {
+	var m Marker
+	m.Record([]string{"first"})
+	many := make([]string, MaxRecentChanges)
+	for i := range many {
+		many[i] = fmt.Sprintf("t-%d", i)
+	}
+	m.Record(many)
+	m.Record([]string{"last"})
+
+	// バージョン2の変更は一部だけ残ることはなく、まとめて切り詰められる
+	assert.Equal(t, []Change{{Token: "last", Version: 3}}, m.Changes)
+
+	_, ok := m.ChangedSince(0)
+	assert.False(t, ok)
+
+	tokens, ok := m.ChangedSince(2)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"last"}, tokens)
+}
+
+func Test_管理用のトークンを判定できること(t *testing.T) {
+	assert.True(t, IsReserved(MarkerToken))
+	assert.False(t, IsReserved("allow"))
+	// base64url のトークンは "_" で始まることがあるため、管理用と判定しない
+	assert.False(t, IsReserved("__Zx3k"))
+}
@@ -1,10 +1,20 @@
 # ローカル環境用 Terraform 設定
 
+# 内部トークン（Authorizer → バックエンド）の署名鍵
+# Authorizer と各バックエンドで同じ値を使う（ローカル専用の値、本番は Secrets Manager 等で管理する）
+locals {
+  internal_token_signing_key = "local-internal-token-signing-key-0123456789"
+
+  # シードデータのテナント（companyId 12345）の usage plan の API キー（init/seed_dynamodb.sh と同じ値）
+  seed_tenant_api_key = "local-seed-tenant-api-key"
+}
+
 # DynamoDB テーブル
 module "dynamodb" {
   source = "../modules/dynamodb"
 
-  table_name = "AllowedTokens"
+  table_name     = "AllowedTokens"
+  stream_enabled = true # token-stream-processor でトークンの変更を Authorizer に伝える
   # enable_encryption = false (デフォルト) - LocalStackでは未サポート
 
   tags = {
@@ -13,6 +23,75 @@ module "dynamodb" {
   }
 }
 
+# 認証失敗の回数とロックアウト（Authorizer が送信元IPごとに記録）
+resource "aws_dynamodb_table" "auth_failures" {
+  name         = "AuthFailures"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "subject"
+
+  attribute {
+    name = "subject"
+    type = "S"
+  }
+
+  # 失敗の回数とロックアウトは期限を過ぎると自動的に削除する
+  ttl {
+    attribute_name = "expiresAt"
+    enabled        = true
+  }
+
+  tags = {
+    Environment = "local"
+    ManagedBy   = "terraform"
+  }
+}
+
+# 監査ログ（ロックアウト・解除等）
+resource "aws_dynamodb_table" "authz_audit_log" {
+  name         = "AuthzAuditLog"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "subject"
+  range_key    = "id" # 発生時刻 + 乱数（発生順に並ぶ）
+
+  attribute {
+    name = "subject"
+    type = "S"
+  }
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  tags = {
+    Environment = "local"
+    ManagedBy   = "terraform"
+  }
+}
+
+# 店舗（test-function の店舗APIが使う、テナントごとに companyId で分離）
+resource "aws_dynamodb_table" "stores" {
+  name         = "Stores"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "companyId"
+  range_key    = "storeId"
+
+  attribute {
+    name = "companyId"
+    type = "S"
+  }
+
+  attribute {
+    name = "storeId"
+    type = "S"
+  }
+
+  tags = {
+    Environment = "local"
+    ManagedBy   = "terraform"
+  }
+}
+
 # Lambda Authorizer 関数
 module "lambda_authorizer" {
   source = "../modules/lambda"
@@ -25,6 +104,31 @@ module "lambda_authorizer" {
   enable_dynamodb_policy = true
   dynamodb_table_name    = module.dynamodb.table_name
   dynamodb_table_arn     = module.dynamodb.table_arn
+  dynamodb_actions       = ["dynamodb:GetItem", "dynamodb:Scan", "dynamodb:DescribeTable"] # Scan はトークンのプリロード用、DescribeTable はヘルスチェック用
+
+  # ロックアウトの確認・記録と監査ログの書き込み（DescribeTable はヘルスチェック用）
+  additional_policy_statements = [
+    { actions = ["dynamodb:GetItem", "dynamodb:UpdateItem", "dynamodb:DescribeTable"], resources = [aws_dynamodb_table.auth_failures.arn] },
+    { actions = ["dynamodb:PutItem", "dynamodb:DescribeTable"], resources = [aws_dynamodb_table.authz_audit_log.arn] },
+  ]
+
+  # トークンをコールドスタート時にメモリへ読み込む（上限を超える場合は GetItem にフォールバック）
+  environment_variables = {
+    PRELOAD_TOKENS                = "true"
+    PRELOAD_MAX_ITEMS             = "1000"
+    PRELOAD_POLL_INTERVAL_SECONDS = "30"
+    # 扱う認証方式（ローカルでは mTLS を使わず、apikey の項目もシードしていない）
+    AUTHENTICATOR_CHAIN = "hmac,opaque"
+    # 5分間に10回認証に失敗した送信元IPを15分間ロックアウトする（REQUEST タイプの Authorizer のみ有効）
+    AUTHZ_LOCKOUT_THRESHOLD        = "10"
+    AUTHZ_LOCKOUT_WINDOW_SECONDS   = "300"
+    AUTHZ_LOCKOUT_DURATION_SECONDS = "900"
+    # Allow時にバックエンドへ渡す内部トークンの署名鍵
+    INTERNAL_TOKEN_SIGNING_KEY = local.internal_token_signing_key
+    # apiKey 属性のないトークン（HMAC 等）に使うテナントの usage plan の API キー
+    # usage plan を使うと各メソッドは API キー必須になり、キーを返せない呼び出し元は 403 になる
+    AUTHZ_TENANT_API_KEYS = jsonencode({ "12345" = local.seed_tenant_api_key })
+  }
 
   tags = {
     Environment = "local"
@@ -32,6 +136,26 @@ module "lambda_authorizer" {
   }
 }
 
+# Authorizer のウォームアップ（5分ごとにヘルスチェックイベントで呼び出し、JWKS 等を取得しておく）
+resource "aws_cloudwatch_event_rule" "authorizer_warmup" {
+  name                = "authz-go-warmup"
+  schedule_expression = "rate(5 minutes)"
+}
+
+resource "aws_cloudwatch_event_target" "authorizer_warmup" {
+  rule  = aws_cloudwatch_event_rule.authorizer_warmup.name
+  arn   = module.lambda_authorizer.function_arn
+  input = jsonencode({ type = "HEALTH_CHECK" })
+}
+
+resource "aws_lambda_permission" "authorizer_warmup" {
+  statement_id  = "AllowEventBridgeWarmup"
+  action        = "lambda:InvokeFunction"
+  function_name = module.lambda_authorizer.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.authorizer_warmup.arn
+}
+
 # テスト用 Lambda 関数
 module "lambda_test_function" {
   source = "../modules/lambda"
@@ -41,12 +165,94 @@ module "lambda_test_function" {
   timeout       = 10  # テスト用途の軽量関数
   iam_role_name = "lambda-test-function-role"
 
+  # 店舗API（DescribeTable はヘルスチェック用）
+  iam_policy_name        = "lambda-test-function-policy"
+  enable_dynamodb_policy = true
+  dynamodb_table_name    = aws_dynamodb_table.stores.name
+  dynamodb_table_arn     = aws_dynamodb_table.stores.arn
+  dynamodb_actions = [
+    "dynamodb:Query",
+    "dynamodb:GetItem",
+    "dynamodb:PutItem",
+    "dynamodb:UpdateItem",
+    "dynamodb:DeleteItem",
+    "dynamodb:DescribeTable",
+  ]
+
+  # 内部トークンを検証し、X-Company-Id 等のヘッダーではなくクレームを信頼する
+  environment_variables = {
+    INTERNAL_TOKEN_SIGNING_KEY = local.internal_token_signing_key
+    STORES_TABLE_NAME          = aws_dynamodb_table.stores.name
+  }
+
+  tags = {
+    Environment = "local"
+    ManagedBy   = "terraform"
+  }
+}
+
+# トークン管理 Lambda 関数（ローテーション等）
+# 実行例: make exec-lambda LAMBDA_NAME=token-admin PAYLOAD='{"action":"rotate","token":"allow"}'
+# ロックアウトの解除: PAYLOAD='{"action":"unlock","subject":"ip#203.0.113.5","operator":"you@example.com"}'
+module "lambda_token_admin" {
+  source = "../modules/lambda"
+
+  function_name          = "token-admin"
+  zip_path               = "/lambda/token-admin/function.zip"
+  timeout                = 10
+  iam_role_name          = "lambda-token-admin-role"
+  iam_policy_name        = "lambda-token-admin-policy"
+  enable_dynamodb_policy = true
+  dynamodb_table_name    = module.dynamodb.table_name
+  dynamodb_table_arn     = module.dynamodb.table_arn
+  dynamodb_actions       = ["dynamodb:GetItem", "dynamodb:PutItem", "dynamodb:UpdateItem"]
+
+  # ロックアウトの解除と監査ログの書き込み
+  additional_policy_statements = [
+    { actions = ["dynamodb:GetItem", "dynamodb:DeleteItem"], resources = [aws_dynamodb_table.auth_failures.arn] },
+    { actions = ["dynamodb:PutItem"], resources = [aws_dynamodb_table.authz_audit_log.arn] },
+  ]
+
+  tags = {
+    Environment = "local"
+    ManagedBy   = "terraform"
+  }
+}
+
+# トークン変更通知 Lambda 関数（DynamoDB Streams → バージョンマーカー）
+module "lambda_token_stream_processor" {
+  source = "../modules/lambda"
+
+  function_name          = "token-stream-processor"
+  zip_path               = "/lambda/token-stream-processor/function.zip"
+  timeout                = 30
+  iam_role_name          = "lambda-token-stream-processor-role"
+  iam_policy_name        = "lambda-token-stream-processor-policy"
+  enable_dynamodb_policy = true
+  dynamodb_table_name    = module.dynamodb.table_name
+  dynamodb_table_arn     = module.dynamodb.table_arn
+  dynamodb_actions = [
+    "dynamodb:GetItem",
+    "dynamodb:PutItem",
+    "dynamodb:DescribeStream",
+    "dynamodb:GetRecords",
+    "dynamodb:GetShardIterator",
+    "dynamodb:ListStreams",
+  ]
+
   tags = {
     Environment = "local"
     ManagedBy   = "terraform"
   }
 }
 
+resource "aws_lambda_event_source_mapping" "token_stream" {
+  event_source_arn  = module.dynamodb.stream_arn
+  function_name     = module.lambda_token_stream_processor.function_name
+  starting_position = "LATEST"
+  batch_size        = 100
+}
+
 # API Gateway
 module "apigateway" {
   source = "../modules/apigateway"
@@ -59,10 +265,35 @@ module "apigateway" {
   backend_function_name          = module.lambda_test_function.function_name
   backend_function_invoke_arn    = module.lambda_test_function.invoke_arn
 
+  # 送信元IPごとのロックアウトとなりすまし（X-Act-As-Company）はヘッダー・送信元IPを受け取れる REQUEST タイプが必要
+  authorizer_type = "REQUEST"
+
   # レート制限（ローカル開発環境用）
   throttle_burst_limit = 100   # 秒間最大100リクエスト
   throttle_rate_limit  = 50    # 秒間平均50リクエスト
 
+  # 契約プランごとの usage plan（トークンの apiKey 属性で適用される）
+  usage_plans = {
+    free = {
+      throttle_burst_limit = 10
+      throttle_rate_limit  = 5
+      quota_limit          = 1000
+      quota_period         = "DAY"
+    }
+    pro = {
+      throttle_burst_limit = 100
+      throttle_rate_limit  = 50
+    }
+  }
+
+  # シードデータの allow トークンに紐づく API キー（init/seed_dynamodb.sh と同じ値）
+  api_keys = {
+    "seed-tenant" = {
+      tier  = "pro"
+      value = local.seed_tenant_api_key
+    }
+  }
+
   # VPC Link統合（LocalStackでの検証用）
   # 注意: LocalStackではVPC Linkが完全にサポートされていないため、動作しない可能性があります
   # vpc_link_id          = module.vpclink.vpc_link_id
@@ -17,6 +17,7 @@ provider "aws" {
     ec2            = "http://localstack:4566"
     elbv2          = "http://localstack:4566"
     logs           = "http://localstack:4566"
+    events         = "http://localstack:4566"
     ecs            = "http://localstack:4566"
     elasticloadbalancing = "http://localstack:4566"
   }
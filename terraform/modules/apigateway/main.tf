@@ -5,6 +5,9 @@
 resource "aws_api_gateway_rest_api" "api" {
   name = var.api_name
 
+  # API キーは Lambda Authorizer が返す usageIdentifierKey から取得する（usage plan の計測・スロットリング用）
+  api_key_source = "AUTHORIZER"
+
   tags = var.tags
 }
 
@@ -16,15 +19,28 @@ resource "aws_api_gateway_resource" "test" {
 }
 
 # Lambda Authorizer
+# REQUEST タイプにすると、認可ルールの条件式（CEL）でリクエストヘッダーと送信元IPを参照でき、
+# 送信元IPごとのロックアウトとなりすまし（X-Act-As-Company）も有効になる
+locals {
+  # REQUEST タイプでは送信元IPとなりすまし先も identity source に含め、認可結果を別の送信元・テナントに使い回さない
+  authorizer_identity_source = var.authorizer_type == "REQUEST" ? join(",", [
+    "method.request.header.Authorization",
+    "method.request.header.X-Act-As-Company",
+    "context.identity.sourceIp",
+  ]) : "method.request.header.Authorization"
+}
+
 resource "aws_api_gateway_authorizer" "token_authorizer" {
-  name                             = "token-authorizer"
-  rest_api_id                      = aws_api_gateway_rest_api.api.id
-  type                             = "TOKEN"
-  authorizer_uri                   = var.authorizer_function_invoke_arn
-  identity_source                  = "method.request.header.Authorization"
-  # TODO(本番): TTLを300-3600秒に変更してパフォーマンスとコストを改善
+  name            = "token-authorizer"
+  rest_api_id     = aws_api_gateway_rest_api.api.id
+  type            = var.authorizer_type
+  authorizer_uri  = var.authorizer_function_invoke_arn
+  identity_source = local.authorizer_identity_source
+  # REQUEST タイプはキャッシュを無効にする
+  # キャッシュが有効だと identity source はすべて必須になり、X-Act-As-Company のないリクエストが 401 になるため
+  # TODO(本番): TOKEN タイプは TTL を300-3600秒に変更してパフォーマンスとコストを改善
   # 現在1秒はテスト/開発用。本番では認可結果をキャッシュすることでDynamoDB呼び出しを削減
-  authorizer_result_ttl_in_seconds = 1
+  authorizer_result_ttl_in_seconds = var.authorizer_type == "REQUEST" ? 0 : 1
 }
 
 # Lambda Authorizer への呼び出し権限
@@ -52,6 +68,9 @@ resource "aws_api_gateway_method" "get" {
   http_method   = "GET"
   authorization = "CUSTOM"
   authorizer_id = aws_api_gateway_authorizer.token_authorizer.id
+
+  # usage plan を使う場合は API キー必須（API キーのないトークンは 403）
+  api_key_required = length(var.usage_plans) > 0
 }
 
 # メソッドレスポンス（200 OK）
@@ -66,6 +85,33 @@ resource "aws_api_gateway_method_response" "response_200" {
   }
 }
 
+locals {
+  # バックエンドのエラーコードとステータスコード（lambda/test-function/apierror と同じ対応）
+  # Lambda のエラーの errorMessage は "[<コード>] <メッセージ>" の形式
+  backend_error_codes = {
+    "400" = "VALIDATION_ERROR"
+    "401" = "UNAUTHORIZED"
+    "403" = "FORBIDDEN"
+    "404" = "NOT_FOUND"
+    "405" = "METHOD_NOT_ALLOWED"
+    "409" = "CONFLICT"
+  }
+}
+
+# メソッドレスポンス（バックエンドのエラーコードに対応する 4xx）
+resource "aws_api_gateway_method_response" "error" {
+  for_each = local.backend_error_codes
+
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  resource_id = aws_api_gateway_resource.test.id
+  http_method = aws_api_gateway_method.get.http_method
+  status_code = each.key
+
+  response_models = {
+    "application/json" = "Error"
+  }
+}
+
 # メソッドレスポンス（500 Internal Server Error）
 resource "aws_api_gateway_method_response" "response_500" {
   rest_api_id = aws_api_gateway_rest_api.api.id
@@ -123,6 +169,9 @@ resource "aws_api_gateway_integration" "lambda_integration" {
 
   # リクエストマッピングテンプレート: Authorizerのcontextからヘッダー情報を追加
   # JSONペイロード内のheadersオブジェクトに追加することで、AWS署名を壊さない
+  # フィールドはバックエンドの Request（lambda/test-function）と対応させる
+  # （クエリ文字列・パスパラメーター・ステージ変数は $input.params() 等でデコード済みの値を渡す）
+  # path 以降のフィールドは $util.escapeJavaScript が出力する \' を replaceAll で ' に戻す（\' は JSON のエスケープシーケンスではない）
   request_templates = {
     "application/json" = <<EOF
 {
@@ -140,9 +189,40 @@ resource "aws_api_gateway_integration" "lambda_integration" {
     #if($context.authorizer.internalToken && $context.authorizer.internalToken != "")
     ,"X-Internal-Token": "Bearer $context.authorizer.internalToken"
     #end
+    #if($context.authorizer.token_rotation_pending == "true")
+    ,"X-Token-Rotation-Pending": "true"
+    #end
+    ## なりすまし（X-Act-As-Company）時の元の呼び出し元。クライアントが送った X-Actor を上書きするため常に出力する
+    ,"X-Actor": "$!context.authorizer.actor"
   },
   "httpMethod": "$context.httpMethod",
-  "path": "$context.resourcePath"
+  ## execute-api のエンドポイントでは $context.path がステージ名付き（"/test/stores/s-1"）のため、Proxy統合の path とそろえてステージ名を除く
+  #set($path = $context.path)
+  #if($path.startsWith("/$context.stage/"))
+    #set($path = $path.substring($context.stage.length() + 1))
+  #elseif($path == "/$context.stage")
+    #set($path = "/")
+  #end
+  "path": "$util.escapeJavaScript($path).replaceAll("\\'", "'")",
+  "resource": "$context.resourcePath",
+  "queryStringParameters": {
+    #foreach($name in $input.params().querystring.keySet())
+    "$util.escapeJavaScript($name).replaceAll("\\'", "'")": "$util.escapeJavaScript($input.params().querystring.get($name)).replaceAll("\\'", "'")"#if($foreach.hasNext),#end
+    #end
+  },
+  "pathParameters": {
+    #foreach($name in $input.params().path.keySet())
+    "$util.escapeJavaScript($name).replaceAll("\\'", "'")": "$util.escapeJavaScript($input.params().path.get($name)).replaceAll("\\'", "'")"#if($foreach.hasNext),#end
+    #end
+  },
+  "stageVariables": {
+    #foreach($name in $stageVariables.keySet())
+    "$util.escapeJavaScript($name).replaceAll("\\'", "'")": "$util.escapeJavaScript($stageVariables.get($name)).replaceAll("\\'", "'")"#if($foreach.hasNext),#end
+    #end
+  },
+  "stage": "$context.stage",
+  "requestId": "$context.requestId",
+  "sourceIp": "$context.identity.sourceIp"
 }
 EOF
     # Content-Typeがない場合のデフォルト（GETリクエスト用）
@@ -162,9 +242,40 @@ EOF
     #if($context.authorizer.internalToken && $context.authorizer.internalToken != "")
     ,"X-Internal-Token": "Bearer $context.authorizer.internalToken"
     #end
+    #if($context.authorizer.token_rotation_pending == "true")
+    ,"X-Token-Rotation-Pending": "true"
+    #end
+    ## なりすまし（X-Act-As-Company）時の元の呼び出し元。クライアントが送った X-Actor を上書きするため常に出力する
+    ,"X-Actor": "$!context.authorizer.actor"
   },
   "httpMethod": "$context.httpMethod",
-  "path": "$context.resourcePath"
+  ## execute-api のエンドポイントでは $context.path がステージ名付き（"/test/stores/s-1"）のため、Proxy統合の path とそろえてステージ名を除く
+  #set($path = $context.path)
+  #if($path.startsWith("/$context.stage/"))
+    #set($path = $path.substring($context.stage.length() + 1))
+  #elseif($path == "/$context.stage")
+    #set($path = "/")
+  #end
+  "path": "$util.escapeJavaScript($path).replaceAll("\\'", "'")",
+  "resource": "$context.resourcePath",
+  "queryStringParameters": {
+    #foreach($name in $input.params().querystring.keySet())
+    "$util.escapeJavaScript($name).replaceAll("\\'", "'")": "$util.escapeJavaScript($input.params().querystring.get($name)).replaceAll("\\'", "'")"#if($foreach.hasNext),#end
+    #end
+  },
+  "pathParameters": {
+    #foreach($name in $input.params().path.keySet())
+    "$util.escapeJavaScript($name).replaceAll("\\'", "'")": "$util.escapeJavaScript($input.params().path.get($name)).replaceAll("\\'", "'")"#if($foreach.hasNext),#end
+    #end
+  },
+  "stageVariables": {
+    #foreach($name in $stageVariables.keySet())
+    "$util.escapeJavaScript($name).replaceAll("\\'", "'")": "$util.escapeJavaScript($stageVariables.get($name)).replaceAll("\\'", "'")"#if($foreach.hasNext),#end
+    #end
+  },
+  "stage": "$context.stage",
+  "requestId": "$context.requestId",
+  "sourceIp": "$context.identity.sourceIp"
 }
 EOF
   }
@@ -246,25 +357,55 @@ EOF
   ]
 }
 
+# 統合レスポンス（Lambda→API Gateway）- バックエンドのエラー（4xx）
+# バックエンドは "[<コード>] <メッセージ>" のエラーを返し、接頭辞のコードでステータスコードを選択する
+# レスポンスボディはバックエンド共通のエラーの形式（{"status":"error","code":...,"message":...}）にする
+resource "aws_api_gateway_integration_response" "error" {
+  for_each = local.backend_error_codes
+
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  resource_id = aws_api_gateway_resource.test.id
+  http_method = aws_api_gateway_method.get.http_method
+  status_code = aws_api_gateway_method_response.error[each.key].status_code
+
+  # Lambdaのエラーでは errorMessage に対してパターンを照合する
+  selection_pattern = "^\\[${each.value}\\].*"
+
+  # errorMessage から "[<コード>] " を除いた部分をメッセージとする
+  response_templates = {
+    "application/json" = <<EOF
+{
+  "status": "error",
+  "code": "${each.value}",
+  "message": "$util.escapeJavaScript($input.path('$.errorMessage').substring(${length(each.value) + 3}))"
+}
+EOF
+  }
+
+  depends_on = [
+    aws_api_gateway_integration.lambda_integration
+  ]
+}
+
 # 統合レスポンス（Lambda→API Gateway）- エラー時
 # 注意: AWS統合では、Lambda実行エラー時のみこのレスポンスが使用される
-# Lambda関数がエラーをthrowするとAPI Gatewayにエラーメッセージが返される
+# 4xx のコードが付いていないエラー（INTERNAL_ERROR・タイムアウト・パニック等）はすべて 500 にする
 resource "aws_api_gateway_integration_response" "response_500" {
   rest_api_id = aws_api_gateway_rest_api.api.id
   resource_id = aws_api_gateway_resource.test.id
   http_method = aws_api_gateway_method.get.http_method
   status_code = aws_api_gateway_method_response.response_500.status_code
 
-  # Lambda実行エラー時のパターン（errorMessageフィールドの存在を確認）
-  # 通常のレスポンスにマッチしないよう厳密なパターンを使用
-  selection_pattern = "^\\{.*\"errorMessage\".*\\}$"
+  # 4xx のパターンと重ならないよう、4xx のコードで始まらない errorMessage にマッチさせる
+  selection_pattern = "(?s)^(?!\\[(${join("|", values(local.backend_error_codes))})\\]).+"
 
-  # エラーレスポンスのマッピングテンプレート
+  # エラーの内容（内部の詳細）はレスポンスに含めない
   response_templates = {
     "application/json" = <<EOF
 {
-  "message": "Internal server error",
-  "error": "$util.escapeJavaScript($input.path('$.errorMessage'))"
+  "status": "error",
+  "code": "INTERNAL_ERROR",
+  "message": "internal server error"
 }
 EOF
   }
@@ -274,6 +415,60 @@ EOF
   ]
 }
 
+# ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+# 店舗API（/stores, /stores/{id}）
+# ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
+# AWS_PROXY 統合のため、マッピングテンプレート・統合レスポンスは不要
+# バックエンドは Authorizer の context（requestContext.authorizer）の内部トークンを検証し、
+# ステータスコード付きのレスポンスを返す
+# 操作ごとのスコープは Authorizer の認可ルール（rules.json）とバックエンドの両方で検査する
+
+resource "aws_api_gateway_resource" "stores" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_rest_api.api.root_resource_id
+  path_part   = "stores"
+}
+
+resource "aws_api_gateway_resource" "store" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = aws_api_gateway_resource.stores.id
+  path_part   = "{id}"
+}
+
+locals {
+  # 店舗APIのリソースとメソッド（GET・POST /stores、GET・PUT・DELETE /stores/{id}）
+  store_methods = {
+    "stores-GET"   = { resource_id = aws_api_gateway_resource.stores.id, http_method = "GET" }
+    "stores-POST"  = { resource_id = aws_api_gateway_resource.stores.id, http_method = "POST" }
+    "store-GET"    = { resource_id = aws_api_gateway_resource.store.id, http_method = "GET" }
+    "store-PUT"    = { resource_id = aws_api_gateway_resource.store.id, http_method = "PUT" }
+    "store-DELETE" = { resource_id = aws_api_gateway_resource.store.id, http_method = "DELETE" }
+  }
+}
+
+resource "aws_api_gateway_method" "stores" {
+  for_each = local.store_methods
+
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = each.value.resource_id
+  http_method   = each.value.http_method
+  authorization = "CUSTOM"
+  authorizer_id = aws_api_gateway_authorizer.token_authorizer.id
+
+  api_key_required = length(var.usage_plans) > 0
+}
+
+resource "aws_api_gateway_integration" "stores" {
+  for_each = local.store_methods
+
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = each.value.resource_id
+  http_method             = aws_api_gateway_method.stores[each.key].http_method
+  type                    = "AWS_PROXY"
+  integration_http_method = "POST"
+  uri                     = var.backend_function_invoke_arn
+}
+
 # デプロイ
 resource "aws_api_gateway_deployment" "deployment" {
   rest_api_id = aws_api_gateway_rest_api.api.id
@@ -282,10 +477,14 @@ resource "aws_api_gateway_deployment" "deployment" {
   depends_on = [
     aws_api_gateway_method.get,
     aws_api_gateway_method_response.response_200,
+    aws_api_gateway_method_response.error,
     aws_api_gateway_method_response.response_500,
     aws_api_gateway_integration.lambda_integration,
     aws_api_gateway_integration_response.response_200,
-    aws_api_gateway_integration_response.response_500
+    aws_api_gateway_integration_response.error,
+    aws_api_gateway_integration_response.response_500,
+    aws_api_gateway_method.stores,
+    aws_api_gateway_integration.stores,
   ]
 
   # 設定変更時に再デプロイするためのトリガー
@@ -293,17 +492,24 @@ resource "aws_api_gateway_deployment" "deployment" {
     redeployment = sha1(jsonencode([
       aws_api_gateway_resource.test.id,
       aws_api_gateway_method.get.id,
+      aws_api_gateway_method.get.api_key_required,
       aws_api_gateway_integration.lambda_integration.id,
       aws_api_gateway_integration.lambda_integration.request_templates,
       aws_api_gateway_method_response.response_200.id,
+      [for r in aws_api_gateway_method_response.error : r.id],
       aws_api_gateway_method_response.response_500.id,
       aws_api_gateway_integration_response.response_200.id,
       aws_api_gateway_integration_response.response_200.response_templates,
       aws_api_gateway_integration_response.response_200.selection_pattern,
+      [for r in aws_api_gateway_integration_response.error : [r.id, r.response_templates, r.selection_pattern]],
       aws_api_gateway_integration_response.response_500.id,
       aws_api_gateway_integration_response.response_500.response_templates,
       aws_api_gateway_integration_response.response_500.selection_pattern,
       aws_api_gateway_authorizer.token_authorizer.id,
+      aws_api_gateway_resource.stores.id,
+      aws_api_gateway_resource.store.id,
+      [for m in aws_api_gateway_method.stores : m.id],
+      [for i in aws_api_gateway_integration.stores : i.id],
     ]))
   }
 
@@ -338,6 +544,53 @@ resource "aws_api_gateway_stage" "stage" {
   tags = var.tags
 }
 
+# Usage Plan（契約プランごと）
+# Lambda Authorizer がトークンの apiKey 属性を usageIdentifierKey として返し、
+# API Gateway はそのキーが属する usage plan でテナントごとに計測・スロットリングする
+resource "aws_api_gateway_usage_plan" "tier" {
+  for_each = var.usage_plans
+
+  name = "${var.api_name}-${each.key}"
+
+  api_stages {
+    api_id = aws_api_gateway_rest_api.api.id
+    stage  = aws_api_gateway_stage.stage.stage_name
+  }
+
+  throttle_settings {
+    burst_limit = each.value.throttle_burst_limit
+    rate_limit  = each.value.throttle_rate_limit
+  }
+
+  dynamic "quota_settings" {
+    for_each = each.value.quota_limit != null ? [1] : []
+    content {
+      limit  = each.value.quota_limit
+      period = each.value.quota_period
+    }
+  }
+
+  tags = var.tags
+}
+
+# テナントの API キー（値を省略した場合は API Gateway が生成する）
+resource "aws_api_gateway_api_key" "tenant" {
+  for_each = var.api_keys
+
+  name  = "${var.api_name}-${each.key}"
+  value = each.value.value
+
+  tags = var.tags
+}
+
+resource "aws_api_gateway_usage_plan_key" "tenant" {
+  for_each = var.api_keys
+
+  key_id        = aws_api_gateway_api_key.tenant[each.key].id
+  key_type      = "API_KEY"
+  usage_plan_id = aws_api_gateway_usage_plan.tier[each.value.tier].id
+}
+
 # ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
 # VPC Link統合用リソース（オプション）
 # ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
@@ -358,6 +611,8 @@ resource "aws_api_gateway_method" "vpclink_get" {
   http_method   = "GET"
   authorization = "CUSTOM"
   authorizer_id = aws_api_gateway_authorizer.token_authorizer.id
+
+  api_key_required = length(var.usage_plans) > 0
 }
 
 # VPC Link用メソッドレスポンス（200 OK）
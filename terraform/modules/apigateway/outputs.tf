@@ -24,3 +24,14 @@ output "invoke_url" {
   description = "API の呼び出し URL"
   value       = aws_api_gateway_stage.stage.invoke_url
 }
+
+output "usage_plan_ids" {
+  description = "tier ごとの usage plan ID"
+  value       = { for k, v in aws_api_gateway_usage_plan.tier : k => v.id }
+}
+
+output "api_key_values" {
+  description = "テナントごとの API キーの値（トークンの apiKey 属性に設定する）"
+  value       = { for k, v in aws_api_gateway_api_key.tenant : k => v.value }
+  sensitive   = true
+}
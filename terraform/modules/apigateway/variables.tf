@@ -21,6 +21,17 @@ variable "authorizer_function_invoke_arn" {
   type        = string
 }
 
+variable "authorizer_type" {
+  description = "Lambda Authorizer のタイプ（TOKEN / REQUEST）"
+  type        = string
+  default     = "TOKEN"
+
+  validation {
+    condition     = contains(["TOKEN", "REQUEST"], var.authorizer_type)
+    error_message = "authorizer_type は TOKEN または REQUEST を指定してください。"
+  }
+}
+
 variable "backend_function_name" {
   description = "バックエンド Lambda 関数名"
   type        = string
@@ -48,6 +59,30 @@ variable "throttle_rate_limit" {
   default     = 10000
 }
 
+variable "usage_plans" {
+  # 設定するとすべてのメソッドが API キー必須になり、Authorizer が usageIdentifierKey を返さない呼び出し元
+  # （apiKey 属性のないトークン、JWT・PASETO・イントロスペクション等）は 403 になる
+  # そのような呼び出し元がある場合は Authorizer の AUTHZ_TENANT_API_KEYS でテナント（companyId）ごとのキーを設定する
+  description = "契約プラン（tier）ごとの usage plan 設定（空の場合は usage plan を作成せず API キーも不要）"
+  type = map(object({
+    throttle_burst_limit = number
+    throttle_rate_limit  = number
+    quota_limit          = optional(number)
+    quota_period         = optional(string, "MONTH")
+  }))
+  default = {}
+}
+
+variable "api_keys" {
+  description = "テナントごとの API キー（tier は usage_plans のキー、value を省略すると自動生成）"
+  type = map(object({
+    tier  = string
+    value = optional(string)
+  }))
+  # for_each に使うため sensitive にはしない（値はキーを自動生成すれば state にのみ残る）
+  default = {}
+}
+
 variable "tags" {
   description = "リソースに付与するタグ"
   type        = map(string)
@@ -6,6 +6,10 @@ resource "aws_dynamodb_table" "allowed_tokens" {
   billing_mode = "PAY_PER_REQUEST"
   hash_key     = "token"
 
+  # DynamoDB Streams（token-stream-processor がトークンの変更を Authorizer に伝えるために使用）
+  stream_enabled   = var.stream_enabled
+  stream_view_type = var.stream_enabled ? "KEYS_ONLY" : null
+
   attribute {
     name = "token"
     type = "S"
@@ -14,3 +14,8 @@ output "table_id" {
   description = "DynamoDB テーブルの ID"
   value       = aws_dynamodb_table.allowed_tokens.id
 }
+
+output "stream_arn" {
+  description = "DynamoDB Streams の ARN（stream_enabled が false の場合は空）"
+  value       = aws_dynamodb_table.allowed_tokens.stream_arn
+}
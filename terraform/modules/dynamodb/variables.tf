@@ -12,6 +12,12 @@ variable "enable_encryption" {
   default     = false
 }
 
+variable "stream_enabled" {
+  description = "DynamoDB Streams を有効化するか（トークンのプリロード時の変更通知に使用）"
+  type        = bool
+  default     = false
+}
+
 variable "tags" {
   description = "リソースに付与するタグ"
   type        = map(string)
@@ -27,13 +27,19 @@ resource "aws_iam_policy" "lambda_policy" {
 
   policy = jsonencode({
     Version = "2012-10-17"
-    Statement = [{
-      Effect = "Allow"
-      Action = [
-        "dynamodb:GetItem"
-      ]
-      Resource = var.dynamodb_table_arn
-    }]
+    Statement = concat(
+      [{
+        Effect = "Allow"
+        Action = var.dynamodb_actions
+        # ストリーム系のアクション（dynamodb:GetRecords 等）はストリームの ARN が対象
+        Resource = [var.dynamodb_table_arn, "${var.dynamodb_table_arn}/stream/*"]
+      }],
+      [for s in var.additional_policy_statements : {
+        Effect   = "Allow"
+        Action   = s.actions
+        Resource = s.resources
+      }],
+    )
   })
 
   tags = var.tags
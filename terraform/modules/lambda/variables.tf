@@ -58,6 +58,21 @@ variable "dynamodb_table_arn" {
   default     = ""
 }
 
+variable "dynamodb_actions" {
+  description = "IAM ポリシーで許可する DynamoDB アクション"
+  type        = list(string)
+  default     = ["dynamodb:GetItem"]
+}
+
+variable "additional_policy_statements" {
+  description = "IAM ポリシーに追加するステートメント（AllowedTokens 以外のテーブルへのアクセス等）"
+  type = list(object({
+    actions   = list(string)
+    resources = list(string)
+  }))
+  default = []
+}
+
 variable "environment_variables" {
   description = "Lambda 関数の追加環境変数"
   type        = map(string)